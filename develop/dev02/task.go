@@ -20,9 +20,11 @@ package main
 */
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
-	"regexp"
+	"io"
+	"math"
 	"strconv"
 	"strings"
 	"unicode"
@@ -30,71 +32,267 @@ import (
 )
 
 var ErrInvalidString = errors.New("invalid string")
+var ErrInvalidOptions = errors.New("invalid options")
+var ErrCountTooLarge = errors.New("repeat count is too large")
 
-func unpack(s string) (string, error) {
-	if s == "" {
-		return s, nil
+// options - параметры формата упакованной строки.
+type options struct {
+	// escape - руна, экранирующая следующую за ней руну.
+	escape rune
+	// maxCount - максимальное число повторений в одной записи, 0 - без
+	// ограничения. Более длинные серии pack разбивает на несколько записей.
+	maxCount int
+	// maxOutput - максимальный размер распакованных данных в байтах, 0 - без
+	// ограничения.
+	maxOutput int64
+}
+
+var defaultOptions = options{escape: '\\'}
+
+func (opts options) validate() error {
+	if unicode.IsDigit(opts.escape) || !utf8.ValidRune(opts.escape) || opts.maxCount < 0 || opts.maxOutput < 0 {
+		return ErrInvalidOptions
 	}
 
-	// Проверяем, что в начале не цифра.
-	first, _ := utf8.DecodeRuneInString(s)
-	if unicode.IsDigit(first) {
-		return "", ErrInvalidString
+	return nil
+}
+
+func unpack(s string) (string, error) {
+	return unpackWith(s, defaultOptions)
+}
+
+func unpackWith(s string, opts options) (string, error) {
+	b := strings.Builder{}
+	if _, err := unpackStream(strings.NewReader(s), &b, opts); err != nil {
+		return "", err
 	}
 
-	// Проверяем, что в конце 0 или четное количество escape-символов.
-	re := regexp.MustCompile(`\\+$`)
-	match := re.FindString(s)
-	if (utf8.RuneCountInString(match) % 2) != 0 {
-		return "", ErrInvalidString
+	return b.String(), nil
+}
+
+// UnpackError - ошибка в упакованных данных. Offset - байтовое смещение
+// руны или количества повторений, на которых произошла ошибка.
+type UnpackError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *UnpackError) Error() string {
+	return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+}
+
+func (e *UnpackError) Unwrap() error {
+	return e.Err
+}
+
+var ErrOutputTooLarge = errors.New("output size limit exceeded")
+
+// unpackStream распаковывает данные из r в w по мере чтения, не держа
+// результат в памяти. Возвращает количество записанных в w байт; при ошибке
+// в w остается результат, распакованный до нее.
+func unpackStream(r io.Reader, w io.Writer, opts options) (int64, error) {
+	if err := opts.validate(); err != nil {
+		return 0, err
 	}
 
+	in := bufio.NewReader(r)
+	cw := &countingWriter{w: w}
+	out := bufio.NewWriter(cw)
+
 	const (
 		characters = iota
 		digits
 		escape
 	)
-	b := strings.Builder{}
 	state := characters
-	prevChar := ""
-	num := ""
+	// written - объем результата вместе с буфером, его ограничивает
+	// maxOutput.
+	var offset, written int64
+	var size int
+	var prev []byte
+	var count, countOffset, escapeOffset int64
+	// prevOffset - смещение руны в prev, о ней сообщает ошибка записи.
+	var prevOffset int64
+
+	// fail отдает в w то, что распаковано до ошибки.
+	fail := func(err error) (int64, error) {
+		out.Flush()
+		return cw.n, err
+	}
+
+	write := func(p []byte) error {
+		if opts.maxOutput > 0 && written+int64(len(p)) > opts.maxOutput {
+			return &UnpackError{Offset: prevOffset, Err: ErrOutputTooLarge}
+		}
+		n, err := out.Write(p)
+		written += int64(n)
+		return err
+	}
+
+	repeat := func() error {
+		if opts.maxOutput > 0 && len(prev) > 0 && count > (opts.maxOutput-written)/int64(len(prev)) {
+			return &UnpackError{Offset: countOffset, Err: ErrOutputTooLarge}
+		}
+		for i := int64(0); i < count; i++ {
+			n, err := out.Write(prev)
+			written += int64(n)
+			if err != nil {
+				return err
+			}
+		}
+		prev = prev[:0]
+		return nil
+	}
+
+	addDigit := func(r rune) error {
+		digit := int64(r - '0')
+		if digit < 0 || digit > 9 {
+			return &UnpackError{Offset: offset, Err: ErrInvalidString}
+		}
+		if count > (math.MaxInt64-digit)/10 {
+			return &UnpackError{Offset: countOffset, Err: ErrCountTooLarge}
+		}
+		count = count*10 + digit
+		if opts.maxCount > 0 && count > int64(opts.maxCount) {
+			return &UnpackError{Offset: countOffset, Err: ErrCountTooLarge}
+		}
+		return nil
+	}
+
+	for ; ; offset += int64(size) {
+		var r rune
+		var err error
+		r, size, err = in.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
 
-	// Добавляем пробел в конец строки, чтобы свитч отработал с последним символом
-	// искомой строки.
-	for _, r := range s + " " {
 		switch state {
 		case characters:
 			if unicode.IsDigit(r) {
+				// Проверяем, что в начале не цифра.
+				if offset == 0 {
+					return fail(&UnpackError{Offset: offset, Err: ErrInvalidString})
+				}
 				state = digits
-				num = string(r)
-			} else if r == '\\' {
-				state = escape
-				b.WriteString(prevChar)
-			} else {
-				b.WriteString(prevChar)
-				prevChar = string(r)
+				count = 0
+				countOffset = offset
+				if err := addDigit(r); err != nil {
+					return fail(err)
+				}
+				continue
+			}
+
+			if err := write(prev); err != nil {
+				return fail(err)
 			}
+			prev = prev[:0]
 		case digits:
 			if unicode.IsDigit(r) {
-				num += string(r)
-			} else {
-				count, _ := strconv.Atoi(num)
-				b.WriteString(strings.Repeat(prevChar, count))
-				num = ""
-
-				if r == '\\' {
-					state = escape
-				} else {
-					state = characters
-					prevChar = string(r)
+				if err := addDigit(r); err != nil {
+					return fail(err)
 				}
+				continue
+			}
+
+			if err := repeat(); err != nil {
+				return fail(err)
 			}
 		case escape:
 			state = characters
-			prevChar = string(r)
+			prev, prevOffset = utf8.AppendRune(prev, r), offset
+			continue
+		}
+
+		if r == opts.escape {
+			state = escape
+			escapeOffset = offset
+		} else {
+			state = characters
+			prev, prevOffset = utf8.AppendRune(prev, r), offset
+		}
+	}
+
+	// Обрабатываем последний символ строки.
+	switch state {
+	case digits:
+		if err := repeat(); err != nil {
+			return fail(err)
+		}
+	case escape:
+		return fail(&UnpackError{Offset: escapeOffset, Err: ErrInvalidString})
+	default:
+		if err := write(prev); err != nil {
+			return fail(err)
+		}
+	}
+
+	err := out.Flush()
+	return cw.n, err
+}
+
+// countingWriter считает байты, записанные в w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func pack(s string) string {
+	packed, _ := packWith(s, defaultOptions)
+	return packed
+}
+
+// packWith сжимает серии одинаковых рун в запись "руна+количество", экранируя
+// цифры и escape-руну так, что unpackWith(packWith(s)) == s.
+func packWith(s string, opts options) (string, error) {
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
+
+	b := strings.Builder{}
+
+	writeRun := func(r rune, count int) {
+		for count > 0 {
+			n := count
+			if opts.maxCount > 0 && n > opts.maxCount {
+				n = opts.maxCount
+			}
+
+			if unicode.IsDigit(r) || r == opts.escape {
+				b.WriteRune(opts.escape)
+			}
+			b.WriteRune(r)
+			if n > 1 {
+				b.WriteString(strconv.Itoa(n))
+			}
+
+			count -= n
 		}
 	}
 
+	var prev rune
+	count := 0
+	for _, r := range s {
+		if count > 0 && r == prev {
+			count++
+			continue
+		}
+
+		writeRun(prev, count)
+		prev = r
+		count = 1
+	}
+	writeRun(prev, count)
+
 	return b.String(), nil
 }
 
@@ -107,4 +305,5 @@ func main() {
 	}
 	fmt.Printf("Unpacked: %q\n", unpacked)
 	fmt.Printf("Expected: %q\n", `aaaab222d\\\eeeeeeeeeeee`)
+	fmt.Printf("Packed:   %q\n", pack(unpacked))
 }
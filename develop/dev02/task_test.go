@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
+	"testing/quick"
+	"unicode/utf8"
 )
 
 type result struct {
@@ -29,8 +34,155 @@ func TestUnpack(t *testing.T) {
 
 	for _, c := range cases {
 		got, err := unpack(c.in)
-		if got != c.want.val || err != c.want.err {
+		if got != c.want.val || !errors.Is(err, c.want.err) {
 			t.Errorf(`unpack(%q) == %q, %v; want %q, %v`, c.in, got, err, c.want.val, c.want.err)
 		}
 	}
 }
+
+func TestUnpackWith(t *testing.T) {
+	cases := []struct {
+		in   string
+		opts options
+		want result
+	}{
+		{`a4b/5/`, options{escape: '/'}, result{"", ErrInvalidString}},
+		{`a4b/5//`, options{escape: '/'}, result{"aaaab5/", nil}},
+		{`qwe\4`, options{escape: '/'}, result{`qwe\\\\`, nil}},
+		{"a9b10", options{escape: '\\', maxCount: 9}, result{"", ErrCountTooLarge}},
+		{"a99999999999999999999", defaultOptions, result{"", ErrCountTooLarge}},
+		{"abc", options{escape: '7'}, result{"", ErrInvalidOptions}},
+		{"abc", options{escape: '\\', maxCount: -1}, result{"", ErrInvalidOptions}},
+	}
+
+	for _, c := range cases {
+		got, err := unpackWith(c.in, c.opts)
+		if got != c.want.val || !errors.Is(err, c.want.err) {
+			t.Errorf(`unpackWith(%q, %+v) == %q, %v; want %q, %v`, c.in, c.opts, got, err, c.want.val, c.want.err)
+		}
+	}
+}
+
+func TestUnpackStream(t *testing.T) {
+	cases := []struct {
+		in     string
+		opts   options
+		want   string
+		err    error
+		offset int64
+	}{
+		{"a4bc2d5e", defaultOptions, "aaaabccddddde", nil, 0},
+		{"45", defaultOptions, "", ErrInvalidString, 0},
+		{`ab\cd\`, defaultOptions, "abcd", ErrInvalidString, 5},
+		{"ёa٣", defaultOptions, "ё", ErrInvalidString, 3},
+		{"a999999999", options{escape: '\\', maxOutput: 1 << 20}, "", ErrOutputTooLarge, 1},
+		{"ab日3c", options{escape: '\\', maxOutput: 10}, "ab", ErrOutputTooLarge, 5},
+		{"ab日3c", options{escape: '\\', maxOutput: 12}, "ab日日日c", nil, 0},
+		{"abc", options{escape: '\\', maxOutput: 1}, "a", ErrOutputTooLarge, 1},
+		{"日本語", options{escape: '\\', maxOutput: 1}, "", ErrOutputTooLarge, 0},
+		{`a\5`, options{escape: '\\', maxOutput: 1}, "a", ErrOutputTooLarge, 2},
+		{"xa123456789012345678901234567890", defaultOptions, "x", ErrCountTooLarge, 2},
+	}
+
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		n, err := unpackStream(strings.NewReader(c.in), buf, c.opts)
+		if !errors.Is(err, c.err) {
+			t.Errorf("unpackStream(%q) error == %v; want %v", c.in, err, c.err)
+			continue
+		}
+
+		if c.err != nil {
+			var unpackErr *UnpackError
+			if !errors.As(err, &unpackErr) || unpackErr.Offset != c.offset {
+				t.Errorf("unpackStream(%q) error == %v; want offset %d", c.in, err, c.offset)
+			}
+		}
+
+		// При ошибке в w остается результат, распакованный до нее.
+		if buf.String() != c.want || n != int64(len(c.want)) {
+			t.Errorf("unpackStream(%q) == %q, %d; want %q, %d", c.in, buf.String(), n, c.want, len(c.want))
+		}
+	}
+}
+
+func TestPack(t *testing.T) {
+	cases := []struct {
+		in   string
+		opts options
+		want string
+	}{
+		{"", defaultOptions, ""},
+		{"abcd", defaultOptions, "abcd"},
+		{"aaaabccddddde", defaultOptions, "a4bc2d5e"},
+		{"qwe44444", defaultOptions, `qwe\45`},
+		{`qwe\\\\\`, defaultOptions, `qwe\\5`},
+		{"ёёё日日", defaultOptions, "ё3日2"},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaa", options{escape: '\\', maxCount: 9}, "a9a9a7"},
+		{"a//5", options{escape: '/'}, "a//2/5"},
+	}
+
+	for _, c := range cases {
+		got, err := packWith(c.in, c.opts)
+		if got != c.want || err != nil {
+			t.Errorf(`packWith(%q, %+v) == %q, %v; want %q, <nil>`, c.in, c.opts, got, err, c.want)
+		}
+	}
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	optsList := []options{
+		defaultOptions,
+		{escape: '/', maxCount: 3},
+		{escape: 'ж', maxCount: 1},
+		{escape: '日'},
+	}
+
+	for _, opts := range optsList {
+		opts := opts
+		roundTrip := func(runes []rune, runs []uint8) bool {
+			// Собираем строку из серий, чтобы в ней встречались повторы.
+			b := strings.Builder{}
+			for i, r := range runes {
+				if !utf8.ValidRune(r) {
+					r = utf8.RuneError
+				}
+				n := 1
+				if i < len(runs) {
+					n += int(runs[i] % 16)
+				}
+				b.WriteString(strings.Repeat(string(r), n))
+			}
+			s := b.String()
+
+			packed, err := packWith(s, opts)
+			if err != nil {
+				return false
+			}
+			unpacked, err := unpackWith(packed, opts)
+			return err == nil && unpacked == s
+		}
+
+		if err := quick.Check(roundTrip, nil); err != nil {
+			t.Errorf("options %+v: %v", opts, err)
+		}
+	}
+}
+
+func FuzzPackRoundTrip(f *testing.F) {
+	for _, seed := range []string{"", "abcd", "aaaabccddddde", `qwe\\\\\`, "qwe44444", "ёёё日日"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		if !utf8.ValidString(s) {
+			t.Skip()
+		}
+
+		packed := pack(s)
+		unpacked, err := unpack(packed)
+		if err != nil || unpacked != s {
+			t.Errorf("unpack(pack(%q)) == %q, %v; packed %q", s, unpacked, err, packed)
+		}
+	})
+}
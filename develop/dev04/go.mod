@@ -1,3 +1,5 @@
 module dev04
 
 go 1.18
+
+require golang.org/x/text v0.3.8
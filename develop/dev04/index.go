@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// AnagramIndex - словарь множеств анаграмм с поддержкой добавления и удаления
+// слов. Безопасен для конкурентного использования.
+type AnagramIndex struct {
+	// mu защищает остальные поля.
+	mu sync.RWMutex
+	// Счетчик добавленных слов, задает порядок их появления в словаре.
+	seq uint64
+	// Коллекция анаграмм вида: ключ анаграммы -> множество слов.
+	groups map[string]*anagramGroup
+	// Префиксное дерево по тем же ключам для поиска по набору букв.
+	keys *keyNode
+	opts keyOptions
+}
+
+type anagramGroup struct {
+	// Слово -> порядковый номер его первого появления в словаре.
+	words map[string]uint64
+	// Первое встретившееся слово множества.
+	first    string
+	firstSeq uint64
+}
+
+func NewAnagramIndex() *AnagramIndex {
+	return NewAnagramIndexWith(keyOptions{})
+}
+
+func NewAnagramIndexWith(opts keyOptions) *AnagramIndex {
+	return &AnagramIndex{groups: make(map[string]*anagramGroup), keys: newKeyNode(), opts: opts}
+}
+
+func (idx *AnagramIndex) nextSeq(n int) uint64 {
+	return atomic.AddUint64(&idx.seq, uint64(n)) - uint64(n)
+}
+
+func (idx *AnagramIndex) Add(words ...string) {
+	seq := idx.nextSeq(len(words))
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for i, word := range words {
+		idx.insert(strings.ToLower(word), idx.opts.key(word), seq+uint64(i))
+	}
+}
+
+// insert добавляет слово в множество. Вызывающий должен держать блокировку на
+// запись.
+func (idx *AnagramIndex) insert(word string, key string, seq uint64) {
+	group, ok := idx.groups[key]
+	if !ok {
+		group = &anagramGroup{words: make(map[string]uint64), first: word, firstSeq: seq}
+		idx.groups[key] = group
+		idx.keys.add(key)
+	}
+
+	// Слово могло уже встретиться раньше, тогда его номер не меняется. При
+	// параллельной загрузке слова приходят не по порядку, поэтому первое
+	// слово определяется по наименьшему номеру.
+	if prev, ok := group.words[word]; ok && prev <= seq {
+		return
+	}
+
+	group.words[word] = seq
+	if seq <= group.firstSeq {
+		group.first = word
+		group.firstSeq = seq
+	}
+}
+
+func (idx *AnagramIndex) Remove(word string) bool {
+	key := idx.opts.key(word)
+	word = strings.ToLower(word)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	group, ok := idx.groups[key]
+	if !ok {
+		return false
+	}
+
+	if _, ok := group.words[word]; !ok {
+		return false
+	}
+
+	delete(group.words, word)
+	if len(group.words) == 0 {
+		delete(idx.groups, key)
+		idx.keys.remove(key)
+		return true
+	}
+
+	// Удалили первое слово - ключом множества становится следующее по порядку.
+	if word == group.first {
+		group.firstSeq = ^uint64(0)
+		for w, seq := range group.words {
+			if seq < group.firstSeq {
+				group.first = w
+				group.firstSeq = seq
+			}
+		}
+	}
+
+	return true
+}
+
+// Lookup возвращает отсортированное множество анаграмм слова, включая само
+// слово, если оно есть в словаре.
+func (idx *AnagramIndex) Lookup(word string) []string {
+	key := idx.opts.key(word)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	group, ok := idx.groups[key]
+	if !ok {
+		return []string{}
+	}
+
+	return group.sorted()
+}
+
+// Groups возвращает все множества из двух и более слов. Ключ - первое
+// встретившееся в словаре слово из множества.
+func (idx *AnagramIndex) Groups() map[string][]string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	res := make(map[string][]string)
+	for _, group := range idx.groups {
+		if len(group.words) == 1 {
+			continue
+		}
+
+		res[group.first] = group.sorted()
+	}
+
+	return res
+}
+
+func (group *anagramGroup) sorted() []string {
+	sequence := make([]string, 0, len(group.words))
+	for word := range group.words {
+		sequence = append(sequence, word)
+	}
+
+	sort.Strings(sequence)
+	return sequence
+}
+
+// Размер пачки слов, которую обрабатывает один воркер при загрузке словаря.
+const loadBatchSize = 4096
+
+type loadBatch struct {
+	seq   uint64
+	words []string
+}
+
+// Load добавляет в словарь слова из r, по одному на строку. Ключи анаграмм
+// вычисляются параллельно, порядок появления слов сохраняется.
+func (idx *AnagramIndex) Load(r io.Reader) error {
+	batches := make(chan loadBatch)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			keys := make([]string, 0, loadBatchSize)
+			for batch := range batches {
+				keys = keys[:0]
+				for i, word := range batch.words {
+					batch.words[i] = strings.ToLower(word)
+					keys = append(keys, idx.opts.key(word))
+				}
+
+				idx.mu.Lock()
+				for i, word := range batch.words {
+					idx.insert(word, keys[i], batch.seq+uint64(i))
+				}
+				idx.mu.Unlock()
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(r)
+	words := make([]string, 0, loadBatchSize)
+	flush := func() {
+		if len(words) == 0 {
+			return
+		}
+		batches <- loadBatch{seq: idx.nextSeq(len(words)), words: words}
+		words = make([]string, 0, loadBatchSize)
+	}
+
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" {
+			continue
+		}
+
+		words = append(words, word)
+		if len(words) == loadBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	close(batches)
+	wg.Wait()
+
+	return scanner.Err()
+}
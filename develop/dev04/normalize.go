@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Форма нормализации Unicode для ключей анаграмм.
+const (
+	noNormalization = iota
+	nfc
+	nfd
+)
+
+// keyOptions задает, как слово приводится к ключу анаграммы. В множествах
+// анаграмм слова остаются в исходном написании (в нижнем регистре), опции
+// влияют только на то, какие слова считаются анаграммами друг друга.
+type keyOptions struct {
+	// form - nfc или nfd: составной и разложенный "й" дают один ключ.
+	form int
+	// foldYo - считать "ё" и "е" одной буквой.
+	foldYo bool
+	// lettersOnly - не учитывать дефисы, пробелы, знаки препинания и цифры.
+	lettersOnly bool
+}
+
+var yoReplacer = strings.NewReplacer("ё", "е")
+
+// normalize приводит слово к виду, из которого строится ключ анаграммы.
+func (opts keyOptions) normalize(word string) string {
+	word = strings.ToLower(word)
+
+	if opts.foldYo {
+		// Разложенная "ё" - это "е" с диакритикой, поэтому сначала собираем ее.
+		word = yoReplacer.Replace(norm.NFC.String(word))
+	}
+
+	switch opts.form {
+	case nfc:
+		word = norm.NFC.String(word)
+	case nfd:
+		word = norm.NFD.String(word)
+	}
+
+	if opts.lettersOnly {
+		// Диакритические знаки оставляем, иначе в NFD "й" превратится в "и".
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsMark(r) {
+				return r
+			}
+			return -1
+		}, word)
+	}
+
+	return word
+}
+
+func (opts keyOptions) key(word string) string {
+	return sortChars(opts.normalize(word))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Руна, обозначающая пустую фишку: подходит вместо любой буквы.
+const blankTile = '?'
+
+// keyNode - узел префиксного дерева по ключам анаграмм. Ключ - это отсортированные
+// руны слова, поэтому путь от корня до узла однозначно задает количество
+// каждой буквы, и поиск слов из набора букв обходит только подходящие ветви, а
+// не весь словарь.
+type keyNode struct {
+	children map[rune]*keyNode
+	// Ключ анаграммы, если на этом узле заканчивается какое-то множество.
+	key string
+}
+
+func newKeyNode() *keyNode {
+	return &keyNode{children: make(map[rune]*keyNode)}
+}
+
+func (n *keyNode) add(key string) {
+	node := n
+	for _, r := range key {
+		child, ok := node.children[r]
+		if !ok {
+			child = newKeyNode()
+			node.children[r] = child
+		}
+		node = child
+	}
+	node.key = key
+}
+
+// remove удаляет ключ и возвращает true, если узел опустел и его можно удалить
+// из родителя.
+func (n *keyNode) remove(key string) bool {
+	if key == "" {
+		n.key = ""
+	} else {
+		r, size := utf8.DecodeRuneInString(key)
+		if child, ok := n.children[r]; ok && child.remove(key[size:]) {
+			delete(n.children, r)
+		}
+	}
+
+	return n.key == "" && len(n.children) == 0
+}
+
+type tileQuery struct {
+	counts map[rune]int
+	blanks int
+	// exact - нужно использовать все фишки, иначе подходит любое подмножество.
+	exact bool
+	keys  []string
+}
+
+func newTileQuery(letters string, exact bool, opts keyOptions) *tileQuery {
+	q := &tileQuery{counts: make(map[rune]int), exact: exact}
+	q.blanks = strings.Count(letters, string(blankTile))
+	for _, r := range opts.normalize(strings.ReplaceAll(letters, string(blankTile), "")) {
+		q.counts[r]++
+	}
+	return q
+}
+
+// unusedBefore сообщает, осталась ли неиспользованная буква меньше r. Ключи
+// отсортированы, поэтому после r такие буквы использовать уже не получится.
+func (q *tileQuery) unusedBefore(r rune) bool {
+	for letter, count := range q.counts {
+		if count > 0 && letter < r {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *tileQuery) remaining() int {
+	n := q.blanks
+	for _, count := range q.counts {
+		n += count
+	}
+	return n
+}
+
+func (q *tileQuery) walk(node *keyNode) {
+	if node.key != "" && (!q.exact || q.remaining() == 0) {
+		q.keys = append(q.keys, node.key)
+	}
+
+	for r, child := range node.children {
+		if q.exact && q.unusedBefore(r) {
+			continue
+		}
+
+		// Если есть сама буква, тратить на нее пустую фишку невыгодно: пустая
+		// фишка может заменить любую букву дальше.
+		if q.counts[r] > 0 {
+			q.counts[r]--
+			q.walk(child)
+			q.counts[r]++
+		} else if q.blanks > 0 {
+			q.blanks--
+			q.walk(child)
+			q.blanks++
+		}
+	}
+}
+
+func (idx *AnagramIndex) search(letters string, exact bool) []string {
+	q := newTileQuery(letters, exact, idx.opts)
+
+	idx.mu.RLock()
+	q.walk(idx.keys)
+	res := []string{}
+	for _, key := range q.keys {
+		for word := range idx.groups[key].words {
+			res = append(res, word)
+		}
+	}
+	idx.mu.RUnlock()
+
+	// Сначала длинные слова, слова одной длины - по алфавиту.
+	sort.Slice(res, func(i, j int) bool {
+		li, lj := utf8.RuneCountInString(res[i]), utf8.RuneCountInString(res[j])
+		if li != lj {
+			return li > lj
+		}
+		return res[i] < res[j]
+	})
+
+	return res
+}
+
+// SubAnagrams возвращает все слова словаря, которые можно составить из букв
+// letters, используя каждую не больше одного раза. Символ '?' - пустая фишка,
+// заменяющая любую букву.
+func (idx *AnagramIndex) SubAnagrams(letters string) []string {
+	return idx.search(letters, false)
+}
+
+// Match возвращает все слова словаря, составленные ровно из букв pattern, где
+// '?' заменяет любую букву. Например, "пят?к" находит "пятак" и "тяпка".
+func (idx *AnagramIndex) Match(pattern string) []string {
+	return idx.search(pattern, true)
+}
@@ -24,56 +24,38 @@ package main
 import (
 	"fmt"
 	"sort"
-	"strings"
 )
 
 func sortChars(s string) string {
 	rs := []rune(s)
+	// Слова обычно короткие, для них сортировка вставками быстрее sort.Slice.
+	if len(rs) <= 32 {
+		for i := 1; i < len(rs); i++ {
+			for j := i; j > 0 && rs[j] < rs[j-1]; j-- {
+				rs[j], rs[j-1] = rs[j-1], rs[j]
+			}
+		}
+		return string(rs)
+	}
+
 	sort.Slice(rs, func(i int, j int) bool { return rs[i] < rs[j] })
 	return string(rs)
 }
 
 func getAnagrams(words []string) map[string][]string {
+	return getAnagramsWith(words, keyOptions{})
+}
+
+// getAnagramsWith группирует слова по ключам, построенным с учетом opts.
+// Например, с foldYo "ёлка" и "елка" попадут в одно множество.
+func getAnagramsWith(words []string, opts keyOptions) map[string][]string {
 	if len(words) < 2 {
 		return make(map[string][]string)
 	}
 
-	// Коллекция анаграмм вида: ключ анаграммы -> множество слов.
-	// Пример: акптя -> {пятак, тяпка}
-	anagrams := make(map[string]map[string]struct{})
-	// Маппинг ключа анаграммы на первое подходящее слово.
-	mapping := make(map[string]string)
-
-	for _, word := range words {
-		word = strings.ToLower(word)
-		key := sortChars(word)
-		if _, ok := mapping[key]; !ok {
-			mapping[key] = word
-		}
-
-		if _, ok := anagrams[key]; !ok {
-			anagrams[key] = make(map[string]struct{})
-		}
-
-		anagrams[key][word] = struct{}{}
-	}
-
-	res := make(map[string][]string)
-	for key, firstEncounteredWord := range mapping {
-		if len(anagrams[key]) == 1 {
-			continue
-		}
-
-		sequence := make([]string, 0, len(anagrams[key]))
-		for word := range anagrams[key] {
-			sequence = append(sequence, word)
-		}
-
-		sort.Strings(sequence)
-		res[firstEncounteredWord] = sequence
-	}
-
-	return res
+	idx := NewAnagramIndexWith(opts)
+	idx.Add(words...)
+	return idx.Groups()
 }
 
 func main() {
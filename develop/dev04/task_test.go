@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -38,3 +42,213 @@ func TestGetAnagrams(t *testing.T) {
 		}
 	}
 }
+
+func TestAnagramIndex(t *testing.T) {
+	idx := NewAnagramIndex()
+	idx.Add("тяпка", "Пятак", "слиток", "листок", "пятка", "столик", "Столик", "анаграмма")
+
+	want := map[string][]string{
+		"слиток": {"листок", "слиток", "столик"},
+		"тяпка":  {"пятак", "пятка", "тяпка"},
+	}
+	if got := idx.Groups(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() == %v; want %v", got, want)
+	}
+
+	if got := idx.Lookup("Катяп"); !reflect.DeepEqual(got, []string{"пятак", "пятка", "тяпка"}) {
+		t.Errorf("Lookup(Катяп) == %v", got)
+	}
+
+	if got := idx.Lookup("слово"); !reflect.DeepEqual(got, []string{}) {
+		t.Errorf("Lookup(слово) == %v", got)
+	}
+
+	if !idx.Remove("ТЯПКА") || idx.Remove("тяпка") || idx.Remove("слово") {
+		t.Error("Remove returned unexpected result")
+	}
+
+	idx.Remove("листок")
+	idx.Remove("столик")
+	idx.Add("тяпка")
+
+	// После удаления первого слова ключом становится следующее по порядку,
+	// а повторно добавленное слово попадает в конец.
+	want = map[string][]string{
+		"пятак": {"пятак", "пятка", "тяпка"},
+	}
+	if got := idx.Groups(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() == %v; want %v", got, want)
+	}
+}
+
+func TestAnagramIndexLoad(t *testing.T) {
+	// Слова-заполнители с уникальным набором букв.
+	words := []string{}
+	for i := 0; i < 3*loadBatchSize; i++ {
+		words = append(words, "х"+string(rune(0x4E00+i)))
+	}
+	words = append(words, "тяпка", "Пятак", "пятка")
+	// Анаграмма первого слова в самом конце словаря, в другой пачке.
+	words = append(words, "\u4E00х")
+
+	idx := NewAnagramIndex()
+	if err := idx.Load(strings.NewReader(strings.Join(words, "\n"))); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"х\u4E00": {"х\u4E00", "\u4E00х"},
+		"тяпка":   {"пятак", "пятка", "тяпка"},
+	}
+	if got := idx.Groups(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() == %v; want %v", got, want)
+	}
+}
+
+func TestAnagramIndexConcurrent(t *testing.T) {
+	idx := NewAnagramIndex()
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				idx.Add("пятак", "тяпка")
+				idx.Lookup("пятка")
+				idx.Groups()
+				idx.Remove("тяпка")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := idx.Lookup("пятак"); !reflect.DeepEqual(got, []string{"пятак"}) {
+		t.Errorf("Lookup(пятак) == %v", got)
+	}
+}
+
+func BenchmarkAnagramIndexLoad(b *testing.B) {
+	buf := &bytes.Buffer{}
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(buf, "слово%d\n", i)
+	}
+	data := buf.Bytes()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx := NewAnagramIndex()
+		if err := idx.Load(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAnagramIndexSearch(t *testing.T) {
+	idx := NewAnagramIndex()
+	idx.Add("тяпка", "пятак", "пятка", "пята", "тяп", "як", "кап", "кот", "столик", "а")
+
+	cases := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"SubAnagrams(пятак)", idx.SubAnagrams("пятак"), []string{"пятак", "пятка", "тяпка", "пята", "кап", "тяп", "як", "а"}},
+		{"SubAnagrams(ятп)", idx.SubAnagrams("ятп"), []string{"тяп"}},
+		{"SubAnagrams(от?)", idx.SubAnagrams("от?"), []string{"кот", "а"}},
+		{"SubAnagrams(??)", idx.SubAnagrams("??"), []string{"як", "а"}},
+		{"SubAnagrams()", idx.SubAnagrams(""), []string{}},
+		{"Match(пят?к)", idx.Match("пят?к"), []string{"пятак", "пятка", "тяпка"}},
+		{"Match(П?Т?)", idx.Match("П?Т?"), []string{"пята"}},
+		{"Match(к??)", idx.Match("к??"), []string{"кап", "кот"}},
+		{"Match(пятак?)", idx.Match("пятак?"), []string{}},
+	}
+
+	for _, c := range cases {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s == %v; want %v", c.name, c.got, c.want)
+		}
+	}
+
+	idx.Remove("кот")
+	idx.Remove("як")
+	if got := idx.SubAnagrams("от?"); !reflect.DeepEqual(got, []string{"а"}) {
+		t.Errorf("SubAnagrams(от?) after Remove == %v", got)
+	}
+	if got := idx.keys.children['к']; got != nil {
+		t.Errorf("key trie still contains removed keys: %v", got.children)
+	}
+}
+
+func TestGetAnagramsWith(t *testing.T) {
+	// "й" в разложенной форме: "и" и комбинируемая краткая.
+	const decomposedShort = "й"
+
+	cases := []struct {
+		in   []string
+		opts keyOptions
+		want map[string][]string
+	}{
+		{
+			in:   []string{"ёлка", "лека", "Елка"},
+			opts: keyOptions{},
+			want: map[string][]string{
+				"лека": {"елка", "лека"},
+			},
+		},
+		{
+			in:   []string{"ёлка", "лека", "Елка"},
+			opts: keyOptions{foldYo: true},
+			want: map[string][]string{
+				"ёлка": {"елка", "лека", "ёлка"},
+			},
+		},
+		{
+			in:   []string{"йод", "до" + decomposedShort},
+			opts: keyOptions{},
+			want: map[string][]string{},
+		},
+		{
+			in:   []string{"йод", "до" + decomposedShort},
+			opts: keyOptions{form: nfc},
+			want: map[string][]string{
+				"йод": {"до" + decomposedShort, "йод"},
+			},
+		},
+		{
+			in:   []string{"йод", "до" + decomposedShort, "дои"},
+			opts: keyOptions{form: nfd, lettersOnly: true},
+			want: map[string][]string{
+				"йод": {"до" + decomposedShort, "йод"},
+			},
+		},
+		{
+			in:   []string{"кто-то", "тоткО", "кот, ток!", "кот ток"},
+			opts: keyOptions{lettersOnly: true},
+			want: map[string][]string{
+				"кто-то":    {"кто-то", "тотко"},
+				"кот, ток!": {"кот ток", "кот, ток!"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got := getAnagramsWith(c.in, c.opts)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("getAnagramsWith(%q, %+v) \n\t  == %q; \n\twant %q", c.in, c.opts, got, c.want)
+		}
+	}
+
+	idx := NewAnagramIndexWith(keyOptions{foldYo: true, lettersOnly: true})
+	idx.Add("ёлка", "ель")
+	if got := idx.Lookup("ЕЛКА!"); !reflect.DeepEqual(got, []string{"ёлка"}) {
+		t.Errorf("Lookup(ЕЛКА!) == %v", got)
+	}
+	if got := idx.Match("л?ё"); !reflect.DeepEqual(got, []string{"ель"}) {
+		t.Errorf("Match(л?ё) == %v", got)
+	}
+	if !idx.Remove("ёлка") || idx.Remove("елка") {
+		t.Error("Remove must use the original spelling")
+	}
+}
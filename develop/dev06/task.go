@@ -10,20 +10,29 @@ package main
 -d - "delimiter" - использовать другой разделитель
 -s - "separated" - только строки с разделителем
 
+Дополнительно:
+--widths  - разбить строки фиксированной ширины на колонки заданной ширины (5,10,8 или id:5,name:10)
+--columns - разбить строки фиксированной ширины на колонки по позициям (1-5,6-15 или id:1-5,name:6-)
+
 Программа должна проходить все тесты. Код должен проходить проверки go vet и golint.
 */
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf8"
+
+	"golang.org/x/text/width"
 )
 
 func main() {
@@ -40,13 +49,26 @@ type fieldRange struct {
 	end   uint64
 }
 
+// column - колонка строки фиксированной ширины. Границы задаются в позициях
+// отображения (начиная с 1, включительно), end == math.MaxUint64 означает
+// "до конца строки".
+type column struct {
+	name  string
+	start uint64
+	end   uint64
+}
+
 type options struct {
 	fields      string
 	delimiter   string
 	separated   bool
+	widths      string
+	columns     string
 	args        []string
-	fieldSet    map[uint64]bool
 	fieldRanges []fieldRange
+	fixedCols   []column
+	colNames    map[string]uint64
+	delim       []byte
 }
 
 func (opts *options) parseFlags(args []string) {
@@ -54,6 +76,8 @@ func (opts *options) parseFlags(args []string) {
 	flagset.StringVar(&opts.fields, "f", "", "select  only  these fields")
 	flagset.StringVar(&opts.delimiter, "d", "\t", "use specified string instead of TAB for field delimiter")
 	flagset.BoolVar(&opts.separated, "s", false, "do not print lines not containing delimiters")
+	flagset.StringVar(&opts.widths, "widths", "", "split fixed-width lines into columns of these display widths")
+	flagset.StringVar(&opts.columns, "columns", "", "split fixed-width lines into columns at these display positions")
 	flagset.Parse(args[1:])
 
 	opts.args = flagset.Args()
@@ -61,6 +85,7 @@ func (opts *options) parseFlags(args []string) {
 
 var ErrInvalidDelimiter = errors.New("the delimiter must be a single character")
 var ErrFieldsListRequired = errors.New("you must specify a list of fields")
+var ErrWidthsAndColumns = errors.New("only one of --widths and --columns may be specified")
 
 func (opts *options) validate() error {
 	if utf8.RuneCountInString(opts.delimiter) > 1 {
@@ -71,16 +96,26 @@ func (opts *options) validate() error {
 		return ErrFieldsListRequired
 	}
 
+	if opts.widths != "" && opts.columns != "" {
+		return ErrWidthsAndColumns
+	}
+
 	return nil
 }
 
 func (opts *options) complete() error {
-	opts.fieldSet = make(map[uint64]bool)
+	opts.colNames = make(map[string]uint64)
+	opts.delim = []byte(opts.delimiter)
+
+	if err := parseFixedColumns(opts); err != nil {
+		return err
+	}
 
 	if err := parseFields(opts); err != nil {
 		return err
 	}
 
+	opts.fieldRanges = mergeRanges(opts.fieldRanges)
 	return nil
 }
 
@@ -89,6 +124,87 @@ var ErrFieldTooLarge = errors.New("field number is too large")
 var ErrInvalidFieldValue = errors.New("invalid field value")
 var ErrInvalidRange = errors.New("invalid field range")
 var ErrDecreasingRange = errors.New("invalid decreasing range")
+var ErrInvalidWidth = errors.New("invalid column width")
+var ErrInvalidColumnName = errors.New("invalid column name")
+var ErrDuplicateColumnName = errors.New("duplicate column name")
+var ErrUnknownColumnName = errors.New("unknown column name")
+
+// parseFixedColumns разбирает --widths или --columns в список колонок.
+// Каждый элемент списка может иметь имя в виде "имя:значение", по которому
+// колонку затем можно выбрать через -f.
+func parseFixedColumns(opts *options) error {
+	list := opts.widths
+	if list == "" {
+		list = opts.columns
+	}
+
+	if list == "" {
+		return nil
+	}
+
+	pos := uint64(1)
+	for i, item := range strings.Split(list, ",") {
+		name, value, named := strings.Cut(item, ":")
+		if !named {
+			value, name = name, ""
+		}
+
+		if named && !isColumnName(name) {
+			return ErrInvalidColumnName
+		}
+
+		col := column{name: name}
+		if opts.widths != "" {
+			w, err := parseNum(value)
+			if err != nil {
+				return ErrInvalidWidth
+			}
+
+			col.start, col.end = pos, pos+w-1
+			pos += w
+		} else {
+			if !strings.ContainsRune(value, '-') {
+				num, err := parseNum(value)
+				if err != nil {
+					return err
+				}
+				col.start, col.end = num, num
+			} else {
+				start, end, err := parseRange(value, opts)
+				if err != nil {
+					return err
+				}
+				col.start, col.end = start, end
+			}
+		}
+
+		if name != "" {
+			if _, ok := opts.colNames[name]; ok {
+				return ErrDuplicateColumnName
+			}
+			opts.colNames[name] = uint64(i + 1)
+		}
+
+		opts.fixedCols = append(opts.fixedCols, col)
+	}
+
+	return nil
+}
+
+func isColumnName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, r := range name {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			continue
+		}
+		return false
+	}
+
+	return true
+}
 
 func parseFields(opts *options) error {
 	fields := strings.Split(opts.fields, ",")
@@ -99,28 +215,54 @@ func parseFields(opts *options) error {
 				return err
 			}
 
-			// Если диапазон небольшой - сохраняем его значения в сет, в противном
-			// случае добавляем диапазон в слайс.
-			if (end - start) < 1000 {
-				for i := start; i <= end; i++ {
-					opts.fieldSet[i] = true
-				}
-			} else {
-				opts.fieldRanges = append(opts.fieldRanges, fieldRange{start, end})
-			}
+			opts.fieldRanges = append(opts.fieldRanges, fieldRange{start, end})
 		} else {
+			if num, ok := opts.colNames[field]; ok {
+				opts.fieldRanges = append(opts.fieldRanges, fieldRange{num, num})
+				continue
+			}
+
 			num, err := parseNum(field)
 			if err != nil {
+				if len(opts.fixedCols) > 0 && isColumnName(field) {
+					return ErrUnknownColumnName
+				}
 				return err
 			}
 
-			opts.fieldSet[num] = true
+			opts.fieldRanges = append(opts.fieldRanges, fieldRange{num, num})
 		}
 	}
 
 	return nil
 }
 
+// mergeRanges сортирует диапазоны полей и объединяет пересекающиеся и
+// соседние, чтобы при обработке строки хватало одного прохода по ним.
+func mergeRanges(ranges []fieldRange) []fieldRange {
+	if len(ranges) == 0 {
+		return ranges
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		// last.end+1 не переполняется: номер поля не может быть math.MaxUint64,
+		// а открытый диапазон уже поглощает все последующие.
+		if last.end == math.MaxUint64 || r.start <= last.end+1 {
+			if r.end > last.end {
+				last.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
 func parseRange(field string, opts *options) (uint64, uint64, error) {
 	before, after, _ := strings.Cut(field, "-")
 	if before == "" && after == "" {
@@ -222,30 +364,129 @@ func do(in io.Reader, out *bufio.Writer, args []string, opts *options) error {
 }
 
 func doCut(files []io.Reader, out *bufio.Writer, opts *options) error {
+	if len(opts.fixedCols) > 0 {
+		return doCutFixed(files, out, opts)
+	}
+
 	for _, file := range files {
 		scanner := bufio.NewScanner(file)
 
 		for scanner.Scan() {
-			line := scanner.Text()
+			if err := cutLine(scanner.Bytes(), out, opts); err != nil {
+				return err
+			}
+		}
 
-			if opts.delimiter == "" {
-				if err := writeLine(line, out); err != nil {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// cutLine выводит выбранные поля строки. Строка разбивается лениво, только до
+// последнего нужного поля, а поля пишутся прямо в out, без промежуточных
+// аллокаций.
+func cutLine(line []byte, out *bufio.Writer, opts *options) error {
+	delim := opts.delim
+
+	if len(delim) == 0 || bytes.Index(line, delim) < 0 {
+		if opts.separated && len(delim) != 0 {
+			return nil
+		}
+		return writeLine(line, out)
+	}
+
+	ranges := opts.fieldRanges
+	field := uint64(1)
+	first := true
+
+	for len(ranges) > 0 {
+		// Открытый диапазон: остаток строки выводится целиком.
+		if field >= ranges[0].start && ranges[0].end == math.MaxUint64 {
+			if !first {
+				if _, err := out.Write(delim); err != nil {
 					return err
 				}
-				continue
 			}
+			if _, err := out.Write(line); err != nil {
+				return err
+			}
+			break
+		}
 
-			parts := strings.Split(line, opts.delimiter)
+		end := bytes.Index(line, delim)
+		part := line
+		if end >= 0 {
+			part = line[:end]
+		}
 
-			if opts.separated && len(parts) == 1 {
-				continue
+		if field >= ranges[0].start {
+			if !first {
+				if _, err := out.Write(delim); err != nil {
+					return err
+				}
+			}
+			if _, err := out.Write(part); err != nil {
+				return err
 			}
+			first = false
+		}
 
-			if len(parts) == 1 {
-				if err := writeLine(line, out); err != nil {
-					return err
+		if field == ranges[0].end {
+			ranges = ranges[1:]
+		}
+
+		if end < 0 {
+			break
+		}
+
+		line = line[end+len(delim):]
+		field++
+	}
+
+	return out.WriteByte('\n')
+}
+
+// doCutFixed режет строки фиксированной ширины на колонки и выводит выбранные
+// из них так же, как поля строк с разделителем.
+func doCutFixed(files []io.Reader, out *bufio.Writer, opts *options) error {
+	parts := make([]string, len(opts.fixedCols))
+	positions := make([]uint64, 0)
+	offsets := make([]int, 0)
+
+	for _, file := range files {
+		scanner := bufio.NewScanner(file)
+
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			// Позиция отображения и байтовое смещение начала каждой руны, плюс
+			// конец строки.
+			positions = positions[:0]
+			offsets = offsets[:0]
+			pos := uint64(1)
+			for i, r := range line {
+				positions = append(positions, pos)
+				offsets = append(offsets, i)
+				pos += uint64(runeWidth(r))
+			}
+			positions = append(positions, pos)
+			offsets = append(offsets, len(line))
+
+			// Руна относится к той колонке, в которой она начинается.
+			for i, col := range opts.fixedCols {
+				from := sort.Search(len(positions)-1, func(j int) bool { return positions[j] >= col.start })
+				to := sort.Search(len(positions)-1, func(j int) bool { return positions[j] > col.end })
+				if to < from {
+					to = from
 				}
-				continue
+				parts[i] = strings.TrimSpace(line[offsets[from]:offsets[to]])
 			}
 
 			if err := writeParts(parts, out, opts); err != nil {
@@ -265,45 +506,55 @@ func doCut(files []io.Reader, out *bufio.Writer, opts *options) error {
 	return nil
 }
 
-func writeLine(line string, out *bufio.Writer) error {
-	if _, err := out.WriteString(line); err != nil {
-		return err
+// runeWidth возвращает ширину руны при отображении в терминале: 2 для широких
+// восточноазиатских символов, 0 для комбинируемых и форматирующих символов.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
 	}
 
-	if _, err := out.WriteRune('\n'); err != nil {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+
+	return 1
+}
+
+func writeLine(line []byte, out *bufio.Writer) error {
+	if _, err := out.Write(line); err != nil {
 		return err
 	}
 
-	return nil
+	return out.WriteByte('\n')
 }
 
+// writeParts выводит выбранные поля из уже разбитой строки.
 func writeParts(parts []string, out *bufio.Writer, opts *options) error {
-	matchedParts := make([]string, 0)
-
-	for i := uint64(0); i < uint64(len(parts)); i++ {
-		field := i + 1
-		matched := false
+	first := true
 
-		if opts.fieldSet[field] {
-			matched = true
+	for _, r := range opts.fieldRanges {
+		if r.start > uint64(len(parts)) {
+			break
 		}
 
-		for _, r := range opts.fieldRanges {
-			if field >= r.start && field <= r.end {
-				matched = true
-				break
-			}
+		end := r.end
+		if end > uint64(len(parts)) {
+			end = uint64(len(parts))
 		}
 
-		if matched {
-			matchedParts = append(matchedParts, parts[i])
+		for _, part := range parts[r.start-1 : end] {
+			if !first {
+				if _, err := out.WriteString(opts.delimiter); err != nil {
+					return err
+				}
+			}
+			if _, err := out.WriteString(part); err != nil {
+				return err
+			}
+			first = false
 		}
 	}
 
-	line := strings.Join(matchedParts, opts.delimiter)
-	if err := writeLine(line, out); err != nil {
-		return err
-	}
-
-	return nil
+	return out.WriteByte('\n')
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"io"
 	"os"
 	"strings"
 	"testing"
@@ -143,6 +144,48 @@ func TestCut(t *testing.T) {
 		}
 	})
 
+	args = []string{"test-cut", "--widths=id:5,name:10,amount:8", "-f", "amount,id", "testdata/fixeddata.txt"}
+	t.Run(strings.Join(args, " "), func(t *testing.T) {
+		opts := new(options)
+		buf := &bytes.Buffer{}
+		writer := bufio.NewWriter(buf)
+		if err := do(os.Stdin, writer, args, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		filename := "testdata/" + strings.ReplaceAll(strings.Join(args, "_"), "/", ".")
+		expected, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual := buf.Bytes()
+		if !bytes.Equal(expected, actual) {
+			t.Fatal("Not equal")
+		}
+	})
+
+	args = []string{"test-cut", "--columns=1-5,6-15,16-", "-f", "2-", "-d", ";", "testdata/fixeddata.txt"}
+	t.Run(strings.Join(args, " "), func(t *testing.T) {
+		opts := new(options)
+		buf := &bytes.Buffer{}
+		writer := bufio.NewWriter(buf)
+		if err := do(os.Stdin, writer, args, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		filename := "testdata/" + strings.ReplaceAll(strings.Join(args, "_"), "/", ".")
+		expected, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual := buf.Bytes()
+		if !bytes.Equal(expected, actual) {
+			t.Fatal("Not equal")
+		}
+	})
+
 	args = []string{"test-cut", "-f", "2,3", "testdata/empty.txt"}
 	t.Run(strings.Join(args, " "), func(t *testing.T) {
 		opts := new(options)
@@ -210,4 +253,90 @@ func TestCutErrors(t *testing.T) {
 			t.Fatal("Not equal")
 		}
 	})
+
+	args = []string{"test-cut", "-f", "1", "--widths=5", "--columns=1-5"}
+	t.Run(strings.Join(args, " "), func(t *testing.T) {
+		opts := new(options)
+		writer := bufio.NewWriter(os.Stdout)
+		err := do(os.Stdin, writer, args, opts)
+		if err != ErrWidthsAndColumns {
+			t.Fatal("Not equal")
+		}
+	})
+
+	args = []string{"test-cut", "-f", "1", "--widths=5,0"}
+	t.Run(strings.Join(args, " "), func(t *testing.T) {
+		opts := new(options)
+		writer := bufio.NewWriter(os.Stdout)
+		err := do(os.Stdin, writer, args, opts)
+		if err != ErrInvalidWidth {
+			t.Fatal("Not equal")
+		}
+	})
+
+	args = []string{"test-cut", "-f", "name", "--widths=id:5,amount:8"}
+	t.Run(strings.Join(args, " "), func(t *testing.T) {
+		opts := new(options)
+		writer := bufio.NewWriter(os.Stdout)
+		err := do(os.Stdin, writer, args, opts)
+		if err != ErrUnknownColumnName {
+			t.Fatal("Not equal")
+		}
+	})
+}
+
+func TestCutLineAllocs(t *testing.T) {
+	opts := new(options)
+	opts.parseFlags([]string{"test-cut", "-f", "2,4-6,9-"})
+	if err := opts.complete(); err != nil {
+		t.Fatal(err)
+	}
+
+	line := []byte("a\tb\tc\td\te\tf\tg\th\ti\tj")
+	writer := bufio.NewWriter(io.Discard)
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := cutLine(line, writer, opts); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Fatalf("cutLine allocates %v times per line; want 0", allocs)
+	}
+}
+
+func BenchmarkCutLine(b *testing.B) {
+	opts := new(options)
+	opts.parseFlags([]string{"test-cut", "-f", "2,4-6"})
+	if err := opts.complete(); err != nil {
+		b.Fatal(err)
+	}
+
+	line := []byte(strings.Repeat("field\t", 100))
+	writer := bufio.NewWriter(io.Discard)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cutLine(line, writer, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCut(b *testing.B) {
+	data := bytes.Repeat([]byte("5\t9\t3.5\t44\t9\t17\t2\taaa\tbbb\t4\n"), 10000)
+	args := []string{"test-cut", "-f", "1,3-4,7-"}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		opts := new(options)
+		writer := bufio.NewWriter(io.Discard)
+		if err := do(bytes.NewReader(data), writer, args, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,103 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidAlias = errors.New("invalid alias name")
+var ErrNotFound = errors.New("not found")
+var ErrUnaliasUsage = errors.New("usage: unalias [-a] name [name ...]")
+
+// parse разбирает строку с псевдонимами шелла.
+func (opts *options) parse(src string) (*listNode, error) {
+	return parseAliases(src, opts.aliases)
+}
+
+// isAliasName сообщает, может ли слово быть именем псевдонима: в нем нет
+// кавычек, "/", "$", "=" и метасимволов.
+func isAliasName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if isMetaChar(name[i]) || strings.IndexByte("'\"\\`$/=", name[i]) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// singleQuote заключает значение в одинарные кавычки так, чтобы шелл
+// прочитал его как одно слово: вывод alias и трассировку можно выполнить
+// заново.
+func singleQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// alias задает псевдонимы "name=value" или выводит их: все, если аргументов
+// нет, и перечисленные по имени.
+func alias(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	if len(args) > 0 && args[0] == "-p" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		names := make([]string, 0, len(opts.aliases))
+		for name := range opts.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		args = names
+	}
+
+	status := Status{code: 0}
+	for _, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			if !isAliasName(name) {
+				status = cmd.report(Status{code: 1, err: fmt.Errorf("alias: `%s': %w", name, ErrInvalidAlias)})
+				continue
+			}
+			opts.aliases[name] = value
+			continue
+		}
+
+		value, ok := opts.aliases[arg]
+		if !ok {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("alias: %s: %w", arg, ErrNotFound)})
+			continue
+		}
+		if _, pErr := fmt.Fprintf(cmd.stdout, "alias %s=%s\n", arg, singleQuote(value)); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+	}
+	return status
+}
+
+// unalias удаляет псевдонимы, а с -a - все псевдонимы.
+func unalias(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	if len(args) > 0 && args[0] == "-a" {
+		opts.aliases = map[string]string{}
+		return Status{code: 0}
+	}
+
+	if len(args) == 0 {
+		return Status{code: 2, err: fmt.Errorf("unalias: %w", ErrUnaliasUsage)}
+	}
+
+	status := Status{code: 0}
+	for _, name := range args {
+		if _, ok := opts.aliases[name]; !ok {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("unalias: %s: %w", name, ErrNotFound)})
+			continue
+		}
+		delete(opts.aliases, name)
+	}
+	return status
+}
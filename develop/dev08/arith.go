@@ -0,0 +1,525 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrArithSyntax = errors.New("syntax error in expression")
+var ErrDivisionByZero = errors.New("division by 0")
+var ErrNegativeExponent = errors.New("exponent less than 0")
+var ErrArithRecursion = errors.New("expression recursion level exceeded")
+
+// Операторы арифметики в порядке убывания длины, чтобы находилось самое
+// длинное совпадение.
+var arithOperators = []string{
+	"<<=", ">>=",
+	"**", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "<", ">", "=", "!", "~", "&", "^", "|",
+	"?", ":", "(", ")", ",",
+}
+
+// Бинарные операторы по уровням приоритета, от низшего к высшему.
+var arithLevels = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// Глубина, на которой прекращается раскрытие переменных, ссылающихся друг на
+// друга.
+const maxArithDepth = 64
+
+// arith вычисляет целочисленное выражение $((...)) как bash: 64-битные
+// целые, операторы C, переменные по имени без "$".
+type arith struct {
+	opts  *options
+	expr  string
+	pos   int
+	depth int
+	// noeval > 0 - выражение разбирается, но не вычисляется: правая часть
+	// "&&" и "||" и невыбранная ветка "?:". Присваивания и деление на ноль в
+	// нем не выполняются.
+	noeval int
+}
+
+// evalArith вычисляет арифметическое выражение, в котором уже раскрыты
+// подстановки.
+func (opts *options) evalArith(expr string) (int64, error) {
+	return (&arith{opts: opts}).eval(expr)
+}
+
+func (a *arith) eval(expr string) (int64, error) {
+	if strings.TrimSpace(expr) == "" {
+		return 0, nil
+	}
+
+	saved, savedPos := a.expr, a.pos
+	a.expr, a.pos = expr, 0
+	defer func() { a.expr, a.pos = saved, savedPos }()
+
+	v, err := a.comma()
+	if err != nil {
+		return 0, err
+	}
+
+	a.skipSpaces()
+	if a.pos < len(a.expr) {
+		return 0, a.syntaxError()
+	}
+	return v, nil
+}
+
+func (a *arith) syntaxError() error {
+	token := strings.TrimSpace(a.expr[a.pos:])
+	return fmt.Errorf("%s: %w (error token is \"%s\")", strings.TrimSpace(a.expr), ErrArithSyntax, token)
+}
+
+func (a *arith) skipSpaces() {
+	for a.pos < len(a.expr) && strings.IndexByte(" \t\n", a.expr[a.pos]) >= 0 {
+		a.pos++
+	}
+}
+
+// peek возвращает оператор в текущей позиции или "".
+func (a *arith) peek() string {
+	a.skipSpaces()
+	for _, op := range arithOperators {
+		if strings.HasPrefix(a.expr[a.pos:], op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func (a *arith) accept(op string) bool {
+	if a.peek() == op {
+		a.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func (a *arith) expect(op string) error {
+	if !a.accept(op) {
+		return a.syntaxError()
+	}
+	return nil
+}
+
+func (a *arith) comma() (int64, error) {
+	v, err := a.assign()
+	for err == nil && a.accept(",") {
+		v, err = a.assign()
+	}
+	return v, err
+}
+
+func (a *arith) assign() (int64, error) {
+	start := a.pos
+	name := a.ident()
+	if name != "" {
+		op := a.peek()
+		if op == "=" || (len(op) >= 2 && strings.HasSuffix(op, "=") && op != "==" && op != "!=" && op != "<=" && op != ">=") {
+			a.pos += len(op)
+			rhs, err := a.assign()
+			if err != nil {
+				return 0, err
+			}
+
+			v := rhs
+			if op != "=" {
+				cur, err := a.variable(name)
+				if err != nil {
+					return 0, err
+				}
+				if v, err = a.binary(strings.TrimSuffix(op, "="), cur, rhs); err != nil {
+					return 0, err
+				}
+			}
+			return v, a.set(name, v)
+		}
+	}
+
+	a.pos = start
+	return a.ternary()
+}
+
+func (a *arith) ternary() (int64, error) {
+	cond, err := a.logical("||")
+	if err != nil || !a.accept("?") {
+		return cond, err
+	}
+
+	if cond == 0 {
+		a.noeval++
+	}
+	yes, err := a.comma()
+	if cond == 0 {
+		a.noeval--
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := a.expect(":"); err != nil {
+		return 0, err
+	}
+
+	if cond != 0 {
+		a.noeval++
+	}
+	no, err := a.ternary()
+	if cond != 0 {
+		a.noeval--
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if cond != 0 {
+		return yes, nil
+	}
+	return no, nil
+}
+
+// logical разбирает "||" или "&&" с ленивым вычислением правой части.
+func (a *arith) logical(op string) (int64, error) {
+	next := func() (int64, error) {
+		if op == "||" {
+			return a.logical("&&")
+		}
+		return a.binaryLevel(0)
+	}
+
+	left, err := next()
+	if err != nil {
+		return 0, err
+	}
+
+	for a.accept(op) {
+		// Результат уже известен: правая часть не вычисляется.
+		skip := (op == "||") == (left != 0)
+		if skip {
+			a.noeval++
+		}
+		right, err := next()
+		if skip {
+			a.noeval--
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if !skip {
+			left = right
+		}
+		left = boolToInt(left != 0)
+	}
+
+	return left, nil
+}
+
+func (a *arith) binaryLevel(level int) (int64, error) {
+	if level == len(arithLevels) {
+		return a.power()
+	}
+
+	left, err := a.binaryLevel(level + 1)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		op := a.peek()
+		found := false
+		for _, candidate := range arithLevels[level] {
+			if op == candidate {
+				found = true
+			}
+		}
+		if !found {
+			return left, nil
+		}
+
+		a.pos += len(op)
+		right, err := a.binaryLevel(level + 1)
+		if err != nil {
+			return 0, err
+		}
+
+		if left, err = a.binary(op, left, right); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (a *arith) power() (int64, error) {
+	base, err := a.unary()
+	if err != nil || !a.accept("**") {
+		return base, err
+	}
+
+	// "**" правоассоциативен.
+	exp, err := a.power()
+	if err != nil {
+		return 0, err
+	}
+	return a.binary("**", base, exp)
+}
+
+func (a *arith) unary() (int64, error) {
+	switch op := a.peek(); op {
+	case "++", "--":
+		a.pos += len(op)
+		name := a.ident()
+		if name == "" {
+			return 0, a.syntaxError()
+		}
+		v, err := a.variable(name)
+		if err != nil {
+			return 0, err
+		}
+		if op == "++" {
+			v++
+		} else {
+			v--
+		}
+		return v, a.set(name, v)
+	case "+", "-", "!", "~":
+		a.pos += len(op)
+		v, err := a.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "-":
+			v = -v
+		case "!":
+			v = boolToInt(v == 0)
+		case "~":
+			v = ^v
+		}
+		return v, nil
+	}
+
+	return a.postfix()
+}
+
+func (a *arith) postfix() (int64, error) {
+	if a.accept("(") {
+		v, err := a.comma()
+		if err != nil {
+			return 0, err
+		}
+		return v, a.expect(")")
+	}
+
+	a.skipSpaces()
+	if a.pos < len(a.expr) && isDigit(a.expr[a.pos]) {
+		return a.number()
+	}
+
+	name := a.ident()
+	if name == "" {
+		return 0, a.syntaxError()
+	}
+
+	v, err := a.variable(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if op := a.peek(); op == "++" || op == "--" {
+		a.pos += len(op)
+		next := v + 1
+		if op == "--" {
+			next = v - 1
+		}
+		return v, a.set(name, next)
+	}
+
+	return v, nil
+}
+
+// number разбирает десятичное, восьмеричное (0755), шестнадцатеричное
+// (0xff) число или число в системе base#digits (2#1010).
+func (a *arith) number() (int64, error) {
+	start := a.pos
+	for a.pos < len(a.expr) && (isDigit(a.expr[a.pos]) || isLetter(a.expr[a.pos]) || strings.IndexByte("_#@", a.expr[a.pos]) >= 0) {
+		a.pos++
+	}
+	lit := a.expr[start:a.pos]
+
+	base, digits := 10, lit
+	switch {
+	case strings.Contains(lit, "#"):
+		b, rest, _ := strings.Cut(lit, "#")
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 2 || n > 64 {
+			return 0, fmt.Errorf("%s: invalid arithmetic base", lit)
+		}
+		base, digits = n, rest
+	case strings.HasPrefix(lit, "0x") || strings.HasPrefix(lit, "0X"):
+		base, digits = 16, lit[2:]
+	case len(lit) > 1 && lit[0] == '0':
+		base, digits = 8, lit[1:]
+	}
+
+	v, ok := parseDigits(digits, base)
+	if !ok {
+		return 0, fmt.Errorf("%s: value too great for base (error token is \"%s\")", lit, lit)
+	}
+	return v, nil
+}
+
+// parseDigits разбирает число в системе с основанием до 64: цифры, затем
+// строчные буквы, заглавные буквы, "@" и "_". До основания 36 регистр букв
+// не важен.
+func parseDigits(digits string, base int) (int64, bool) {
+	if digits == "" {
+		return 0, false
+	}
+
+	var v int64
+	for i := 0; i < len(digits); i++ {
+		c := digits[i]
+		var d int
+		switch {
+		case isDigit(c):
+			d = int(c - '0')
+		case 'a' <= c && c <= 'z':
+			d = int(c-'a') + 10
+		case 'A' <= c && c <= 'Z':
+			d = int(c-'A') + 10
+			if base > 36 {
+				d += 26
+			}
+		case c == '@':
+			d = 62
+		case c == '_':
+			d = 63
+		default:
+			return 0, false
+		}
+
+		if d >= base {
+			return 0, false
+		}
+		v = v*int64(base) + int64(d)
+	}
+
+	return v, true
+}
+
+func (a *arith) ident() string {
+	a.skipSpaces()
+	start := a.pos
+	for a.pos < len(a.expr) && (a.expr[a.pos] == '_' || isLetter(a.expr[a.pos]) || (a.pos > start && isDigit(a.expr[a.pos]))) {
+		a.pos++
+	}
+	return a.expr[start:a.pos]
+}
+
+// variable возвращает значение переменной. Значение само может быть
+// выражением; пустая или неустановленная переменная равна 0.
+func (a *arith) variable(name string) (int64, error) {
+	value, ok := a.opts.getVar(name)
+	if !ok && a.noeval == 0 && a.opts.nounset {
+		return 0, fmt.Errorf("%s: %w", name, ErrUnboundVariable)
+	}
+	if a.noeval > 0 || strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+
+	if a.depth >= maxArithDepth {
+		return 0, fmt.Errorf("%s: %w", name, ErrArithRecursion)
+	}
+
+	a.depth++
+	defer func() { a.depth-- }()
+	return a.eval(value)
+}
+
+func (a *arith) set(name string, v int64) error {
+	if a.noeval > 0 {
+		return nil
+	}
+	return a.opts.setVar(name, strconv.FormatInt(v, 10))
+}
+
+func (a *arith) binary(op string, x int64, y int64) (int64, error) {
+	if a.noeval > 0 {
+		return 0, nil
+	}
+
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return 0, fmt.Errorf("%s: %w", strings.TrimSpace(a.expr), ErrDivisionByZero)
+		}
+		if op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "**":
+		if y < 0 {
+			return 0, ErrNegativeExponent
+		}
+		res := int64(1)
+		for ; y > 0; y >>= 1 {
+			if y&1 == 1 {
+				res *= x
+			}
+			x *= x
+		}
+		return res, nil
+	case "<<":
+		return x << uint64(y&63), nil
+	case ">>":
+		return x >> uint64(y&63), nil
+	case "&":
+		return x & y, nil
+	case "^":
+		return x ^ y, nil
+	case "|":
+		return x | y, nil
+	case "<":
+		return boolToInt(x < y), nil
+	case ">":
+		return boolToInt(x > y), nil
+	case "<=":
+		return boolToInt(x <= y), nil
+	case ">=":
+		return boolToInt(x >= y), nil
+	case "==":
+		return boolToInt(x == y), nil
+	case "!=":
+		return boolToInt(x != y), nil
+	}
+
+	return 0, a.syntaxError()
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,392 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// streams - стандартные потоки, с которыми выполняется команда.
+type streams struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command - элемент конвейера: простая команда, "( ... )" или "{ ...; }".
+type command interface {
+	// start запускает команду и возвращает функцию, ожидающую ее завершения.
+	// owned - концы каналов конвейера, которые команда должна закрыть, когда
+	// они ей больше не нужны.
+	start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status
+	String() string
+}
+
+// listNode - команды, разделенные ";", "&" или переводом строки.
+type listNode struct {
+	items []*andOrNode
+}
+
+func (l *listNode) exec(opts *options, s streams) Status {
+	status := Status{code: opts.lastCmdCode}
+	for _, item := range l.items {
+		if item.background {
+			status = opts.runBackground(item, s)
+		} else {
+			status = item.exec(opts, s)
+		}
+
+		if status.exit {
+			return status
+		}
+	}
+
+	return status
+}
+
+func (l *listNode) String() string {
+	var b strings.Builder
+	for i, item := range l.items {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(item.String())
+
+		if item.background {
+			b.WriteString(" &")
+		} else if i < len(l.items)-1 {
+			b.WriteString(";")
+		}
+	}
+
+	return b.String()
+}
+
+// andOrNode - конвейеры, связанные "&&" и "||". Операторы имеют равный
+// приоритет и выполняются слева направо.
+type andOrNode struct {
+	pipelines []*Pipeline
+	ops       []string
+	// background - список запускается в фоне: за ним стоит "&".
+	background bool
+}
+
+func (ao *andOrNode) exec(opts *options, s streams) Status {
+	status := ao.execPipeline(0, opts, s)
+	for i, op := range ao.ops {
+		if status.exit {
+			return status
+		}
+
+		if (op == "&&") == (opts.lastCmdCode == 0) {
+			status = ao.execPipeline(i+1, opts, s)
+		}
+	}
+
+	return status
+}
+
+// execPipeline выполняет i-й конвейер списка. "set -e" действует только на
+// последний конвейер без "!".
+func (ao *andOrNode) execPipeline(i int, opts *options, s streams) Status {
+	pl := ao.pipelines[i]
+	if i < len(ao.pipelines)-1 || pl.negate {
+		return opts.condition(func() Status { return pl.exec(opts, s) })
+	}
+	return opts.errexitStatus(pl.exec(opts, s))
+}
+
+func (ao *andOrNode) String() string {
+	res := ao.pipelines[0].String()
+	for i, op := range ao.ops {
+		res += " " + op + " " + ao.pipelines[i+1].String()
+	}
+	return res
+}
+
+type Pipeline struct {
+	negate bool
+	cmds   []command
+}
+
+// exec выполняет конвейер и ждет его завершения. Вне фонового задания
+// конвейер становится заданием переднего плана, которое можно остановить.
+func (pl *Pipeline) exec(opts *options, s streams) Status {
+	var status Status
+
+	if opts.job == nil {
+		status = opts.runForeground(pl, s)
+	} else {
+		status = pl.start(opts, s)()
+	}
+
+	if status.exit {
+		return status
+	}
+
+	if pl.negate {
+		if status.code == 0 {
+			status.code = 1
+		} else {
+			status.code = 0
+		}
+	}
+
+	opts.lastCmdCode = status.code
+	return status
+}
+
+// start запускает все команды конвейера одновременно и возвращает функцию,
+// ожидающую завершения каждой. Код возврата берется у последней команды, а с
+// "set -o pipefail" - у последней завершившейся с ошибкой.
+func (pl *Pipeline) start(opts *options, s streams) func() Status {
+	if len(pl.cmds) == 1 {
+		return pl.cmds[0].start(opts, s, nil, false)
+	}
+
+	return pl.startConcurrently(opts, s)
+}
+
+func (pl *Pipeline) startConcurrently(opts *options, s streams) func() Status {
+	// Команды пишут в общие stdout и stderr из разных горутин.
+	s.stdout = syncWriter(s.stdout)
+	s.stderr = syncWriter(s.stderr)
+
+	waits := make([]func() Status, 0, len(pl.cmds))
+	var reader *os.File
+
+	for i, cmd := range pl.cmds {
+		st := s
+		owned := []io.Closer{}
+
+		// Каждая команда владеет своими концами каналов: внешняя программа
+		// получает их копии, и шелл закрывает свои сразу после запуска, а
+		// встроенная команда закрывает их сама по завершении. Иначе читатель
+		// не дождется EOF, а писатель - SIGPIPE.
+		if reader != nil {
+			st.stdin = reader
+			owned = append(owned, reader)
+			reader = nil
+		}
+
+		if i < len(pl.cmds)-1 {
+			r, w, err := os.Pipe()
+			if err != nil {
+				for _, c := range owned {
+					c.Close()
+				}
+				for _, wait := range waits {
+					wait()
+				}
+				status := Status{exit: true, code: 1, err: err}
+				return func() Status { return status }
+			}
+
+			st.stdout = w
+			owned = append(owned, w)
+			reader = r
+		}
+
+		// Каждая команда конвейера выполняется как в подоболочке.
+		waits = append(waits, cmd.start(opts.subshell(), st, owned, true))
+	}
+
+	pipefail := opts.pipefail
+	return func() Status {
+		var status, failed Status
+		for _, wait := range waits {
+			status = wait()
+			// Команды конвейера не завершают шелл.
+			status.exit = false
+
+			if status.code != 0 {
+				failed = status
+			}
+		}
+
+		if pipefail {
+			status = failed
+		}
+
+		return status
+	}
+}
+
+func (pl *Pipeline) String() string {
+	cmds := make([]string, 0, len(pl.cmds))
+	for _, cmd := range pl.cmds {
+		cmds = append(cmds, cmd.String())
+	}
+
+	res := strings.Join(cmds, " | ")
+	if pl.negate {
+		res = "! " + res
+	}
+	return res
+}
+
+// simpleCommand - имя команды с аргументами, присваиваниями и
+// перенаправлениями. Слова хранятся в исходном виде и раскрываются при каждом
+// запуске.
+type simpleCommand struct {
+	assigns   []string
+	words     []string
+	redirects []*redirect
+}
+
+func (sc *simpleCommand) start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status {
+	fail := func(err error) func() Status {
+		closeAll(owned)
+		status := opts.reportExpansion(s.stderr, err)
+		return func() Status { return status }
+	}
+
+	substitutions := opts.substitutions
+	words, err := opts.expandCommand(sc.words, s)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Присваивания без команды меняют переменные шелла, а перед командой -
+	// только ее окружение.
+	assigns := make([]string, 0, len(sc.assigns))
+	for _, assign := range sc.assigns {
+		name, value, _ := strings.Cut(assign, "=")
+		if err = opts.restrictVar(name); err != nil {
+			return fail(err)
+		}
+		if value, err = opts.expandAssignment(value, s); err != nil {
+			return fail(err)
+		}
+
+		if opts.xtrace {
+			opts.trace(s, []string{name + "=" + value})
+		}
+		if len(words) == 0 {
+			opts.setVar(name, value)
+		} else {
+			assigns = append(assigns, name+"="+value)
+		}
+	}
+
+	if opts.xtrace && len(words) > 0 {
+		opts.trace(s, words)
+	}
+
+	// Команда может состоять из одних перенаправлений, например "> file".
+	code := 0
+	if len(words) == 0 {
+		words = []string{""}
+		if opts.substitutions != substitutions {
+			code = opts.lastCmdCode
+		}
+	}
+
+	cmd := &CMD{
+		prog:      words[0],
+		args:      words[1:],
+		assigns:   assigns,
+		code:      code,
+		pipeline:  pipeline,
+		redirects: sc.redirects,
+		streams:   s,
+		owned:     owned,
+	}
+
+	return cmd.start(opts)
+}
+
+func (sc *simpleCommand) String() string {
+	words := append(append([]string{}, sc.assigns...), sc.words...)
+	return joinRedirects(strings.Join(words, " "), sc.redirects)
+}
+
+// subshellNode - "( ... )", список команд, выполняемый в подоболочке: его
+// переменные, каталог и exit не влияют на шелл.
+type subshellNode struct {
+	body      *listNode
+	redirects []*redirect
+}
+
+func (n *subshellNode) start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status {
+	return startCompound(n.body.exec, n.redirects, opts.subshell(), s, owned, pipeline, true)
+}
+
+func (n *subshellNode) String() string {
+	return joinRedirects("("+n.body.String()+")", n.redirects)
+}
+
+// groupNode - "{ ...; }", список команд, выполняемый в текущем шелле.
+type groupNode struct {
+	body      *listNode
+	redirects []*redirect
+}
+
+func (n *groupNode) start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status {
+	return startCompound(n.body.exec, n.redirects, opts, s, owned, pipeline, pipeline)
+}
+
+func (n *groupNode) String() string {
+	return joinRedirects("{ "+terminated(n.body)+" }", n.redirects)
+}
+
+// startCompound выполняет составную команду: exec - ее тело, subshell -
+// выполняется ли она в подоболочке.
+func startCompound(exec func(*options, streams) Status, redirects []*redirect, opts *options, s streams, owned []io.Closer, pipeline bool, subshell bool) func() Status {
+	closers, err := s.applyRedirects(redirects, opts)
+	if err != nil {
+		closeAll(owned)
+		status := opts.reportExpansion(s.stderr, err)
+		return func() Status { return status }
+	}
+
+	run := func() Status {
+		status := exec(opts, s)
+		closeAll(closers)
+		closeAll(owned)
+
+		// exit в подоболочке завершает только ее.
+		if subshell && status.exit && status.err == nil {
+			status.exit = false
+		}
+		return status
+	}
+
+	if !pipeline {
+		// Составная команда на переднем плане выполняется самим шеллом, и
+		// каждый ее конвейер - отдельное задание.
+		job := opts.job
+		if job != nil && !job.background {
+			opts.job = nil
+		}
+		status := run()
+		opts.job = job
+		return func() Status { return status }
+	}
+
+	done := make(chan Status, 1)
+	go func() {
+		done <- run()
+	}()
+
+	return func() Status { return <-done }
+}
+
+func joinRedirects(cmd string, redirects []*redirect) string {
+	parts := []string{}
+	if cmd != "" {
+		parts = append(parts, cmd)
+	}
+	for _, redir := range redirects {
+		parts = append(parts, redir.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
+}
@@ -0,0 +1,409 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrHelpNoMatch = errors.New("no help topics match")
+var ErrFilenameRequired = errors.New("filename argument required")
+
+// builtin - встроенная команда шелла: run выполняет ее, usage и summary
+// выводит help.
+type builtin struct {
+	name    string
+	run     func(cmd *CMD, opts *options) Status
+	usage   string
+	summary string
+}
+
+// builtins - встроенные команды по имени. Таблица заполняется в init, так
+// как help сама в ней записана и обращается к ней.
+var builtins map[string]*builtin
+
+func init() {
+	builtins = map[string]*builtin{}
+	for _, b := range []*builtin{
+		{".", source, ". filename [arguments]", "Execute commands from a file in the current shell."},
+		{":", func(cmd *CMD, opts *options) Status { return Status{code: 0} }, ": [arguments]", "Null command; arguments are expanded and ignored."},
+		{"[", testBracket, "[ arg... ]", "Evaluate conditional expression; the last argument must be `]'."},
+		{"alias", alias, "alias [-p] [name[=value] ... ]", "Define or display aliases."},
+		{"bg", bg, "bg [job_spec ...]", "Move jobs to the background."},
+		{"break", func(cmd *CMD, opts *options) Status { return loopControl(cmd, opts, flowBreak) }, "break [n]", "Exit for, while, or until loops."},
+		{"cd", cd, "cd [-L|-P] [dir]", "Change the shell working directory."},
+		{"command", commandBuiltin, "command [-vV] command [arg ...]", "Execute a simple command or display information about commands."},
+		{"continue", func(cmd *CMD, opts *options) Status { return loopControl(cmd, opts, flowContinue) }, "continue [n]", "Resume for, while, or until loops."},
+		{"dirs", dirs, "dirs [-clpv] [+N] [-N]", "Display directory stack."},
+		{"disown", disown, "disown [-ar] [jobspec ...]", "Remove jobs from current shell."},
+		{"echo", echo, "echo [arg ...]", "Write arguments to the standard output."},
+		{"exec", execute, "exec [command [argument ...]]", "Replace the shell with the given command."},
+		{"exit", exit, "exit [n]", "Exit the shell."},
+		{"export", export, "export [-n] [-p] [name[=value] ...]", "Set export attribute for shell variables."},
+		{"false", func(cmd *CMD, opts *options) Status { return Status{code: 1} }, "false", "Return an unsuccessful result."},
+		{"fg", fg, "fg [job_spec]", "Move job to the foreground."},
+		{"fork", fork, "fork command [arg ...]", "Run a program as a background job without input or output."},
+		{"hash", hash, "hash [-lr] [-p pathname] [-dt] [name ...]", "Remember or display program locations."},
+		{"help", help, "help [-s] [pattern ...]", "Display information about builtin commands."},
+		{"jobs", jobs, "jobs [-lp] [jobspec ...]", "Display status of jobs."},
+		{"kill", kill, "kill [-s sigspec | -n signum | -sigspec] pid | jobspec ... or kill -l [sigspec]", "Send a signal to a job."},
+		{"local", local, "local [name[=value] ...]", "Define local variables."},
+		{"nc", nc, "nc [-uvz] [-w timeout] host port[-port] or nc -l [-uv] [-w timeout] [host] port", "Read and write data across TCP or UDP connections."},
+		{"popd", popd, "popd [+N | -N]", "Remove directories from stack."},
+		{"printf", printf, "printf [-v var] format [arguments]", "Formats and prints arguments under control of the format."},
+		{"ps", ps, "ps [-eAf] [-o format] [--sort keys]", "Report a snapshot of the current processes."},
+		{"pushd", pushd, "pushd [dir | +N | -N]", "Add directories to stack."},
+		{"pwd", pwd, "pwd [-LP]", "Print the name of the current working directory."},
+		{"read", read, "read [-r] [-d delim] [-p prompt] [name ...]", "Read a line from the standard input and split it into fields."},
+		{"return", returnFrom, "return [n]", "Return from a shell function or sourced script."},
+		{"set", set, "set [-efux] [-o option] [--] [arg ...]", "Set or unset values of shell options and positional parameters."},
+		{"shift", shift, "shift [n]", "Shift positional parameters."},
+		{"shopt", shopt, "shopt [-squ] [optname ...]", "Set and unset shell options."},
+		{"source", source, "source filename [arguments]", "Execute commands from a file in the current shell."},
+		{"test", test, "test [expr]", "Evaluate conditional expression."},
+		{"true", func(cmd *CMD, opts *options) Status { return Status{code: 0} }, "true", "Return a successful result."},
+		{"type", typeOf, "type [-afpt] name [name ...]", "Display information about command type."},
+		{"unalias", unalias, "unalias [-a] name [name ...]", "Remove each name from the list of defined aliases."},
+		{"unset", unset, "unset [-f] [-v] [name ...]", "Unset values and attributes of shell variables."},
+		{"wait", waitFor, "wait [id ...]", "Wait for job completion and return exit status."},
+		{"which", which, "which [-a] name ...", "Locate a program in PATH."},
+	} {
+		builtins[b.name] = b
+	}
+}
+
+// isBuiltin сообщает, выполняет ли команду сам шелл. Пустое имя - команда из
+// одних присваиваний и перенаправлений.
+func isBuiltin(prog string) bool {
+	if prog == "" {
+		return true
+	}
+
+	_, ok := builtins[prog]
+	return ok
+}
+
+// builtinNames возвращает имена встроенных команд по алфавиту.
+func builtinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// help выводит синтаксис встроенных команд, имена которых совпадают с
+// шаблонами, с описанием, а с -s - только синтаксис. Без аргументов
+// выводится список всех команд.
+func help(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	short := false
+	if len(args) > 0 && args[0] == "-s" {
+		short, args = true, args[1:]
+	}
+
+	var b strings.Builder
+	if len(args) == 0 {
+		b.WriteString("wbsh, built-in commands.\n")
+		b.WriteString("Type `help name' to find out more about the command `name'.\n\n")
+		for _, name := range builtinNames() {
+			b.WriteString(builtins[name].usage + "\n")
+		}
+	}
+
+	status := Status{code: 0}
+	for _, pattern := range args {
+		found := false
+		for _, name := range builtinNames() {
+			if !matchPattern(pattern, name) {
+				continue
+			}
+			found = true
+
+			bi := builtins[name]
+			fmt.Fprintf(&b, "%s: %s\n", name, bi.usage)
+			if !short {
+				fmt.Fprintf(&b, "    %s\n", bi.summary)
+			}
+		}
+
+		if !found {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("help: %w `%s'", ErrHelpNoMatch, pattern)})
+		}
+	}
+
+	if _, pErr := io.WriteString(cmd.stdout, b.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return status
+}
+
+// commandKind - чем является имя команды: "alias", "keyword", "function",
+// "builtin" или "file" с путем к файлу; hashed - путь взят из таблицы hash.
+type commandKind struct {
+	kind   string
+	path   string
+	hashed bool
+}
+
+// lookupCommand находит, что шелл выполнит по имени команды. С all
+// возвращаются все варианты, а не только тот, что будет выполнен.
+func (opts *options) lookupCommand(name string, all bool) []commandKind {
+	res := []commandKind{}
+	add := func(kind string, path string) bool {
+		res = append(res, commandKind{kind: kind, path: path})
+		return !all
+	}
+
+	if _, ok := opts.aliases[name]; ok && add("alias", "") {
+		return res
+	}
+	if isReservedWord(name) && add("keyword", "") {
+		return res
+	}
+	if _, ok := opts.funcs[name]; ok && add("function", "") {
+		return res
+	}
+	if _, ok := builtins[name]; ok && add("builtin", "") {
+		return res
+	}
+	path, _ := opts.getVar("PATH")
+	if file, ok := opts.hash.lookup(name, path); ok && !all {
+		return append(res, commandKind{kind: "file", path: file, hashed: true})
+	}
+	for _, path := range opts.searchPath(name, all) {
+		add("file", path)
+	}
+	return res
+}
+
+// searchPath ищет исполняемый файл по $PATH шелла, а с all возвращает все
+// найденные файлы. Имя с "/" ищется как путь.
+func (opts *options) searchPath(name string, all bool) []string {
+	if strings.Contains(name, "/") {
+		if isExecutable(opts.path(name)) {
+			return []string{name}
+		}
+		return nil
+	}
+
+	path, _ := opts.getVar("PATH")
+	return findInPath(name, path, all)
+}
+
+// typeOf описывает, как шелл выполнит каждое имя: -t выводит только вид
+// команды, -p - путь к файлу, -a - все варианты, а не первый.
+func typeOf(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	all, kindOnly, pathOnly := false, false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'a':
+				all = true
+			case 't':
+				kindOnly = true
+			case 'p', 'P':
+				pathOnly = true
+			default:
+				return Status{code: 2, err: fmt.Errorf("type: -%c: %w", c, ErrInvalidOption)}
+			}
+		}
+		args = args[1:]
+	}
+
+	var b strings.Builder
+	status := Status{code: 0}
+	for _, name := range args {
+		kinds := opts.lookupCommand(name, all)
+		if len(kinds) == 0 {
+			status.code = 1
+			if !kindOnly && !pathOnly {
+				status = cmd.report(Status{code: 1, err: fmt.Errorf("type: %s: %w", name, ErrNotFound)})
+			}
+			continue
+		}
+
+		for _, k := range kinds {
+			switch {
+			case kindOnly:
+				b.WriteString(k.kind + "\n")
+			case pathOnly:
+				if k.kind == "file" {
+					b.WriteString(k.path + "\n")
+				}
+			default:
+				b.WriteString(opts.describeCommand(name, k) + "\n")
+			}
+		}
+	}
+
+	if _, pErr := io.WriteString(cmd.stdout, b.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return status
+}
+
+// describeCommand описывает команду так, как это делает type.
+func (opts *options) describeCommand(name string, k commandKind) string {
+	switch k.kind {
+	case "alias":
+		return fmt.Sprintf("%s is aliased to `%s'", name, opts.aliases[name])
+	case "keyword":
+		return name + " is a shell keyword"
+	case "function":
+		return name + " is a function\n" + opts.funcs[name].String()
+	case "builtin":
+		return name + " is a shell builtin"
+	}
+	if k.hashed {
+		return fmt.Sprintf("%s is hashed (%s)", name, k.path)
+	}
+	return name + " is " + k.path
+}
+
+// commandBuiltin выполняет команду, минуя функции, а с -v и -V выводит, чем
+// является каждое имя: -v - в виде, пригодном для повторного выполнения, -V -
+// как type.
+func commandBuiltin(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	mode := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'v', 'V':
+				mode = string(c)
+			case 'p':
+			default:
+				return Status{code: 2, err: fmt.Errorf("command: -%c: %w", c, ErrInvalidOption)}
+			}
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return Status{code: 0}
+	}
+
+	if mode == "" {
+		c := *cmd
+		c.prog, c.args = args[0], args[1:]
+		if b, ok := builtins[c.prog]; ok {
+			if err := opts.restrictBuiltin(&c); err != nil {
+				return Status{code: 1, err: err}
+			}
+			return b.run(&c, opts)
+		}
+		return run(&c, opts)
+	}
+
+	var b strings.Builder
+	status := Status{code: 0}
+	for _, name := range args {
+		kinds := opts.lookupCommand(name, false)
+		if len(kinds) == 0 {
+			status.code = 1
+			if mode == "V" {
+				status = cmd.report(Status{code: 1, err: fmt.Errorf("command: %s: %w", name, ErrNotFound)})
+			}
+			continue
+		}
+
+		switch k := kinds[0]; {
+		case mode == "V":
+			b.WriteString(opts.describeCommand(name, k) + "\n")
+		case k.kind == "alias":
+			fmt.Fprintf(&b, "alias %s=%s\n", name, singleQuote(opts.aliases[name]))
+		case k.kind == "file":
+			b.WriteString(k.path + "\n")
+		default:
+			b.WriteString(name + "\n")
+		}
+	}
+
+	if _, pErr := io.WriteString(cmd.stdout, b.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return status
+}
+
+// which выводит путь к программе в $PATH, с -a - все найденные. Встроенные
+// команды и функции не учитываются.
+func which(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	all := false
+	if len(args) > 0 && args[0] == "-a" {
+		all, args = true, args[1:]
+	}
+
+	var b strings.Builder
+	status := Status{code: 0}
+	for _, name := range args {
+		paths := opts.searchPath(name, all)
+		if len(paths) == 0 {
+			status.code = 1
+		}
+		for _, path := range paths {
+			b.WriteString(path + "\n")
+		}
+	}
+
+	if _, pErr := io.WriteString(cmd.stdout, b.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return status
+}
+
+// source выполняет команды из файла в текущем шелле. Имя без "/" ищется в
+// $PATH, затем в текущем каталоге. Аргументы на время выполнения становятся
+// позиционными параметрами, а return завершает файл.
+func source(cmd *CMD, opts *options) Status {
+	if len(cmd.args) == 0 {
+		return Status{code: 2, err: fmt.Errorf("%s: %w", cmd.prog, ErrFilenameRequired)}
+	}
+
+	name := cmd.args[0]
+	path := opts.path(name)
+	if !strings.Contains(name, "/") {
+		dirs, _ := opts.getVar("PATH")
+		for _, dir := range filepath.SplitList(dirs) {
+			file := opts.path(filepath.Join(dir, name))
+			if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+				path = file
+				break
+			}
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Status{code: 1, err: fmt.Errorf("%s: %w", cmd.prog, err)}
+	}
+	defer f.Close()
+
+	if len(cmd.args) > 1 {
+		args := opts.args
+		opts.args = cmd.args[1:]
+		defer func() { opts.args = args }()
+	}
+
+	opts.sources++
+	defer func() { opts.sources-- }()
+
+	status := opts.runSource(f, name, cmd.streams)
+	if status.exit && status.flow == flowReturn {
+		status.exit, status.flow = false, flowNone
+	}
+	return status
+}
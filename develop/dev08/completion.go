@@ -0,0 +1,186 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// completions возвращает варианты дополнения слова, на котором заканчивается
+// line: на месте имени команды - встроенные команды, функции и программы из
+// PATH, в остальных местах и для слов с "/" - пути к файлам. start - начало
+// слова в line. Варианты экранированы и готовы для вставки в строку.
+func (opts *options) completions(line string) (start int, matches []string) {
+	start = wordStart(line)
+	word := unescapeWord(line[start:])
+
+	if isCommandPosition(line[:start]) && !strings.Contains(word, "/") {
+		return start, opts.commandCompletions(word)
+	}
+	return start, opts.fileCompletions(word)
+}
+
+// wordStart возвращает начало последнего слова строки с учетом кавычек и
+// экранирования.
+func wordStart(line string) int {
+	start := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case isMetaChar(c):
+			start = i + 1
+		}
+	}
+	return start
+}
+
+// isCommandPosition сообщает, стоит ли после текста before имя команды: в
+// начале строки, после оператора или зарезервированного слова.
+func isCommandPosition(before string) bool {
+	before = strings.TrimRight(before, " \t")
+	if before == "" || strings.ContainsAny(before[len(before)-1:], "|&;(\n") {
+		return true
+	}
+
+	fields := strings.Fields(before)
+	switch fields[len(fields)-1] {
+	case "if", "then", "elif", "else", "while", "until", "do", "{", "!":
+		return true
+	}
+	return false
+}
+
+// unescapeWord убирает из слова кавычки и экранирование.
+func unescapeWord(word string) string {
+	var b strings.Builder
+	for i := 0; i < len(word); i++ {
+		switch c := word[i]; c {
+		case '\'', '"':
+		case '\\':
+			if i+1 < len(word) {
+				i++
+				b.WriteByte(word[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeWord экранирует символы, особые для шелла.
+func escapeWord(word string) string {
+	var b strings.Builder
+	for i := 0; i < len(word); i++ {
+		if strings.IndexByte(" \t\n'\"\\$`|&;()<>*?[]#", word[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(word[i])
+	}
+	return b.String()
+}
+
+func (opts *options) commandCompletions(prefix string) []string {
+	names := map[string]bool{}
+	for _, name := range builtinNames() {
+		names[name] = true
+	}
+	for name := range opts.funcs {
+		names[name] = true
+	}
+	for name := range opts.aliases {
+		names[name] = true
+	}
+
+	path, _ := opts.getVar("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		entries, err := os.ReadDir(opts.path(dir))
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), prefix) {
+				continue
+			}
+			info, statErr := os.Stat(filepath.Join(opts.path(dir), entry.Name()))
+			if statErr == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				names[entry.Name()] = true
+			}
+		}
+	}
+
+	matches := []string{}
+	for name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, escapeWord(name))
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// fileCompletions дополняет путь к файлу. Каталоги дополняются "/", скрытые
+// файлы предлагаются, только если имя начинается с ".".
+func (opts *options) fileCompletions(word string) []string {
+	dir, base := word[:strings.LastIndex(word, "/")+1], word[strings.LastIndex(word, "/")+1:]
+
+	lookup := dir
+	if home, ok := opts.getVar("HOME"); ok && (lookup == "~/" || strings.HasPrefix(lookup, "~/")) {
+		lookup = home + lookup[1:]
+	}
+	if lookup == "" {
+		lookup = "."
+	}
+
+	entries, err := os.ReadDir(opts.path(lookup))
+	if err != nil {
+		return nil
+	}
+
+	matches := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		match := escapeWord(name)
+		if info, statErr := os.Stat(filepath.Join(opts.path(lookup), name)); statErr == nil && info.IsDir() {
+			match += "/"
+		}
+		matches = append(matches, escapeWord(dir)+match)
+	}
+
+	sort.Strings(matches)
+	return matches
+}
+
+// commonPrefix возвращает общее начало строк.
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	// Общее начало не должно обрывать многобайтовый символ.
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
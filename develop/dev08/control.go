@@ -0,0 +1,413 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Управление выполнением, которое переносит Status с exit == true: break,
+// continue и return прерывают списки команд так же, как exit, пока их не
+// обработает цикл или функция.
+const (
+	flowNone = iota
+	flowBreak
+	flowContinue
+	flowReturn
+)
+
+var ErrNotInLoop = errors.New("only meaningful in a `for', `while', or `until' loop")
+var ErrLoopCount = errors.New("loop count out of range")
+var ErrNotInFunction = errors.New("can only `return' from a function or sourced script")
+var ErrLocalOutsideFunction = errors.New("local: can only be used in a function")
+var ErrNumericArgument = errors.New("numeric argument required")
+var ErrTooManyArgs = errors.New("too many arguments")
+var ErrFuncNesting = errors.New("maximum function nesting level exceeded")
+
+// maxCallDepth ограничивает рекурсию функций, чтобы бесконечная рекурсия
+// завершалась ошибкой, а не переполнением стека шелла.
+const maxCallDepth = 1000
+
+// terminated возвращает текст списка, завершенный ";", если последняя
+// команда не фоновая.
+func terminated(l *listNode) string {
+	res := l.String()
+	if !l.items[len(l.items)-1].background {
+		res += ";"
+	}
+	return res
+}
+
+// ifNode - "if ...; then ...; elif ...; then ...; else ...; fi".
+type ifNode struct {
+	conds     []*listNode
+	bodies    []*listNode
+	elseBody  *listNode
+	redirects []*redirect
+}
+
+func (n *ifNode) start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status {
+	return startCompound(n.exec, n.redirects, opts, s, owned, pipeline, pipeline)
+}
+
+func (n *ifNode) exec(opts *options, s streams) Status {
+	for i, cond := range n.conds {
+		status := opts.condition(func() Status { return cond.exec(opts, s) })
+		if status.exit {
+			return status
+		}
+
+		if status.code == 0 {
+			return n.bodies[i].exec(opts, s)
+		}
+	}
+
+	if n.elseBody != nil {
+		return n.elseBody.exec(opts, s)
+	}
+
+	// Если ни одно условие не выполнено, код возврата - 0.
+	return Status{code: 0}
+}
+
+func (n *ifNode) String() string {
+	var b strings.Builder
+	for i, cond := range n.conds {
+		if i == 0 {
+			b.WriteString("if ")
+		} else {
+			b.WriteString(" elif ")
+		}
+		b.WriteString(terminated(cond) + " then " + terminated(n.bodies[i]))
+	}
+
+	if n.elseBody != nil {
+		b.WriteString(" else " + terminated(n.elseBody))
+	}
+	b.WriteString(" fi")
+
+	return joinRedirects(b.String(), n.redirects)
+}
+
+// loopFlow обрабатывает break и continue, прервавшие тело цикла: next
+// сообщает, нужно ли продолжать цикл, иначе он завершается со статусом res.
+// "break N" и "continue N" передаются внешнему циклу с уменьшенным счетчиком.
+func loopFlow(status Status) (res Status, next bool) {
+	if !status.exit {
+		return status, true
+	}
+
+	if status.flow != flowBreak && status.flow != flowContinue {
+		return status, false
+	}
+
+	if status.levels > 1 {
+		status.levels--
+		return status, false
+	}
+
+	return Status{code: status.code}, status.flow == flowContinue
+}
+
+// loopNode - "while ...; do ...; done" или "until ...; do ...; done".
+type loopNode struct {
+	until     bool
+	cond      *listNode
+	body      *listNode
+	redirects []*redirect
+}
+
+func (n *loopNode) start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status {
+	return startCompound(n.exec, n.redirects, opts, s, owned, pipeline, pipeline)
+}
+
+func (n *loopNode) exec(opts *options, s streams) Status {
+	opts.loops++
+	defer func() { opts.loops-- }()
+
+	status := Status{code: 0}
+	for {
+		cond := opts.condition(func() Status { return n.cond.exec(opts, s) })
+		if cond.exit {
+			res, next := loopFlow(cond)
+			if !next {
+				return res
+			}
+			continue
+		}
+
+		if (cond.code == 0) == n.until {
+			return status
+		}
+
+		var next bool
+		if status, next = loopFlow(n.body.exec(opts, s)); !next {
+			return status
+		}
+	}
+}
+
+func (n *loopNode) String() string {
+	keyword := "while "
+	if n.until {
+		keyword = "until "
+	}
+	return joinRedirects(keyword+terminated(n.cond)+" do "+terminated(n.body)+" done", n.redirects)
+}
+
+// forNode - "for NAME in WORD...; do ...; done". Без "in" перебираются
+// позиционные параметры.
+type forNode struct {
+	name string
+	// words - nil, если "in" нет.
+	words     []string
+	body      *listNode
+	redirects []*redirect
+}
+
+func (n *forNode) start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status {
+	return startCompound(n.exec, n.redirects, opts, s, owned, pipeline, pipeline)
+}
+
+func (n *forNode) exec(opts *options, s streams) Status {
+	values := append([]string{}, opts.args...)
+	if n.words != nil {
+		var err error
+		if values, err = opts.expandWords(n.words, s); err != nil {
+			return opts.reportExpansion(s.stderr, err)
+		}
+	}
+
+	opts.loops++
+	defer func() { opts.loops-- }()
+
+	status := Status{code: 0}
+	for _, value := range values {
+		if err := opts.setVar(n.name, value); err != nil {
+			return reportError(s.stderr, Status{code: 1, err: err})
+		}
+
+		var next bool
+		if status, next = loopFlow(n.body.exec(opts, s)); !next {
+			return status
+		}
+	}
+
+	return status
+}
+
+func (n *forNode) String() string {
+	res := "for " + n.name
+	if n.words != nil {
+		res += " in"
+		for _, word := range n.words {
+			res += " " + word
+		}
+	}
+	return joinRedirects(res+"; do "+terminated(n.body)+" done", n.redirects)
+}
+
+// caseNode - "case WORD in PATTERN|PATTERN) ...;; esac". Выполняется первый
+// вариант, шаблон которого совпадает со словом.
+type caseNode struct {
+	word      string
+	items     []*caseItem
+	redirects []*redirect
+}
+
+type caseItem struct {
+	patterns []string
+	body     *listNode
+}
+
+func (n *caseNode) start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status {
+	return startCompound(n.exec, n.redirects, opts, s, owned, pipeline, pipeline)
+}
+
+func (n *caseNode) exec(opts *options, s streams) Status {
+	word, err := opts.expandString(n.word, s)
+	if err != nil {
+		return opts.reportExpansion(s.stderr, err)
+	}
+
+	for _, item := range n.items {
+		for _, pattern := range item.patterns {
+			pattern, err := opts.expandPattern(pattern, s)
+			if err != nil {
+				return opts.reportExpansion(s.stderr, err)
+			}
+
+			if !matchPattern(pattern, word) {
+				continue
+			}
+
+			if len(item.body.items) == 0 {
+				return Status{code: 0}
+			}
+			return item.body.exec(opts, s)
+		}
+	}
+
+	return Status{code: 0}
+}
+
+func (n *caseNode) String() string {
+	var b strings.Builder
+	b.WriteString("case " + n.word + " in")
+	for _, item := range n.items {
+		b.WriteString(" " + strings.Join(item.patterns, " | ") + ")")
+		if len(item.body.items) > 0 {
+			b.WriteString(" " + item.body.String())
+		}
+		b.WriteString(";;")
+	}
+	b.WriteString(" esac")
+
+	return joinRedirects(b.String(), n.redirects)
+}
+
+// funcDef - определение функции "NAME() { ...; }". Тело выполняется при
+// каждом вызове в текущем шелле, аргументы вызова становятся позиционными
+// параметрами.
+type funcDef struct {
+	name string
+	body command
+}
+
+func (n *funcDef) start(opts *options, s streams, owned []io.Closer, pipeline bool) func() Status {
+	closeAll(owned)
+	opts.funcs[n.name] = n
+	return func() Status { return Status{code: 0} }
+}
+
+func (n *funcDef) String() string {
+	return n.name + "() " + n.body.String()
+}
+
+// call выполняет функцию. Переменные, объявленные в ней через local, по
+// возвращении получают прежние значения.
+func (cmd *CMD) call(fn *funcDef, opts *options) Status {
+	if opts.calls >= maxCallDepth {
+		return Status{code: 1, err: fmt.Errorf("%s: %w (%d)", fn.name, ErrFuncNesting, maxCallDepth)}
+	}
+
+	args, locals := opts.args, opts.locals
+	opts.args, opts.locals = cmd.args, variables{}
+	opts.calls++
+
+	defer func() {
+		for name, v := range opts.locals {
+			if v == nil {
+				delete(opts.vars, name)
+			} else {
+				opts.vars[name] = v
+			}
+		}
+		opts.args, opts.locals = args, locals
+		opts.calls--
+	}()
+
+	status := fn.body.start(opts, cmd.streams, nil, false)()
+	if status.exit && status.flow == flowReturn {
+		status.exit, status.flow = false, flowNone
+	}
+	return status
+}
+
+// loopControl выполняет break и continue.
+func loopControl(cmd *CMD, opts *options, flow int) Status {
+	if opts.loops == 0 {
+		return Status{code: 0, err: fmt.Errorf("%s: %w", cmd.prog, ErrNotInLoop)}
+	}
+
+	if len(cmd.args) > 1 {
+		return Status{code: 1, err: fmt.Errorf("%s: %w", cmd.prog, ErrTooManyArgs)}
+	}
+
+	levels := 1
+	if len(cmd.args) == 1 {
+		n, err := strconv.Atoi(cmd.args[0])
+		if err != nil {
+			return Status{code: 1, err: fmt.Errorf("%s: %s: %w", cmd.prog, cmd.args[0], ErrNumericArgument)}
+		}
+		if n < 1 {
+			return Status{code: 1, err: fmt.Errorf("%s: %d: %w", cmd.prog, n, ErrLoopCount)}
+		}
+		levels = n
+	}
+
+	// Лишние уровни прерывают все циклы.
+	if levels > opts.loops {
+		levels = opts.loops
+	}
+
+	// В конвейере команда выполняется в подоболочке и на цикл не влияет.
+	if cmd.pipeline {
+		return Status{code: 0}
+	}
+	return Status{exit: true, flow: flow, levels: levels}
+}
+
+func returnFrom(cmd *CMD, opts *options) Status {
+	if opts.locals == nil && opts.sources == 0 {
+		return Status{code: 1, err: fmt.Errorf("return: %w", ErrNotInFunction)}
+	}
+
+	if len(cmd.args) > 1 {
+		return Status{code: 1, err: fmt.Errorf("return: %w", ErrTooManyArgs)}
+	}
+
+	code := opts.lastCmdCode
+	if len(cmd.args) == 1 {
+		n, err := strconv.Atoi(cmd.args[0])
+		if err != nil {
+			return Status{code: 2, err: fmt.Errorf("return: %s: %w", cmd.args[0], ErrNumericArgument)}
+		}
+		code = n & 0xff
+	}
+
+	if cmd.pipeline {
+		return Status{code: code}
+	}
+	return Status{exit: true, flow: flowReturn, code: code}
+}
+
+// local объявляет переменные функции. Прежнее значение сохраняется при
+// первом объявлении и восстанавливается при выходе из функции.
+func local(cmd *CMD, opts *options) Status {
+	if opts.locals == nil {
+		return Status{code: 1, err: ErrLocalOutsideFunction}
+	}
+
+	status := Status{code: 0}
+	for _, arg := range cmd.args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !isName(name) {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("local: `%s': %w", arg, ErrInvalidName)})
+			continue
+		}
+		if err := opts.restrictVar(name); err != nil {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("local: %w", err)})
+			continue
+		}
+
+		_, declared := opts.locals[name]
+		if !declared {
+			opts.locals[name] = opts.vars[name]
+		}
+
+		// Новая переменная, а не изменение старой: старая будет
+		// восстановлена.
+		if hasValue {
+			opts.vars[name] = &variable{value: value}
+		} else if !declared {
+			delete(opts.vars, name)
+		}
+	}
+
+	return status
+}
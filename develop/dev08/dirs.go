@@ -0,0 +1,339 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var ErrHomeNotSet = errors.New("HOME not set")
+var ErrOldpwdNotSet = errors.New("OLDPWD not set")
+var ErrDirStackEmpty = errors.New("directory stack empty")
+var ErrNoOtherDir = errors.New("no other directory")
+var ErrDirStackIndex = errors.New("directory stack index out of range")
+
+// chdir делает dir текущим каталогом шелла и обновляет $PWD и $OLDPWD. С
+// physical символические ссылки в пути заменяются каталогами, на которые они
+// указывают.
+func (opts *options) chdir(dir string, physical bool) error {
+	// Текущий каталог хранится в opts, а не в процессе: так подоболочки и
+	// команды конвейера могут менять его независимо от шелла.
+	dir = opts.path(dir)
+	if physical {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		dir = resolved
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	opts.setVar("OLDPWD", opts.workDir)
+	opts.setVar("PWD", dir)
+	opts.workDir = dir
+	return nil
+}
+
+// dirError сообщает об ошибке смены каталога так же, как bash: "cd: dir: No
+// such file or directory".
+func dirError(prog string, dir string, err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return fmt.Errorf("%s: %s: %w", prog, dir, err)
+}
+
+// cd меняет текущий каталог: без аргументов - на $HOME, "cd -" - на
+// $OLDPWD. Относительное имя, не начинающееся с "." или "..", ищется и в
+// каталогах $CDPATH; если каталог найден так или через "-", его путь
+// выводится.
+func cd(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	physical := false
+	for len(args) > 0 && (args[0] == "-L" || args[0] == "-P") {
+		physical = args[0] == "-P"
+		args = args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	if len(args) > 1 {
+		return Status{code: 1, err: fmt.Errorf("cd: %w", ErrTooManyArgs)}
+	}
+
+	show := false
+	dir := ""
+	switch {
+	case len(args) == 0:
+		home, ok := opts.getVar("HOME")
+		if !ok {
+			return Status{code: 1, err: fmt.Errorf("cd: %w", ErrHomeNotSet)}
+		}
+		dir = home
+	case args[0] == "-":
+		old, ok := opts.getVar("OLDPWD")
+		if !ok || old == "" {
+			return Status{code: 1, err: fmt.Errorf("cd: %w", ErrOldpwdNotSet)}
+		}
+		dir, show = old, true
+	default:
+		dir = args[0]
+	}
+
+	if dir == "" {
+		return Status{code: 0}
+	}
+
+	target := dir
+	if cdpath, ok := opts.getVar("CDPATH"); ok && isCdpathName(dir) {
+		for _, base := range filepath.SplitList(cdpath) {
+			candidate := dir
+			if base != "" {
+				candidate = filepath.Join(base, dir)
+			}
+			if info, err := os.Stat(opts.path(candidate)); err == nil && info.IsDir() {
+				target, show = candidate, show || base != ""
+				break
+			}
+		}
+	}
+
+	if err := opts.chdir(target, physical); err != nil {
+		return Status{code: 1, err: dirError("cd", dir, err)}
+	}
+
+	if show {
+		if _, pErr := fmt.Fprintln(cmd.stdout, opts.workDir); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+	}
+	return Status{code: 0}
+}
+
+// isCdpathName сообщает, ищется ли каталог в $CDPATH: абсолютные пути и
+// пути от "." или ".." не ищутся.
+func isCdpathName(dir string) bool {
+	if filepath.IsAbs(dir) || dir == "." || dir == ".." {
+		return false
+	}
+	return !strings.HasPrefix(dir, "./") && !strings.HasPrefix(dir, "../")
+}
+
+// pwd выводит текущий каталог, а с -P - путь без символических ссылок.
+func pwd(cmd *CMD, opts *options) Status {
+	dir := opts.workDir
+	for _, arg := range cmd.args {
+		switch arg {
+		case "-L":
+			dir = opts.workDir
+		case "-P":
+			resolved, err := filepath.EvalSymlinks(opts.workDir)
+			if err != nil {
+				return Status{code: 1, err: fmt.Errorf("pwd: %w", err)}
+			}
+			dir = resolved
+		default:
+			return Status{code: 2, err: fmt.Errorf("pwd: %s: %w", arg, ErrInvalidOption)}
+		}
+	}
+
+	if _, pErr := fmt.Fprintln(cmd.stdout, dir); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+
+	return Status{code: 0}
+}
+
+// abbreviateHome заменяет домашний каталог в начале пути на "~".
+func (opts *options) abbreviateHome(path string) string {
+	home, ok := opts.tildeDir("")
+	if !ok || home == "" || home == "/" {
+		return path
+	}
+
+	home = strings.TrimSuffix(home, "/")
+	if path == home || strings.HasPrefix(path, home+"/") {
+		return "~" + path[len(home):]
+	}
+	return path
+}
+
+// dirList возвращает стек каталогов, начиная с текущего.
+func (opts *options) dirList() []string {
+	return append([]string{opts.workDir}, opts.dirStack...)
+}
+
+// dirIndex разбирает "+N" (N-й каталог стека слева, начиная с 0) или "-N"
+// (справа). ok == false, если аргумент - не индекс.
+func (opts *options) dirIndex(arg string) (index int, ok bool, err error) {
+	if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+		return 0, false, nil
+	}
+	n, convErr := strconv.Atoi(arg[1:])
+	if convErr != nil || n < 0 {
+		return 0, false, nil
+	}
+
+	size := len(opts.dirStack) + 1
+	if n >= size {
+		return 0, true, fmt.Errorf("%s: %w", arg, ErrDirStackIndex)
+	}
+	if arg[0] == '-' {
+		n = size - 1 - n
+	}
+	return n, true, nil
+}
+
+// pushd меняет текущий каталог на dir и кладет прежний в стек. Без
+// аргументов меняет местами текущий каталог и вершину стека, а "+N" и "-N"
+// прокручивают стек так, чтобы N-й каталог стал текущим.
+func pushd(cmd *CMD, opts *options) Status {
+	if len(cmd.args) > 1 {
+		return Status{code: 1, err: fmt.Errorf("pushd: %w", ErrTooManyArgs)}
+	}
+
+	list := opts.dirList()
+	if len(cmd.args) == 0 {
+		if len(opts.dirStack) == 0 {
+			return Status{code: 1, err: fmt.Errorf("pushd: %w", ErrNoOtherDir)}
+		}
+		list[0], list[1] = list[1], list[0]
+	} else if n, ok, err := opts.dirIndex(cmd.args[0]); err != nil {
+		return Status{code: 1, err: fmt.Errorf("pushd: %w", err)}
+	} else if ok {
+		list = append(append([]string{}, list[n:]...), list[:n]...)
+	} else {
+		if err := opts.chdir(cmd.args[0], false); err != nil {
+			return Status{code: 1, err: dirError("pushd", cmd.args[0], err)}
+		}
+		opts.dirStack = list
+		return printDirs(cmd, opts, false, false, false)
+	}
+
+	if err := opts.chdir(list[0], false); err != nil {
+		return Status{code: 1, err: dirError("pushd", list[0], err)}
+	}
+	opts.dirStack = list[1:]
+	return printDirs(cmd, opts, false, false, false)
+}
+
+// popd убирает вершину стека и делает ее текущим каталогом, а с "+N" и
+// "-N" убирает N-й каталог стека.
+func popd(cmd *CMD, opts *options) Status {
+	if len(cmd.args) > 1 {
+		return Status{code: 1, err: fmt.Errorf("popd: %w", ErrTooManyArgs)}
+	}
+	if len(opts.dirStack) == 0 {
+		return Status{code: 1, err: fmt.Errorf("popd: %w", ErrDirStackEmpty)}
+	}
+
+	n := 0
+	if len(cmd.args) == 1 {
+		var ok bool
+		var err error
+		if n, ok, err = opts.dirIndex(cmd.args[0]); err != nil {
+			return Status{code: 1, err: fmt.Errorf("popd: %w", err)}
+		} else if !ok {
+			return Status{code: 2, err: fmt.Errorf("popd: %s: %w", cmd.args[0], ErrInvalidOption)}
+		}
+	}
+
+	list := opts.dirList()
+	if n == 0 {
+		if err := opts.chdir(list[1], false); err != nil {
+			return Status{code: 1, err: dirError("popd", list[1], err)}
+		}
+		opts.dirStack = list[2:]
+	} else {
+		opts.dirStack = append(list[1:n:n], list[n+1:]...)
+	}
+	return printDirs(cmd, opts, false, false, false)
+}
+
+// dirs выводит стек каталогов: -c очищает его, -l выводит полные пути без
+// "~", -p - по каталогу на строку, -v - с номерами, "+N" и "-N" - один
+// каталог.
+func dirs(cmd *CMD, opts *options) Status {
+	clear, long, perLine, numbered := false, false, false, false
+	for _, arg := range cmd.args {
+		if n, ok, err := opts.dirIndex(arg); err != nil {
+			return Status{code: 1, err: fmt.Errorf("dirs: %w", err)}
+		} else if ok {
+			dir := opts.dirList()[n]
+			if !long {
+				dir = opts.abbreviateHome(dir)
+			}
+			if _, pErr := fmt.Fprintln(cmd.stdout, dir); pErr != nil {
+				return Status{exit: true, code: 1, err: pErr}
+			}
+			return Status{code: 0}
+		}
+
+		if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			return Status{code: 2, err: fmt.Errorf("dirs: %s: %w", arg, ErrInvalidOption)}
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'c':
+				clear = true
+			case 'l':
+				long = true
+			case 'p':
+				perLine = true
+			case 'v':
+				numbered = true
+			default:
+				return Status{code: 2, err: fmt.Errorf("dirs: -%c: %w", c, ErrInvalidOption)}
+			}
+		}
+	}
+
+	if clear {
+		opts.dirStack = nil
+		return Status{code: 0}
+	}
+	return printDirs(cmd, opts, long, perLine, numbered)
+}
+
+func printDirs(cmd *CMD, opts *options, long bool, perLine bool, numbered bool) Status {
+	var b strings.Builder
+	for i, dir := range opts.dirList() {
+		if !long {
+			dir = opts.abbreviateHome(dir)
+		}
+
+		switch {
+		case numbered:
+			fmt.Fprintf(&b, "%2d  %s\n", i, dir)
+		case perLine:
+			b.WriteString(dir + "\n")
+		case i > 0:
+			b.WriteString(" " + dir)
+		default:
+			b.WriteString(dir)
+		}
+	}
+	if !numbered && !perLine {
+		b.WriteString("\n")
+	}
+
+	if _, pErr := fmt.Fprint(cmd.stdout, b.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return Status{code: 0}
+}
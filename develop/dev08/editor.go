@@ -0,0 +1,409 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrNotTerminal = errors.New("not a terminal")
+
+// errInterrupted - ввод строки прерван Ctrl+C.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor читает команды с терминала в посимвольном режиме: с
+// перемещением курсора, историей, обратным поиском и дополнением по Tab.
+// Строка не переносится: если она не помещается, видна часть вокруг курсора.
+type lineEditor struct {
+	in      *os.File
+	out     io.Writer
+	opts    *options
+	history *history
+	// pending - прочитанные, но еще не обработанные байты.
+	pending []byte
+
+	prompt string
+	buf    []rune
+	pos    int
+	// histPos - просматриваемая команда истории, len(entries) - новая
+	// строка; saved - новая строка, пока просматривается история.
+	histPos int
+	saved   []rune
+	// lastKey - предыдущая клавиша: второй Tab подряд показывает варианты.
+	lastKey string
+}
+
+func newLineEditor(in *os.File, out io.Writer, opts *options, h *history) *lineEditor {
+	return &lineEditor{in: in, out: out, opts: opts, history: h}
+}
+
+// readLine читает строку. Ctrl+D в пустой строке возвращает io.EOF, Ctrl+C
+// - errInterrupted.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	e.histPos, e.saved, e.lastKey = len(e.history.entries), nil, ""
+	e.refresh()
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		if done, hErr := e.handle(key); done {
+			return string(e.buf), hErr
+		}
+		e.lastKey = key
+	}
+}
+
+func (e *lineEditor) readByte() (byte, error) {
+	if len(e.pending) == 0 {
+		buf := make([]byte, 256)
+		n, err := e.in.Read(buf)
+		if n == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		e.pending = buf[:n]
+	}
+
+	b := e.pending[0]
+	e.pending = e.pending[1:]
+	return b, nil
+}
+
+// readKey читает одну клавишу: символ, управляющий символ или
+// escape-последовательность вроде "\x1b[A".
+func (e *lineEditor) readKey() (string, error) {
+	b, err := e.readByte()
+	if err != nil {
+		return "", err
+	}
+
+	key := []byte{b}
+	switch {
+	case b == '\x1b':
+		next, err := e.readByte()
+		if err != nil {
+			return "", err
+		}
+		key = append(key, next)
+		if next != '[' && next != 'O' {
+			// Alt+клавиша.
+			return string(key), nil
+		}
+
+		// CSI и SS3 заканчиваются байтом из диапазона '@'-'~'.
+		for {
+			c, err := e.readByte()
+			if err != nil {
+				return "", err
+			}
+			key = append(key, c)
+			if c >= '@' && c <= '~' {
+				return string(key), nil
+			}
+		}
+	case b >= utf8.RuneSelf:
+		for !utf8.FullRune(key) {
+			c, err := e.readByte()
+			if err != nil {
+				return "", err
+			}
+			key = append(key, c)
+		}
+	}
+
+	return string(key), nil
+}
+
+// handle обрабатывает клавишу. done - строка введена или ввод прерван.
+func (e *lineEditor) handle(key string) (done bool, err error) {
+	switch key {
+	case "\r", "\n":
+		e.pos = len(e.buf)
+		e.refresh()
+		e.write("\n")
+		return true, nil
+	case "\x03": // Ctrl+C
+		e.pos = len(e.buf)
+		e.refresh()
+		e.write("^C\n")
+		e.buf = nil
+		return true, errInterrupted
+	case "\x04": // Ctrl+D
+		if len(e.buf) == 0 {
+			return true, io.EOF
+		}
+		e.deleteRange(e.pos, e.pos+1)
+	case "\x7f", "\x08": // Backspace
+		if e.pos > 0 {
+			e.deleteRange(e.pos-1, e.pos)
+		}
+	case "\x1b[3~": // Delete
+		e.deleteRange(e.pos, e.pos+1)
+	case "\x01", "\x1b[H", "\x1bOH", "\x1b[1~": // Ctrl+A, Home
+		e.pos = 0
+	case "\x05", "\x1b[F", "\x1bOF", "\x1b[4~": // Ctrl+E, End
+		e.pos = len(e.buf)
+	case "\x02", "\x1b[D", "\x1bOD": // Ctrl+B, стрелка влево
+		if e.pos > 0 {
+			e.pos--
+		}
+	case "\x06", "\x1b[C", "\x1bOC": // Ctrl+F, стрелка вправо
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case "\x1bb", "\x1b[1;5D": // Alt+B, Ctrl+стрелка влево
+		e.pos = e.wordLeft()
+	case "\x1bf", "\x1b[1;5C": // Alt+F, Ctrl+стрелка вправо
+		e.pos = e.wordRight()
+	case "\x10", "\x1b[A", "\x1bOA": // Ctrl+P, стрелка вверх
+		e.showHistory(e.histPos - 1)
+	case "\x0e", "\x1b[B", "\x1bOB": // Ctrl+N, стрелка вниз
+		e.showHistory(e.histPos + 1)
+	case "\x0b": // Ctrl+K
+		e.deleteRange(e.pos, len(e.buf))
+	case "\x15": // Ctrl+U
+		e.deleteRange(0, e.pos)
+	case "\x17": // Ctrl+W
+		e.deleteRange(e.wordLeft(), e.pos)
+	case "\x0c": // Ctrl+L
+		e.write("\x1b[H\x1b[2J")
+	case "\x12": // Ctrl+R
+		return e.search()
+	case "\t":
+		e.complete()
+	default:
+		r, _ := utf8.DecodeRuneInString(key)
+		if len(key) == utf8.RuneLen(r) && unicode.IsPrint(r) {
+			e.insert([]rune(key))
+		}
+	}
+
+	e.refresh()
+	return false, nil
+}
+
+func (e *lineEditor) write(s string) {
+	io.WriteString(e.out, s)
+}
+
+func (e *lineEditor) insert(runes []rune) {
+	buf := make([]rune, 0, len(e.buf)+len(runes))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, runes...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(runes)
+}
+
+// deleteRange удаляет символы [from, to) и ставит курсор на from.
+func (e *lineEditor) deleteRange(from int, to int) {
+	if to > len(e.buf) {
+		to = len(e.buf)
+	}
+	if from >= to {
+		return
+	}
+
+	e.buf = append(e.buf[:from:from], e.buf[to:]...)
+	e.pos = from
+}
+
+// wordLeft возвращает начало слова слева от курсора.
+func (e *lineEditor) wordLeft() int {
+	pos := e.pos
+	for pos > 0 && unicode.IsSpace(e.buf[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !unicode.IsSpace(e.buf[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// wordRight возвращает конец слова справа от курсора.
+func (e *lineEditor) wordRight() int {
+	pos := e.pos
+	for pos < len(e.buf) && unicode.IsSpace(e.buf[pos]) {
+		pos++
+	}
+	for pos < len(e.buf) && !unicode.IsSpace(e.buf[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// showHistory показывает команду истории i. За последней командой следует
+// строка, которую набирали до перехода к истории.
+func (e *lineEditor) showHistory(i int) {
+	entries := e.history.entries
+	if i < 0 || i > len(entries) {
+		return
+	}
+
+	if e.histPos == len(entries) {
+		e.saved = e.buf
+	}
+
+	e.histPos = i
+	if i == len(entries) {
+		e.buf = e.saved
+	} else {
+		e.buf = []rune(entries[i])
+	}
+	e.pos = len(e.buf)
+}
+
+// search - обратный поиск по истории (Ctrl+R): по мере набора показывается
+// самая новая команда, содержащая строку поиска, а повторный Ctrl+R ищет
+// среди более старых. Enter выполняет найденную команду, Ctrl+G отменяет
+// поиск, остальные клавиши оставляют ее для редактирования.
+func (e *lineEditor) search() (bool, error) {
+	entries := e.history.entries
+	savedBuf, savedPos := e.buf, e.pos
+	query := []rune{}
+	match := len(entries)
+	failed := false
+
+	// find ищет команду с запросом, начиная с from и дальше к старым.
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if i >= len(entries) {
+				continue
+			}
+			if idx := strings.Index(entries[i], string(query)); idx >= 0 {
+				match, failed = i, false
+				e.buf = []rune(entries[i])
+				e.pos = utf8.RuneCountInString(entries[i][:idx])
+				return
+			}
+		}
+		failed = true
+	}
+
+	for {
+		prompt := "(reverse-i-search)`" + string(query) + "': "
+		if failed {
+			prompt = "(failed " + prompt[1:]
+		}
+		e.refreshLine(prompt)
+
+		key, err := e.readKey()
+		if err != nil {
+			return true, err
+		}
+
+		switch key {
+		case "\x12":
+			find(match - 1)
+		case "\x7f", "\x08":
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(entries) - 1)
+			}
+		case "\x07": // Ctrl+G
+			e.buf, e.pos = savedBuf, savedPos
+			e.refresh()
+			return false, nil
+		default:
+			r, _ := utf8.DecodeRuneInString(key)
+			if len(key) == utf8.RuneLen(r) && unicode.IsPrint(r) {
+				query = append(query, r)
+				find(match)
+				continue
+			}
+
+			e.histPos = len(entries)
+			return e.handle(key)
+		}
+	}
+}
+
+// complete дополняет слово под курсором. Если вариантов несколько, слово
+// дополняется до их общего начала, а второй Tab подряд выводит их список.
+func (e *lineEditor) complete() {
+	line := string(e.buf[:e.pos])
+	start, matches := e.opts.completions(line)
+	if len(matches) == 0 {
+		e.write("\a")
+		return
+	}
+
+	word := line[start:]
+	replacement := commonPrefix(matches)
+	if len(matches) == 1 && !strings.HasSuffix(replacement, "/") {
+		replacement += " "
+	}
+
+	if replacement != word && strings.HasPrefix(replacement, word) || len(matches) == 1 {
+		from := utf8.RuneCountInString(line[:start])
+		e.deleteRange(from, e.pos)
+		e.insert([]rune(replacement))
+		return
+	}
+
+	if e.lastKey != "\t" {
+		e.write("\a")
+		return
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		name := strings.TrimSuffix(match, "/")
+		name = match[strings.LastIndex(name, "/")+1:]
+		names = append(names, name)
+	}
+	e.write("\n" + strings.Join(names, "  ") + "\n")
+}
+
+func (e *lineEditor) refresh() {
+	e.refreshLine(e.prompt)
+}
+
+// csiRe - управляющие последовательности, которые не занимают места на
+// экране, например цвета в приглашении.
+var csiRe = regexp.MustCompile("\x1b\\[[0-9;?]*[@-~]")
+
+// refreshLine перерисовывает строку с приглашением prompt.
+func (e *lineEditor) refreshLine(prompt string) {
+	width := termWidth(e.in)
+	promptWidth := utf8.RuneCountInString(csiRe.ReplaceAllString(prompt, ""))
+
+	avail := width - promptWidth - 1
+	if avail < 1 {
+		avail = 1
+	}
+
+	start := 0
+	if e.pos > avail {
+		start = e.pos - avail
+	}
+	end := len(e.buf)
+	if end-start > avail {
+		end = start + avail
+	}
+
+	var b strings.Builder
+	b.WriteString("\r" + prompt + string(e.buf[start:end]) + "\x1b[K\r")
+	if col := promptWidth + e.pos - start; col > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", col)
+	}
+	e.write(b.String())
+}
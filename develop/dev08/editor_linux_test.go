@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPty открывает псевдотерминал и возвращает его ведущую и ведомую
+// стороны.
+func openPty(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("pseudo-terminals are not available:", err)
+	}
+
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		t.Fatal(err)
+	}
+
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		t.Fatal(err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Широкий экран, чтобы строки в тесте не прокручивались.
+	size := struct{ rows, cols, xpixel, ypixel uint16 }{rows: 50, cols: 500}
+	if err := ioctl(slave, syscall.TIOCSWINSZ, unsafe.Pointer(&size)); err != nil {
+		t.Fatal(err)
+	}
+
+	return master, slave
+}
+
+// terminal - пользователь за псевдотерминалом: нажимает клавиши и ждет
+// вывода.
+type terminal struct {
+	t      *testing.T
+	master *os.File
+	mu     sync.Mutex
+	output bytes.Buffer
+	// mark - начало вывода, который еще не проверялся.
+	mark int
+}
+
+func newTerminal(t *testing.T, master *os.File) *terminal {
+	term := &terminal{t: t, master: master}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			term.mu.Lock()
+			term.output.Write(buf[:n])
+			term.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return term
+}
+
+func (term *terminal) send(keys string) {
+	term.t.Helper()
+	if _, err := term.master.Write([]byte(keys)); err != nil {
+		term.t.Fatal(err)
+	}
+}
+
+// expect ждет, пока в новом выводе появится s.
+func (term *terminal) expect(s string) {
+	term.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		term.mu.Lock()
+		output := term.output.String()[term.mark:]
+		term.mu.Unlock()
+
+		if i := strings.Index(output, s); i >= 0 {
+			term.mark += i + len(s)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	term.mu.Lock()
+	defer term.mu.Unlock()
+	term.t.Fatalf("output does not contain %q:\n%q", s, term.output.String()[term.mark:])
+}
+
+func TestLineEditor(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.WriteFile(filepath.Join(home, "uniquefile.txt"), []byte("content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	master, slave := openPty(t)
+	defer master.Close()
+	term := newTerminal(t, master)
+
+	done := make(chan Status, 1)
+	go func() {
+		done <- do(slave, slave, slave, new(options))
+		slave.Close()
+	}()
+
+	// Приглашение выводится уже в посимвольном режиме.
+	line := func(keys string) {
+		t.Helper()
+		term.expect("$ ")
+		term.send(keys)
+	}
+
+	line("echo wrld\x1b[D\x1b[D\x1b[Do\r")
+	term.expect("world\r\n")
+
+	line("echo other\x01\x06\x06\x06\x06\x0b\r")
+	term.expect("\r\n\r\n")
+
+	line("echo other\r")
+	term.expect("other\r\n")
+
+	// Выше самой старой команды подняться нельзя.
+	line("\x1b[A\x1b[A\x1b[A\x1b[A\x1b[B\x1b[A\r")
+	term.expect("world\r\n")
+
+	line("\x12wor")
+	term.expect("(reverse-i-search)`wor': echo world")
+	term.send("\r")
+	term.expect("world\r\n")
+
+	line("\x12oth\x07echo cancelled\r")
+	term.expect("cancelled\r\n")
+
+	line("ech\t")
+	term.expect("echo ")
+	term.send("completed\r")
+	term.expect("completed\r\n")
+
+	line("cat " + home + "/uniq\t\r")
+	term.expect("content\r\n")
+
+	line("echo interrupted\x03")
+	term.expect("^C")
+	line("echo $?\r")
+	term.expect("130\r\n")
+
+	line("\x04")
+	select {
+	case status := <-done:
+		if !status.exit || status.code != 0 {
+			t.Errorf("status == %+v; want exit 0", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shell did not exit on Ctrl+D")
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".wbsh_history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"echo",
+		"echo other",
+		"echo world",
+		"echo cancelled",
+		"echo completed",
+		"cat " + home + "/uniquefile.txt ",
+		"echo $?",
+	}
+	if got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("history == %q; want %q", got, want)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("a\nb\na\nc\n\nd\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := loadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c", "d"}; !reflect.DeepEqual(h.entries, want) {
+		t.Errorf("entries == %q; want %q", h.entries, want)
+	}
+
+	for _, line := range []string{"c", " secret", "", "e"} {
+		if err := h.add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d\nc\ne\n"; string(data) != want {
+		t.Errorf("history file == %q; want %q", data, want)
+	}
+}
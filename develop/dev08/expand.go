@@ -0,0 +1,725 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrBadSubstitution = errors.New("bad substitution")
+var ErrParameterNotSet = errors.New("parameter null or not set")
+var ErrCannotAssign = errors.New("cannot assign in this way")
+
+// defaultIFS - разделители полей, если переменная IFS не задана.
+const defaultIFS = " \t\n"
+
+// expander раскрывает одно слово команды: заменяет "~" домашним каталогом,
+// подставляет параметры, разбивает результаты подстановок без кавычек на поля
+// и удаляет кавычки. Встроенные и внешние команды получают одинаково
+// раскрытые аргументы.
+type expander struct {
+	opts *options
+	src  string
+	pos  int
+
+	fields []string
+	cur    strings.Builder
+	// globs - шаблоны для раскрытия имен файлов по полю на каждое из
+	// fields, glob - шаблон текущего поля: символы шаблона из кавычек и
+	// подстановки "~" в нем экранированы.
+	globs []string
+	glob  strings.Builder
+	// set - текущее поле существует, даже если оно пустое: "" и '' дают
+	// пустой аргумент, а пустая подстановка без кавычек - нет.
+	set bool
+	// split - разбивать результаты подстановок без кавычек по IFS.
+	split bool
+	// pattern - результат будет шаблоном: символы шаблона из кавычек
+	// экранируются.
+	pattern bool
+	// dropEmpty - "$@" без параметров: пустое поле из кавычек вокруг него не
+	// остается.
+	dropEmpty bool
+	ifs       string
+	// tilde - раскрывать "~" в начале слова, assign - еще и после ":", как
+	// в значении присваивания PATH=~/bin:~/.local/bin.
+	tilde  bool
+	assign bool
+	// heredoc - раскрывается тело here-документа: как в двойных кавычках,
+	// но '"' - обычный символ.
+	heredoc bool
+	// s - потоки команды: подстановки команд читают ее stdin и пишут
+	// ошибки в ее stderr.
+	s streams
+}
+
+func (opts *options) newExpander(word string, s streams) *expander {
+	ifs, ok := opts.getVar("IFS")
+	if !ok {
+		ifs = defaultIFS
+	}
+	return &expander{opts: opts, src: word, ifs: ifs, tilde: true, s: s}
+}
+
+// expandWords раскрывает слова команды в аргументы: фигурные скобки, затем
+// подстановки и разбиение на поля, затем имена файлов.
+func (opts *options) expandWords(words []string, s streams) ([]string, error) {
+	res := []string{}
+	for _, word := range words {
+		for _, word := range expandBraces(word) {
+			e := opts.newExpander(word, s)
+			e.split = true
+			if err := e.expand(); err != nil {
+				return nil, err
+			}
+
+			for i, field := range e.fields {
+				names, err := opts.pathnames(field, e.globs[i])
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, names...)
+			}
+		}
+	}
+	return res, nil
+}
+
+// declarationBuiltins - встроенные команды, аргументы которых вида
+// name=value раскрываются как присваивания: export PATH=~/bin:$PATH.
+var declarationBuiltins = map[string]bool{
+	"export": true,
+	"local":  true,
+}
+
+// expandCommand раскрывает слова простой команды. Как в bash, аргументы
+// export и local вида name=value раскрываются как присваивания: с заменой
+// "~" после "=" и ":" и без разбиения на поля.
+func (opts *options) expandCommand(words []string, s streams) ([]string, error) {
+	if len(words) == 0 || !declarationBuiltins[words[0]] {
+		return opts.expandWords(words, s)
+	}
+
+	res := []string{words[0]}
+	for _, word := range words[1:] {
+		name, value, ok := strings.Cut(word, "=")
+		if !ok || !isName(name) {
+			fields, err := opts.expandWords([]string{word}, s)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, fields...)
+			continue
+		}
+
+		value, err := opts.expandAssignment(value, s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, name+"="+value)
+	}
+	return res, nil
+}
+
+// expandString раскрывает слово без разбиения на поля, как значение в
+// присваивании.
+func (opts *options) expandString(word string, s streams) (string, error) {
+	e := opts.newExpander(word, s)
+	if err := e.expand(); err != nil {
+		return "", err
+	}
+	return strings.Join(e.fields, " "), nil
+}
+
+// expandAssignment раскрывает значение присваивания: без разбиения на поля,
+// с заменой "~" и после каждого ":".
+func (opts *options) expandAssignment(value string, s streams) (string, error) {
+	e := opts.newExpander(value, s)
+	e.assign = true
+	if err := e.expand(); err != nil {
+		return "", err
+	}
+	return strings.Join(e.fields, " "), nil
+}
+
+// expandHeredoc раскрывает тело here-документа: подставляет параметры,
+// команды и арифметические выражения без разбиения на поля.
+func (opts *options) expandHeredoc(body string, s streams) (string, error) {
+	e := opts.newExpander(body, s)
+	e.heredoc = true
+	if err := e.doubleQuoted(); err != nil {
+		return "", err
+	}
+	e.endField(true)
+	return strings.Join(e.fields, " "), nil
+}
+
+// expandPattern раскрывает слово в шаблон: символы шаблона в кавычках
+// совпадают буквально.
+func (opts *options) expandPattern(word string, s streams) (string, error) {
+	e := opts.newExpander(word, s)
+	e.pattern = true
+	if err := e.expand(); err != nil {
+		return "", err
+	}
+	return strings.Join(e.fields, " "), nil
+}
+
+func (e *expander) expand() error {
+	for e.pos < len(e.src) {
+		c := e.src[e.pos]
+		if c == '~' && e.tilde && (e.pos == 0 || e.assign && e.src[e.pos-1] == ':') && e.tildePrefix() {
+			continue
+		}
+
+		switch c {
+		case '\\':
+			e.pos++
+			// "\" и перевод строки - продолжение строки, они удаляются.
+			if e.pos < len(e.src) && e.src[e.pos] != '\n' {
+				e.literal(e.src[e.pos:e.pos+1], true)
+			}
+			if e.pos < len(e.src) {
+				e.pos++
+			}
+		case '\'':
+			end := strings.IndexByte(e.src[e.pos+1:], '\'')
+			if end < 0 {
+				end = len(e.src) - e.pos - 1
+			}
+			e.set = true
+			e.literal(e.src[e.pos+1:e.pos+1+end], true)
+			e.pos += end + 2
+		case '"':
+			e.pos++
+			e.set = true
+			if err := e.doubleQuoted(); err != nil {
+				return err
+			}
+		case '$':
+			if err := e.dollar(false); err != nil {
+				return err
+			}
+		case '`':
+			if err := e.backquoted(false); err != nil {
+				return err
+			}
+		default:
+			e.literal(e.src[e.pos:e.pos+1], false)
+			e.pos++
+		}
+	}
+
+	e.endField(false)
+	return nil
+}
+
+// tildePrefix раскрывает "~", "~+", "~-" или "~user" до первого "/".
+// Возвращает false, если префикс в кавычках или каталог неизвестен: тогда
+// "~" остается как есть.
+func (e *expander) tildePrefix() bool {
+	end := e.pos + 1
+	for end < len(e.src) && e.src[end] != '/' && !(e.assign && e.src[end] == ':') {
+		if strings.IndexByte("'\"\\$`", e.src[end]) >= 0 {
+			return false
+		}
+		end++
+	}
+
+	dir, ok := e.opts.tildeDir(e.src[e.pos+1 : end])
+	if !ok {
+		return false
+	}
+
+	e.literal(dir, true)
+	e.set = true
+	e.pos = end
+	return true
+}
+
+func (e *expander) doubleQuoted() error {
+	for e.pos < len(e.src) {
+		switch c := e.src[e.pos]; c {
+		case '"':
+			if e.heredoc {
+				e.literal(`"`, true)
+				e.pos++
+				continue
+			}
+			e.pos++
+			return nil
+		case '\\':
+			// В двойных кавычках "\" экранирует только $ ` " \ и перевод строки,
+			// а в here-документе - и не экранирует '"'.
+			escaped := "$`\"\\\n"
+			if e.heredoc {
+				escaped = "$`\\\n"
+			}
+			if e.pos+1 < len(e.src) && strings.IndexByte(escaped, e.src[e.pos+1]) >= 0 {
+				if e.src[e.pos+1] != '\n' {
+					e.literal(e.src[e.pos+1:e.pos+2], true)
+				}
+				e.pos += 2
+				continue
+			}
+			e.literal(`\`, true)
+			e.pos++
+		case '$':
+			if err := e.dollar(true); err != nil {
+				return err
+			}
+		case '`':
+			if err := e.backquoted(true); err != nil {
+				return err
+			}
+		default:
+			e.literal(e.src[e.pos:e.pos+1], true)
+			e.pos++
+		}
+	}
+
+	return nil
+}
+
+// literal добавляет текст к текущему полю без разбиения.
+func (e *expander) literal(s string, quoted bool) {
+	if quoted && e.pattern {
+		s = escapePattern(s)
+	}
+	e.cur.WriteString(s)
+	if e.split {
+		if quoted {
+			e.glob.WriteString(escapePattern(s))
+		} else {
+			e.glob.WriteString(s)
+		}
+	}
+	if s != "" {
+		e.set = true
+	}
+}
+
+// endField завершает текущее поле. Пустое поле остается, только если оно
+// задано кавычками или force.
+func (e *expander) endField(force bool) {
+	if e.dropEmpty && e.cur.Len() == 0 {
+		e.set = false
+	}
+	if e.set || force {
+		e.fields = append(e.fields, e.cur.String())
+		e.globs = append(e.globs, e.glob.String())
+	}
+	e.cur.Reset()
+	e.glob.Reset()
+	e.set = false
+	e.dropEmpty = false
+}
+
+// value добавляет результат подстановки: в кавычках - как есть, без кавычек -
+// с разбиением на поля по IFS.
+func (e *expander) value(s string, quoted bool) {
+	if quoted || !e.split {
+		e.literal(s, quoted)
+		return
+	}
+
+	// Пробельные разделители сливаются, остальные разделяют поля по одному:
+	// "a::b" при IFS=":" дает три поля.
+	afterSpace := false
+	for _, r := range s {
+		if !strings.ContainsRune(e.ifs, r) {
+			// Символы шаблона из подстановок без кавычек раскрываются.
+			e.cur.WriteRune(r)
+			e.glob.WriteRune(r)
+			e.set = true
+			afterSpace = false
+			continue
+		}
+
+		if strings.ContainsRune(defaultIFS, r) {
+			if e.set {
+				e.endField(false)
+				afterSpace = true
+			}
+			continue
+		}
+
+		if !afterSpace {
+			e.endField(true)
+		}
+		afterSpace = false
+	}
+}
+
+// dollar раскрывает подстановку, начинающуюся с "$".
+func (e *expander) dollar(quoted bool) error {
+	e.pos++
+	if e.pos >= len(e.src) {
+		e.literal("$", quoted)
+		return nil
+	}
+
+	c := e.src[e.pos]
+	switch {
+	case c == '(':
+		if strings.HasPrefix(e.src[e.pos:], "((") {
+			if ok, err := e.arithmetic(quoted); ok || err != nil {
+				return err
+			}
+		}
+		return e.substitution(quoted)
+	case c == '{':
+		return e.braced(quoted)
+	case c == '@' || c == '*':
+		e.pos++
+		e.positional(c, quoted)
+		return nil
+	case isDigit(c) || strings.IndexByte("?!$#-", c) >= 0:
+		e.pos++
+		return e.param(string(c), quoted)
+	case c == '_' || isLetter(c):
+		start := e.pos
+		for e.pos < len(e.src) && (e.src[e.pos] == '_' || isLetter(e.src[e.pos]) || isDigit(e.src[e.pos])) {
+			e.pos++
+		}
+		return e.param(e.src[start:e.pos], quoted)
+	}
+
+	// "$" без имени остается как есть.
+	e.literal("$", quoted)
+	return nil
+}
+
+// param подставляет значение параметра. С "set -u" незаданный параметр -
+// ошибка.
+func (e *expander) param(name string, quoted bool) error {
+	v, ok := e.opts.param(name)
+	if !ok && e.opts.nounset {
+		return fmt.Errorf("%s: %w", name, ErrUnboundVariable)
+	}
+	e.value(v, quoted)
+	return nil
+}
+
+// arithmetic раскрывает $((выражение)): выражение раскрывается как в
+// двойных кавычках и вычисляется. Возвращает false, если внутренние скобки
+// не закрываются вместе с внешними, как в $((a) | (b)): это подстановка
+// команды.
+func (e *expander) arithmetic(quoted bool) (bool, error) {
+	outer := &lexer{src: e.src, pos: e.pos}
+	inner := &lexer{src: e.src, pos: e.pos + 1}
+	if outer.scanNested('(', ')') != nil || inner.scanNested('(', ')') != nil || inner.pos != outer.pos-1 {
+		return false, nil
+	}
+
+	// "~" в выражении - побитовое отрицание.
+	x := e.opts.newExpander(e.src[e.pos+2:outer.pos-2], e.s)
+	x.tilde = false
+	if err := x.expand(); err != nil {
+		return true, err
+	}
+	expr := strings.Join(x.fields, " ")
+	e.pos = outer.pos
+
+	v, err := e.opts.evalArith(expr)
+	if err != nil {
+		return true, err
+	}
+
+	e.value(strconv.FormatInt(v, 10), quoted)
+	return true, nil
+}
+
+// substitution раскрывает $(команды).
+func (e *expander) substitution(quoted bool) error {
+	lx := &lexer{src: e.src, pos: e.pos}
+	if err := lx.scanSubstitution(); err != nil {
+		return fmt.Errorf("%s: %w", e.src[e.pos-1:], ErrBadSubstitution)
+	}
+
+	body := e.src[e.pos+1 : lx.pos-1]
+	e.pos = lx.pos
+	return e.substitute(body, quoted)
+}
+
+// backquoted раскрывает `команды`. Внутри обратных кавычек "\" экранирует
+// только $ ` \ и, если сама подстановка в двойных кавычках, ".
+func (e *expander) backquoted(quoted bool) error {
+	lx := &lexer{src: e.src, pos: e.pos}
+	if err := lx.scanBackquoted(); err != nil {
+		return fmt.Errorf("%s: %w", e.src[e.pos:], ErrBadSubstitution)
+	}
+
+	raw := e.src[e.pos+1 : lx.pos-1]
+	e.pos = lx.pos
+
+	var body strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '\\' && i+1 < len(raw) && (strings.IndexByte("$`\\", raw[i+1]) >= 0 || quoted && raw[i+1] == '"') {
+			i++
+		}
+		body.WriteByte(raw[i])
+	}
+
+	return e.substitute(body.String(), quoted)
+}
+
+func (e *expander) substitute(src string, quoted bool) error {
+	out, err := e.opts.substitute(src, e.s)
+	if err != nil {
+		return err
+	}
+
+	e.value(out, quoted)
+	return nil
+}
+
+// substitute выполняет команды подстановки в подоболочке и возвращает их
+// вывод без завершающих переводов строки. Вывод читается из канала до конца,
+// поэтому подстановка ждет и запущенные в ней фоновые процессы.
+func (opts *options) substitute(src string, s streams) (string, error) {
+	list, err := opts.parse(src)
+	if err != nil {
+		return "", err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	output := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(r)
+		r.Close()
+		output <- data
+	}()
+
+	sub := opts.subshell()
+	if sub.job != nil && !sub.job.background {
+		sub.job = nil
+	}
+	status := list.exec(sub, streams{stdin: s.stdin, stdout: w, stderr: s.stderr})
+	w.Close()
+	data := <-output
+
+	if status.exit && status.err != nil {
+		return "", status.err
+	}
+
+	// $? после подстановки - ее код возврата.
+	opts.lastCmdCode = status.code
+	opts.substitutions++
+	return strings.TrimRight(string(data), "\n"), nil
+}
+
+// positional раскрывает $@ и $*. "$@" дает по полю на каждый параметр, "$*" -
+// одно поле, где параметры разделены первым символом IFS.
+func (e *expander) positional(c byte, quoted bool) {
+	args := e.opts.args
+	if !quoted {
+		for _, arg := range args {
+			e.value(arg, false)
+			e.endField(false)
+		}
+		return
+	}
+
+	if c == '*' || !e.split {
+		sep := " "
+		if c == '*' {
+			sep = ""
+			if e.ifs != "" {
+				sep = e.ifs[:1]
+			}
+		}
+		e.literal(strings.Join(args, sep), true)
+		e.set = true
+		return
+	}
+
+	// "$@" без параметров не дает ни одного поля.
+	if len(args) == 0 && e.cur.Len() == 0 {
+		e.dropEmpty = true
+	}
+
+	for i, arg := range args {
+		if i > 0 {
+			e.endField(true)
+		}
+		e.literal(arg, true)
+		e.set = true
+	}
+}
+
+// braced раскрывает ${...}: ${NAME}, ${#NAME}, ${NAME:-word}, ${NAME:=word},
+// ${NAME:?word}, ${NAME:+word} (без ":" - только для неустановленных
+// переменных), ${NAME%pattern}, ${NAME%%pattern}, ${NAME#pattern} и
+// ${NAME##pattern}.
+func (e *expander) braced(quoted bool) error {
+	start := e.pos - 1
+	end := matchingBrace(e.src, e.pos+1)
+	if end < 0 {
+		return fmt.Errorf("%s: %w", e.src[start:], ErrBadSubstitution)
+	}
+
+	body := e.src[e.pos+1 : end]
+	e.pos = end + 1
+	bad := fmt.Errorf("%s: %w", e.src[start:e.pos], ErrBadSubstitution)
+
+	length := false
+	if len(body) > 1 && body[0] == '#' {
+		length = true
+		body = body[1:]
+	}
+
+	name := paramName(body)
+	if name == "" {
+		return bad
+	}
+
+	rest, op, word := body[len(name):], "", ""
+	if rest != "" {
+		for _, prefix := range []string{":-", ":=", ":?", ":+", "%%", "##", "-", "=", "?", "+", "%", "#"} {
+			if strings.HasPrefix(rest, prefix) {
+				op, word = prefix, rest[len(prefix):]
+				break
+			}
+		}
+
+		if op == "" || length {
+			return bad
+		}
+	}
+
+	value, set := e.opts.param(name)
+	if name == "@" || name == "*" {
+		set = len(e.opts.args) > 0
+	} else if !set && e.opts.nounset && !strings.ContainsAny(op, "-=?+") {
+		return fmt.Errorf("%s: %w", name, ErrUnboundVariable)
+	}
+
+	if length {
+		e.value(fmt.Sprint(utf8.RuneCountInString(value)), quoted)
+		return nil
+	}
+
+	// С ":" пустое значение считается отсутствующим.
+	missing := !set || (strings.HasPrefix(op, ":") && value == "")
+
+	switch strings.TrimPrefix(op, ":") {
+	case "":
+		if name == "@" || name == "*" {
+			e.positional(name[0], quoted)
+			return nil
+		}
+	case "-":
+		if missing {
+			v, err := e.opts.expandString(word, e.s)
+			if err != nil {
+				return err
+			}
+			value = v
+		}
+	case "=":
+		if missing {
+			v, err := e.opts.expandString(word, e.s)
+			if err != nil {
+				return err
+			}
+			if !isName(name) {
+				return fmt.Errorf("$%s: %w", name, ErrCannotAssign)
+			}
+			if err := e.opts.setVar(name, v); err != nil {
+				return err
+			}
+			value = v
+		}
+	case "?":
+		if missing {
+			msg, err := e.opts.expandString(word, e.s)
+			if err != nil {
+				return err
+			}
+			if msg == "" {
+				return fmt.Errorf("%s: %w", name, ErrParameterNotSet)
+			}
+			return fmt.Errorf("%s: %s", name, msg)
+		}
+	case "+":
+		value = ""
+		if !missing {
+			v, err := e.opts.expandString(word, e.s)
+			if err != nil {
+				return err
+			}
+			value = v
+		}
+	default:
+		pattern, err := e.opts.expandPattern(word, e.s)
+		if err != nil {
+			return err
+		}
+		suffix := op[0] == '%'
+		value = trimPattern(value, pattern, suffix, len(op) == 2)
+	}
+
+	e.value(value, quoted)
+	return nil
+}
+
+// paramName возвращает имя параметра в начале тела ${...}.
+func paramName(body string) string {
+	if body == "" {
+		return ""
+	}
+
+	switch c := body[0]; {
+	case strings.IndexByte("?!$#@*-", c) >= 0:
+		return body[:1]
+	case isDigit(c):
+		i := 1
+		for i < len(body) && isDigit(body[i]) {
+			i++
+		}
+		return body[:i]
+	}
+
+	i := 0
+	for i < len(body) && (body[i] == '_' || isLetter(body[i]) || (i > 0 && isDigit(body[i]))) {
+		i++
+	}
+	return body[:i]
+}
+
+// matchingBrace возвращает индекс "}", закрывающей подстановку, тело которой
+// начинается с pos, с учетом кавычек и вложенных подстановок.
+func matchingBrace(s string, pos int) int {
+	depth := 0
+	for i := pos; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return -1
+			}
+			i += end + 1
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
@@ -0,0 +1,410 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrNoMatch = errors.New("no match")
+var ErrInvalidShopt = errors.New("invalid shell option name")
+
+// shoptNames - настройки, которые меняет shopt.
+var shoptNames = []string{"dotglob", "failglob", "globstar", "nullglob"}
+
+// shoptOption возвращает настройку shopt по имени или nil, если такой нет.
+func (opts *options) shoptOption(name string) *bool {
+	switch name {
+	case "dotglob":
+		return &opts.dotglob
+	case "failglob":
+		return &opts.failglob
+	case "globstar":
+		return &opts.globstar
+	case "nullglob":
+		return &opts.nullglob
+	}
+	return nil
+}
+
+// expandBraces раскрывает фигурные скобки в слове: "a{b,c}d" дает "abd" и
+// "acd", "{1..3}" - "1", "2" и "3". Скобки в кавычках, в подстановках "${...}"
+// и без запятой или последовательности внутри остаются как есть.
+func expandBraces(word string) []string {
+	lx := &lexer{src: word}
+	for lx.pos < len(word) {
+		if word[lx.pos] == '{' {
+			if parts, end, ok := braceParts(word, lx.pos); ok {
+				res := []string{}
+				for _, part := range parts {
+					res = append(res, expandBraces(word[:lx.pos]+part+word[end+1:])...)
+				}
+				return res
+			}
+			lx.pos++
+			continue
+		}
+
+		if err := lx.scanUnit(); err != nil {
+			break
+		}
+	}
+
+	return []string{word}
+}
+
+// braceParts разбирает скобки, начинающиеся в word с start: возвращает
+// варианты и индекс закрывающей скобки. ok == false, если скобки не
+// раскрываются.
+func braceParts(word string, start int) (parts []string, end int, ok bool) {
+	lx := &lexer{src: word, pos: start + 1}
+	depth := 0
+	from := lx.pos
+	for lx.pos < len(word) {
+		switch word[lx.pos] {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+				break
+			}
+
+			if parts == nil {
+				parts, ok = braceSequence(word[start+1 : lx.pos])
+				return parts, lx.pos, ok
+			}
+			return append(parts, word[from:lx.pos]), lx.pos, true
+		case ',':
+			if depth == 0 {
+				parts = append(parts, word[from:lx.pos])
+				from = lx.pos + 1
+			}
+		default:
+			if err := lx.scanUnit(); err != nil {
+				return nil, 0, false
+			}
+			continue
+		}
+		lx.pos++
+	}
+
+	return nil, 0, false
+}
+
+// braceSequence раскрывает последовательность "X..Y" или "X..Y..STEP", где X
+// и Y - целые числа или одиночные буквы. Если одно из чисел начинается с
+// нуля, числа дополняются нулями до одинаковой ширины.
+func braceSequence(body string) ([]string, bool) {
+	bounds := strings.Split(body, "..")
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil, false
+	}
+
+	step := int64(1)
+	if len(bounds) == 3 {
+		n, err := strconv.ParseInt(bounds[2], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		if n < 0 {
+			n = -n
+		}
+		if n != 0 {
+			step = n
+		}
+	}
+
+	first, firstErr := strconv.ParseInt(bounds[0], 10, 64)
+	last, lastErr := strconv.ParseInt(bounds[1], 10, 64)
+	letters := false
+	switch {
+	case firstErr == nil && lastErr == nil:
+	case len(bounds[0]) == 1 && len(bounds[1]) == 1 && isLetter(bounds[0][0]) && isLetter(bounds[1][0]):
+		first, last, letters = int64(bounds[0][0]), int64(bounds[1][0]), true
+	default:
+		return nil, false
+	}
+
+	width := 0
+	if !letters {
+		for _, bound := range bounds[:2] {
+			digits := strings.TrimPrefix(bound, "-")
+			if len(digits) > 1 && digits[0] == '0' && len(bound) > width {
+				width = len(bound)
+			}
+		}
+	}
+
+	if first > last {
+		step = -step
+	}
+
+	parts := []string{}
+	for n := first; (step > 0 && n <= last) || (step < 0 && n >= last); n += step {
+		switch {
+		case letters:
+			// Между "Z" и "a" есть символы, особые для шелла.
+			parts = append(parts, escapeWord(string(rune(n))))
+		case width > 0:
+			parts = append(parts, fmt.Sprintf("%0*d", width, n))
+		default:
+			parts = append(parts, strconv.FormatInt(n, 10))
+		}
+	}
+	return parts, true
+}
+
+// tildeDir возвращает каталог для префикса "~name": "" - домашний каталог,
+// "+" - текущий, "-" - предыдущий ($OLDPWD), иначе - домашний каталог
+// пользователя name. ok == false, если каталог неизвестен.
+func (opts *options) tildeDir(name string) (string, bool) {
+	switch name {
+	case "":
+		if home, ok := opts.getVar("HOME"); ok {
+			return home, true
+		}
+		return opts.homeDir, opts.homeDir != ""
+	case "+":
+		return opts.workDir, true
+	case "-":
+		return opts.getVar("OLDPWD")
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", false
+	}
+	return u.HomeDir, true
+}
+
+// hasGlobMeta сообщает, есть ли в шаблоне незаэкранированные "*", "?" или
+// закрытый класс "[...]".
+func hasGlobMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?':
+			return true
+		case '[':
+			if _, _, ok := matchClass(pattern[i:], 0); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unescapePattern убирает экранирование из шаблона без символов шаблона.
+func unescapePattern(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+// pathnames раскрывает поле в имена файлов по шаблону pattern. Если файлов
+// нет, поле остается как есть, с nullglob пропадает, а с failglob команда
+// не выполняется.
+func (opts *options) pathnames(field string, pattern string) ([]string, error) {
+	if opts.noglob || !hasGlobMeta(pattern) {
+		return []string{field}, nil
+	}
+
+	matches := opts.glob(pattern)
+	switch {
+	case len(matches) > 0:
+		return matches, nil
+	case opts.failglob:
+		return nil, fmt.Errorf("%w: %s", ErrNoMatch, field)
+	case opts.nullglob:
+		return nil, nil
+	}
+	return []string{field}, nil
+}
+
+// glob возвращает пути, совпадающие с шаблоном, по алфавиту. Шаблон
+// сопоставляется по частям между "/"; "*" не совпадает с "/", а имена,
+// начинающиеся с ".", совпадают, только если так начинается и шаблон. С
+// globstar часть "**" совпадает с любым числом вложенных каталогов.
+func (opts *options) glob(pattern string) []string {
+	paths := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		paths = []string{"/"}
+		pattern = strings.TrimLeft(pattern, "/")
+	}
+
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		last := i == len(parts)-1
+		next := []string{}
+		for _, p := range paths {
+			switch {
+			case part == "" && !last:
+				next = append(next, p)
+			case part == "":
+				// "dir/*/" - только каталоги.
+				if info, err := os.Stat(opts.path(p)); err == nil && info.IsDir() {
+					next = append(next, p+"/")
+				}
+			case part == "**" && opts.globstar:
+				if !last {
+					next = append(next, p)
+				}
+				next = append(next, opts.globTree(p, !last)...)
+			case !hasGlobMeta(part):
+				name := joinPath(p, unescapePattern(part))
+				if _, err := os.Lstat(opts.path(name)); err == nil {
+					next = append(next, name)
+				}
+			default:
+				next = append(next, opts.globDir(p, part)...)
+			}
+		}
+		paths = next
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// globDir возвращает файлы каталога dir, имена которых совпадают с частью
+// шаблона part.
+func (opts *options) globDir(dir string, part string) []string {
+	entries, err := os.ReadDir(opts.path(dir))
+	if err != nil {
+		return nil
+	}
+
+	dot := strings.HasPrefix(part, ".") || strings.HasPrefix(part, `\.`)
+	res := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !dot && !opts.dotglob {
+			continue
+		}
+		if matchPattern(part, name) {
+			res = append(res, joinPath(dir, name))
+		}
+	}
+	return res
+}
+
+// globTree возвращает все файлы в каталоге dir и во вложенных каталогах, а
+// если dirsOnly - только каталоги. Символические ссылки на каталоги не
+// обходятся.
+func (opts *options) globTree(dir string, dirsOnly bool) []string {
+	entries, err := os.ReadDir(opts.path(dir))
+	if err != nil {
+		return nil
+	}
+
+	res := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !opts.dotglob {
+			continue
+		}
+
+		p := joinPath(dir, name)
+		if entry.IsDir() {
+			res = append(res, p)
+			res = append(res, opts.globTree(p, dirsOnly)...)
+		} else if !dirsOnly {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// joinPath добавляет имя к пути так, как его набрал бы пользователь: без
+// "./" для текущего каталога.
+func joinPath(dir string, name string) string {
+	if dir == "" {
+		return name
+	}
+	if strings.HasSuffix(dir, "/") {
+		return dir + name
+	}
+	return dir + "/" + name
+}
+
+// shopt включает (-s) и выключает (-u) настройки шелла или выводит их
+// состояние. С -q ничего не выводится, а код возврата сообщает, включены ли
+// все перечисленные настройки.
+func shopt(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	mode := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-s", "-u", "-q":
+			mode = args[0]
+		default:
+			return Status{code: 2, err: fmt.Errorf("shopt: %s: %w", args[0], ErrInvalidOption)}
+		}
+		args = args[1:]
+	}
+
+	for _, name := range args {
+		if opts.shoptOption(name) == nil {
+			return Status{code: 1, err: fmt.Errorf("shopt: %s: %w", name, ErrInvalidShopt)}
+		}
+	}
+
+	if len(args) > 0 && (mode == "-s" || mode == "-u") {
+		for _, name := range args {
+			*opts.shoptOption(name) = mode == "-s"
+		}
+		return Status{code: 0}
+	}
+
+	// Без имен выводятся все настройки, а с -s или -u - только включенные
+	// или выключенные.
+	if len(args) == 0 {
+		for _, name := range shoptNames {
+			on := *opts.shoptOption(name)
+			if mode == "-s" && !on || mode == "-u" && on {
+				continue
+			}
+			if pErr := printShopt(cmd, name, on); pErr != nil {
+				return Status{exit: true, code: 1, err: pErr}
+			}
+		}
+		return Status{code: 0}
+	}
+
+	status := Status{code: 0}
+	for _, name := range args {
+		on := *opts.shoptOption(name)
+		if !on {
+			status.code = 1
+		}
+		if mode == "-q" {
+			continue
+		}
+		if pErr := printShopt(cmd, name, on); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+	}
+	return status
+}
+
+func printShopt(cmd *CMD, name string, on bool) error {
+	state := "off"
+	if on {
+		state = "on"
+	}
+	_, err := fmt.Fprintf(cmd.stdout, "%-15s\t%s\n", name, state)
+	return err
+}
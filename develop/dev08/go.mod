@@ -1,5 +1,3 @@
 module dev08
 
-go 1.18
-
-require github.com/mattn/go-shellwords v1.0.12
+go 1.19
@@ -0,0 +1,327 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var ErrCommandNotFound = errors.New("command not found")
+
+// notFoundHandler - функция, которую шелл вызывает вместо программы, не
+// найденной в PATH.
+const notFoundHandler = "command_not_found_handle"
+
+// hashTable - пути программ, найденных в PATH, как в bash: при повторном
+// запуске программа не ищется заново. Таблица сбрасывается, когда меняется
+// PATH. Команды конвейера запускаются параллельно, поэтому доступ к таблице
+// защищен мьютексом.
+type hashTable struct {
+	mu sync.Mutex
+	// path - значение PATH, при котором найдены программы.
+	path    string
+	entries map[string]*hashEntry
+}
+
+type hashEntry struct {
+	file string
+	// hits - сколько раз программа запускалась по этому пути.
+	hits int
+}
+
+func newHashTable() *hashTable {
+	return &hashTable{entries: map[string]*hashEntry{}}
+}
+
+// clone возвращает копию таблицы для подоболочки.
+func (h *hashTable) clone() *hashTable {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := &hashTable{path: h.path, entries: make(map[string]*hashEntry, len(h.entries))}
+	for name, e := range h.entries {
+		copied := *e
+		res.entries[name] = &copied
+	}
+	return res
+}
+
+// sync сбрасывает таблицу, если PATH изменился. Вызывается под mu.
+func (h *hashTable) sync(path string) {
+	if path != h.path {
+		h.path = path
+		h.entries = map[string]*hashEntry{}
+	}
+}
+
+// hit возвращает запомненный путь к программе и считает запуск. Путь к
+// программе, которой уже нет, забывается.
+func (h *hashTable) hit(name string, path string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sync(path)
+
+	e, ok := h.entries[name]
+	if !ok {
+		return "", false
+	}
+	if !isExecutable(e.file) {
+		delete(h.entries, name)
+		return "", false
+	}
+	e.hits++
+	return e.file, true
+}
+
+// add запоминает путь к программе, найденной при данном PATH.
+func (h *hashTable) add(name string, path string, file string, hits int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sync(path)
+	h.entries[name] = &hashEntry{file: file, hits: hits}
+}
+
+// lookup возвращает запомненный путь без учета запуска.
+func (h *hashTable) lookup(name string, path string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sync(path)
+	e, ok := h.entries[name]
+	if !ok {
+		return "", false
+	}
+	return e.file, true
+}
+
+func (h *hashTable) remove(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.entries[name]
+	delete(h.entries, name)
+	return ok
+}
+
+func (h *hashTable) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = map[string]*hashEntry{}
+}
+
+// list возвращает копии записей таблицы, отсортированные по имени.
+func (h *hashTable) list(path string) ([]string, []hashEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sync(path)
+
+	names := make([]string, 0, len(h.entries))
+	for name := range h.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]hashEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, *h.entries[name])
+	}
+	return names, entries
+}
+
+// findCommand находит файл программы для запуска. Имя с "/" - путь к ней,
+// иначе она ищется в PATH, а найденный путь запоминается в таблице hash.
+// PATH из присваиваний перед командой действует только на этот запуск, и
+// таблица тогда не используется. Ошибка - ErrCommandNotFound или ошибка
+// файла: его нет, это каталог или он не исполняемый.
+func (opts *options) findCommand(prog string, assigns []string) (string, error) {
+	if strings.Contains(prog, "/") {
+		return prog, checkExecutable(prog, opts.path(prog))
+	}
+
+	path, _ := opts.getVar("PATH")
+	temp := false
+	for _, kv := range assigns {
+		if strings.HasPrefix(kv, "PATH=") {
+			path, temp = kv[len("PATH="):], true
+		}
+	}
+
+	if !temp {
+		if file, ok := opts.hash.hit(prog, path); ok {
+			return file, nil
+		}
+	}
+
+	file, err := searchFile(prog, path)
+	if err != nil {
+		return "", err
+	}
+	// Путь относительно текущего каталога устареет после cd.
+	if !temp && filepath.IsAbs(file) {
+		opts.hash.add(prog, path, file, 1)
+	}
+	return file, nil
+}
+
+// searchFile ищет программу в каталогах path. Если исполняемого файла нет,
+// но есть неисполняемый, его нельзя запустить (EACCES), как и в bash.
+func searchFile(prog string, path string) (string, error) {
+	if files := findInPath(prog, path, false); len(files) > 0 {
+		return files[0], nil
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		if info, err := os.Stat(filepath.Join(dir, prog)); err == nil && info.Mode().IsRegular() {
+			return "", fmt.Errorf("%s: %w", prog, syscall.EACCES)
+		}
+	}
+	return "", fmt.Errorf("%s: %w", prog, ErrCommandNotFound)
+}
+
+// checkExecutable проверяет, что file можно запустить; name - имя файла в
+// сообщении об ошибке.
+func checkExecutable(name string, file string) error {
+	info, err := os.Stat(file)
+	var pathErr *os.PathError
+	switch {
+	case errors.As(err, &pathErr):
+		return fmt.Errorf("%s: %w", name, pathErr.Err)
+	case err != nil:
+		return err
+	case info.IsDir():
+		return fmt.Errorf("%s: %w", name, syscall.EISDIR)
+	case info.Mode()&0111 == 0:
+		return fmt.Errorf("%s: %w", name, syscall.EACCES)
+	}
+	return nil
+}
+
+// hash запоминает пути программ name или выводит таблицу с числом запусков:
+// -r очищает таблицу, -d забывает программы, -t выводит их пути, -l выводит
+// таблицу командами hash, -p file name запоминает file как путь программы
+// name.
+func hash(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	mode, file, reset := "", "", false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			switch c := arg[i]; c {
+			case 'r':
+				opts.hash.reset()
+				reset = true
+			case 'd', 't', 'l':
+				mode = string(c)
+			case 'p':
+				if i+1 < len(arg) {
+					file = arg[i+1:]
+				} else if len(args) > 0 {
+					file, args = args[0], args[1:]
+				} else {
+					return Status{code: 2, err: fmt.Errorf("hash: -p: %w", ErrOptionRequiresArgument)}
+				}
+				// В ограниченном режиме так можно было бы запустить
+				// программу под именем разрешенной.
+				if opts.restricted != nil {
+					return Status{code: 1, err: fmt.Errorf("hash: %s: %w", file, ErrRestricted)}
+				}
+				mode, i = "p", len(arg)
+			default:
+				return Status{code: 2, err: fmt.Errorf("hash: -%c: %w", c, ErrInvalidOption)}
+			}
+		}
+	}
+
+	path, _ := opts.getVar("PATH")
+	if len(args) == 0 {
+		if mode == "p" {
+			return Status{code: 2, err: fmt.Errorf("hash: -p: %w", ErrOptionRequiresArgument)}
+		}
+		if mode == "" && !reset || mode == "l" {
+			return printHash(cmd, opts.hash, path, mode == "l")
+		}
+		return Status{code: 0}
+	}
+
+	var b strings.Builder
+	status := Status{code: 0}
+	for _, name := range args {
+		switch {
+		case mode == "p":
+			opts.hash.add(name, path, file, 0)
+		case mode == "d":
+			if !opts.hash.remove(name) {
+				status = cmd.report(Status{code: 1, err: fmt.Errorf("hash: %s: %w", name, ErrNotFound)})
+			}
+		case mode == "t":
+			hashed, ok := opts.hash.lookup(name, path)
+			if !ok {
+				status = cmd.report(Status{code: 1, err: fmt.Errorf("hash: %s: %w", name, ErrNotFound)})
+				continue
+			}
+			if len(args) > 1 {
+				b.WriteString(name + "\t")
+			}
+			b.WriteString(hashed + "\n")
+		case strings.Contains(name, "/"):
+		default:
+			// Встроенные команды и функции в PATH не ищутся.
+			if _, ok := opts.funcs[name]; ok || isBuiltin(name) {
+				continue
+			}
+			file, err := searchFile(name, path)
+			if err != nil {
+				status = cmd.report(Status{code: 1, err: fmt.Errorf("hash: %s: %w", name, ErrNotFound)})
+				continue
+			}
+			opts.hash.add(name, path, file, 0)
+		}
+	}
+
+	if _, pErr := fmt.Fprint(cmd.stdout, b.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return status
+}
+
+// printHash выводит таблицу hash, а с reusable - командами, которые ее
+// восстановят.
+func printHash(cmd *CMD, h *hashTable, path string, reusable bool) Status {
+	names, entries := h.list(path)
+	if len(names) == 0 {
+		if _, pErr := fmt.Fprintln(cmd.stdout, "hash: hash table empty"); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+		return Status{code: 0}
+	}
+
+	var b strings.Builder
+	if !reusable {
+		b.WriteString("hits\tcommand\n")
+	}
+	for i, e := range entries {
+		if reusable {
+			fmt.Fprintf(&b, "builtin hash -p %s %s\n", e.file, names[i])
+		} else {
+			fmt.Fprintf(&b, "%4d\t%s\n", e.hits, e.file)
+		}
+	}
+
+	if _, pErr := fmt.Fprint(cmd.stdout, b.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return Status{code: 0}
+}
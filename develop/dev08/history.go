@@ -0,0 +1,90 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// historyLimit - сколько последних команд хранит история.
+const historyLimit = 1000
+
+// history - история команд, сохраняемая в файле по строке на команду.
+// Повторяющаяся команда хранится один раз, на месте последнего выполнения.
+type history struct {
+	path    string
+	limit   int
+	entries []string
+}
+
+// historyFile возвращает путь к файлу истории: $HISTFILE или
+// ~/.wbsh_history.
+func (opts *options) historyFile() string {
+	if file, ok := opts.getVar("HISTFILE"); ok {
+		return file
+	}
+
+	home, ok := opts.getVar("HOME")
+	if !ok || home == "" {
+		home = opts.homeDir
+	}
+	return filepath.Join(home, ".wbsh_history")
+}
+
+// loadHistory читает историю из файла. Отсутствующий файл - пустая история.
+func loadHistory(path string, limit int) (*history, error) {
+	h := &history{path: path, limit: limit}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return h, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.push(line)
+		}
+	}
+	return h, nil
+}
+
+// push добавляет команду в конец истории, удаляя ее прежнее вхождение и
+// самые старые команды сверх лимита.
+func (h *history) push(line string) {
+	for i, entry := range h.entries {
+		if entry == line {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+	}
+}
+
+// add добавляет команду и сохраняет историю. Команды, начинающиеся с
+// пробела, в историю не попадают.
+func (h *history) add(line string) error {
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, " ") || strings.Contains(line, "\n") {
+		return nil
+	}
+
+	h.push(line)
+	return h.save()
+}
+
+func (h *history) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	data := strings.Join(h.entries, "\n") + "\n"
+	return os.WriteFile(h.path, []byte(data), 0600)
+}
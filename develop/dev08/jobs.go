@@ -0,0 +1,826 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Состояние задания.
+const (
+	jobRunning = iota
+	jobStopped
+	jobDone
+)
+
+// job - задание: конвейер, выполняемый на переднем плане, или список команд,
+// запущенный в фоне через "&". Задание попадает в таблицу заданий, когда
+// уходит в фон или останавливается.
+type job struct {
+	mu      sync.Mutex
+	id      int
+	cmdline string
+	// background - задание выполняется в фоне. Процессы фонового задания
+	// запускаются в собственной группе, чтобы Ctrl+C и Ctrl+Z с терминала их
+	// не задевали. Процессы задания переднего плана получают свою группу и
+	// терминал, только если у шелла есть управление заданиями (control),
+	// иначе они остаются в группе шелла.
+	background bool
+	control    *jobControl
+	pgid       int
+	pids       []int
+	state      int
+	status     Status
+	// notified - о текущем состоянии задания уже сообщено.
+	notified bool
+
+	// started закрывается, когда запущен первый процесс задания или задание
+	// завершилось.
+	started     chan struct{}
+	startedOnce sync.Once
+	// stopped получает значение при остановке задания.
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+func newJob(cmdline string, background bool) *job {
+	return &job{
+		cmdline:    cmdline,
+		background: background,
+		started:    make(chan struct{}),
+		stopped:    make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// startProcess запускает процесс как часть задания.
+func (j *job) startProcess(c *exec.Cmd) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ownGroup := j.background || j.control != nil
+	if ownGroup {
+		// Если все процессы группы уже завершились, к ней нельзя
+		// присоединиться: задание продолжается в новой группе.
+		if j.pgid != 0 && syscall.Kill(-j.pgid, 0) == syscall.ESRCH {
+			j.pgid = 0
+		}
+		attr := &syscall.SysProcAttr{Setpgid: true, Pgid: j.pgid}
+
+		// Процесс переднего плана сам занимает терминал до exec, чтобы не
+		// начать читать с него раньше, чем шелл передаст терминал.
+		if !j.background {
+			attr.Foreground, attr.Ctty = true, j.control.fd
+		}
+		c.SysProcAttr = attr
+	}
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	pid := c.Process.Pid
+	if ownGroup && j.pgid == 0 {
+		j.pgid = pid
+	}
+	j.pids = append(j.pids, pid)
+
+	go func() {
+		for waitStop(pid) {
+			j.stop()
+		}
+	}()
+
+	j.begin()
+	return nil
+}
+
+// begin отмечает, что задание начало выполняться. Встроенная команда или
+// функция выполняется без процесса и может работать долго, поэтому шелл,
+// запускающий задание в фоне, ждет только ее начала.
+func (j *job) begin() {
+	j.startedOnce.Do(func() { close(j.started) })
+}
+
+func (j *job) stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.state != jobRunning {
+		return
+	}
+
+	j.state = jobStopped
+	j.notified = false
+	select {
+	case j.stopped <- struct{}{}:
+	default:
+	}
+}
+
+func (j *job) finish(status Status) {
+	j.mu.Lock()
+	j.state = jobDone
+	j.status = status
+	j.notified = false
+	j.mu.Unlock()
+
+	j.begin()
+	close(j.done)
+}
+
+// cont продолжает остановленное задание.
+func (j *job) cont() error {
+	j.mu.Lock()
+	if j.state == jobStopped {
+		j.state = jobRunning
+		j.notified = false
+	}
+	j.mu.Unlock()
+
+	// Остановка, о которой уже сообщили, не должна прервать ожидание
+	// продолженного задания.
+	select {
+	case <-j.stopped:
+	default:
+	}
+
+	return j.signal(syscall.SIGCONT)
+}
+
+// signal посылает сигнал всем процессам задания.
+func (j *job) signal(sig syscall.Signal) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pgid != 0 {
+		return syscall.Kill(-j.pgid, sig)
+	}
+
+	for _, pid := range j.pids {
+		if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
+
+// foreground передает заданию терминал, если у шелла есть управление
+// заданиями.
+func (j *job) foreground(control *jobControl) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.background = false
+	j.control = control
+	if control != nil && j.pgid != 0 {
+		control.give(j.pgid)
+	}
+}
+
+// reclaimTerminal возвращает шеллу терминал, отданный заданию.
+func (j *job) reclaimTerminal() {
+	j.mu.Lock()
+	control := j.control
+	j.mu.Unlock()
+
+	if control != nil {
+		control.reclaim()
+	}
+}
+
+func (j *job) getState() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+func (j *job) getStatus() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// pid возвращает номер группы процессов задания или, если задание выполняется
+// в группе шелла, номер его первого процесса. 0 - процессов еще нет.
+func (j *job) pid() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pgid != 0 {
+		return j.pgid
+	}
+	if len(j.pids) > 0 {
+		return j.pids[0]
+	}
+	return 0
+}
+
+func (j *job) hasPid(pid int) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, p := range j.pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// describe возвращает состояние задания так, как его показывает jobs.
+func (j *job) describe() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch j.state {
+	case jobStopped:
+		return "Stopped"
+	case jobDone:
+		if j.status.signal != 0 {
+			return describeSignal(j.status.signal)
+		}
+		if j.status.code != 0 {
+			return fmt.Sprintf("Exit %d", j.status.code)
+		}
+		return "Done"
+	}
+	return "Running"
+}
+
+// command возвращает текст команды задания, для фоновых - с "&".
+func (j *job) command() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.background && j.state == jobRunning {
+		return j.cmdline + " &"
+	}
+	return j.cmdline
+}
+
+// jobTable - таблица заданий шелла.
+type jobTable struct {
+	mu   sync.Mutex
+	jobs []*job
+	// recent - задания от давних к недавним: последнее запущенное в фоне или
+	// остановленное задание становится текущим.
+	recent []*job
+	// foreground - задание, которое шелл сейчас ждет.
+	foreground *job
+	// finished - коды возврата фоновых заданий, о завершении которых уже
+	// сообщили, по номерам их процессов: wait $! должен их вернуть.
+	finished map[int]int
+}
+
+func newJobTable() *jobTable {
+	return &jobTable{finished: make(map[int]int)}
+}
+
+// add помещает задание в таблицу и делает его текущим.
+func (t *jobTable) add(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if j.id == 0 {
+		j.id = 1
+		if len(t.jobs) > 0 {
+			j.id = t.jobs[len(t.jobs)-1].id + 1
+		}
+		t.jobs = append(t.jobs, j)
+	}
+
+	t.recent = removeJob(t.recent, j)
+	t.recent = append(t.recent, j)
+}
+
+func (t *jobTable) remove(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.jobs = removeJob(t.jobs, j)
+	t.recent = removeJob(t.recent, j)
+}
+
+// forget убирает из таблицы завершившееся задание, запоминая его код
+// возврата.
+func (t *jobTable) forget(j *job) {
+	t.remove(j)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, pid := range j.pids {
+		t.finished[pid] = j.status.code
+	}
+}
+
+// reap возвращает и забывает код возврата завершившегося процесса.
+func (t *jobTable) reap(pid int) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	code, ok := t.finished[pid]
+	delete(t.finished, pid)
+	return code, ok
+}
+
+func removeJob(jobs []*job, j *job) []*job {
+	for i, item := range jobs {
+		if item == j {
+			return append(jobs[:i:i], jobs[i+1:]...)
+		}
+	}
+	return jobs
+}
+
+func (t *jobTable) list() []*job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*job(nil), t.jobs...)
+}
+
+// ranked возвращает задания в порядке возрастания приоритета: текущее
+// задание последнее, предыдущее - перед ним. Остановленные задания важнее
+// выполняющихся.
+func (t *jobTable) ranked() []*job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	res := make([]*job, 0, len(t.recent))
+	for _, stopped := range []bool{false, true} {
+		for _, j := range t.recent {
+			if (j.getState() == jobStopped) == stopped {
+				res = append(res, j)
+			}
+		}
+	}
+	return res
+}
+
+// marker возвращает "+" для текущего задания, "-" для предыдущего и пробел
+// для остальных.
+func (t *jobTable) marker(j *job) byte {
+	ranked := t.ranked()
+	switch {
+	case len(ranked) > 0 && ranked[len(ranked)-1] == j:
+		return '+'
+	case len(ranked) > 1 && ranked[len(ranked)-2] == j:
+		return '-'
+	}
+	return ' '
+}
+
+func (t *jobTable) format(j *job, long bool) string {
+	if long {
+		return fmt.Sprintf("[%d]%c %d %-24s%s", j.id, t.marker(j), j.pid(), j.describe(), j.command())
+	}
+	return fmt.Sprintf("[%d]%c  %-24s%s", j.id, t.marker(j), j.describe(), j.command())
+}
+
+var ErrNoCurrentJob = errors.New("no current job")
+var ErrNoSuchJob = errors.New("no such job")
+var ErrAmbiguousJob = errors.New("ambiguous job spec")
+var ErrJobTerminated = errors.New("job has terminated")
+var ErrNotChild = errors.New("is not a child of this shell")
+var ErrNotJobSpec = errors.New("not a pid or valid job spec")
+var ErrFgTooManyArgs = errors.New("fg: too many arguments")
+
+// find ищет задание по спецификации: %N или N - номер, %+ и %% - текущее,
+// %- - предыдущее, %str - команда начинается с str, %?str - содержит str.
+func (t *jobTable) find(spec string) (*job, error) {
+	ranked := t.ranked()
+
+	switch spec {
+	case "", "%", "%%", "%+":
+		if len(ranked) == 0 {
+			return nil, ErrNoCurrentJob
+		}
+		return ranked[len(ranked)-1], nil
+	case "%-":
+		if len(ranked) < 2 {
+			return nil, fmt.Errorf("%s: %w", spec, ErrNoSuchJob)
+		}
+		return ranked[len(ranked)-2], nil
+	}
+
+	name := strings.TrimPrefix(spec, "%")
+	if id, err := strconv.Atoi(name); err == nil {
+		for _, j := range t.list() {
+			if j.id == id {
+				return j, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: %w", spec, ErrNoSuchJob)
+	}
+
+	if !strings.HasPrefix(spec, "%") {
+		return nil, fmt.Errorf("%s: %w", spec, ErrNoSuchJob)
+	}
+
+	var found *job
+	for _, j := range t.list() {
+		var ok bool
+		if strings.HasPrefix(name, "?") {
+			ok = strings.Contains(j.cmdline, name[1:])
+		} else {
+			ok = strings.HasPrefix(j.cmdline, name)
+		}
+
+		if !ok {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%s: %w", spec, ErrAmbiguousJob)
+		}
+		found = j
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("%s: %w", spec, ErrNoSuchJob)
+	}
+	return found, nil
+}
+
+// notify сообщает о заданиях, которые завершились или остановились с
+// прошлого раза, и убирает завершившиеся из таблицы.
+func (t *jobTable) notify(w io.Writer) error {
+	for _, j := range t.list() {
+		state := j.getState()
+
+		j.mu.Lock()
+		notified := j.notified
+		j.notified = true
+		j.mu.Unlock()
+
+		if state == jobRunning || notified {
+			continue
+		}
+
+		if _, err := fmt.Fprintln(w, t.format(j, false)); err != nil {
+			return err
+		}
+
+		if state == jobDone {
+			t.forget(j)
+		}
+	}
+
+	return nil
+}
+
+// waitForeground ждет, пока задание на переднем плане завершится или
+// остановится. Остановленное задание попадает в таблицу заданий.
+func (t *jobTable) waitForeground(j *job, errs io.Writer) Status {
+	t.mu.Lock()
+	prev := t.foreground
+	t.foreground = j
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.foreground = prev
+		t.mu.Unlock()
+	}()
+
+	select {
+	case <-j.done:
+	case <-j.stopped:
+		// Задание могло успеть завершиться после остановки.
+		select {
+		case <-j.done:
+		default:
+			j.reclaimTerminal()
+			t.add(j)
+			j.mu.Lock()
+			j.notified = true
+			j.mu.Unlock()
+
+			if _, pErr := fmt.Fprintf(errs, "\n%s\n", t.format(j, false)); pErr != nil {
+				return Status{exit: true, code: 1, err: pErr}
+			}
+			return Status{code: 128 + int(syscall.SIGTSTP)}
+		}
+	}
+
+	j.reclaimTerminal()
+	t.remove(j)
+
+	status := j.getStatus()
+	if pErr := reportSignal(errs, status); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return status
+}
+
+// suspend останавливает задание переднего плана, когда шелл получает SIGTSTP.
+// Сам шелл при этом не останавливается.
+func (t *jobTable) suspend(sigs <-chan os.Signal) {
+	for range sigs {
+		t.mu.Lock()
+		j := t.foreground
+		t.mu.Unlock()
+
+		if j != nil {
+			j.signal(syscall.SIGTSTP)
+		}
+	}
+}
+
+// runForeground выполняет конвейер как задание переднего плана.
+func (opts *options) runForeground(pl *Pipeline, s streams) Status {
+	j := newJob(pl.String(), false)
+	j.control = opts.jobControl
+	opts.job = j
+	wait := pl.start(opts, s)
+	opts.job = nil
+
+	go func() {
+		j.finish(wait())
+	}()
+
+	return opts.jobs.waitForeground(j, s.stderr)
+}
+
+// runBackground запускает список команд в фоне, как в подоболочке.
+func (opts *options) runBackground(ao *andOrNode, s streams) Status {
+	j := newJob(ao.String(), true)
+	sub := opts.subshell()
+	sub.job = j
+
+	// Фоновое задание не должно читать ввод шелла, если это не терминал.
+	var devNull *os.File
+	if f, ok := s.stdin.(*os.File); !ok || !isTerminal(f) {
+		var err error
+		devNull, err = os.Open(os.DevNull)
+		if err != nil {
+			return Status{code: 1, err: err}
+		}
+		s.stdin = devNull
+	}
+
+	opts.jobs.add(j)
+	go func() {
+		status := ao.exec(sub, s)
+		if devNull != nil {
+			devNull.Close()
+		}
+
+		// exit в фоновом задании завершает только его.
+		if status.err == nil {
+			status.exit = false
+		}
+		j.finish(status)
+	}()
+
+	<-j.started
+	opts.lastBgPid = j.pid()
+
+	// Номер задания, как в bash, выводит только интерактивный шелл.
+	var pErr error
+	switch {
+	case opts.script != nil:
+	case opts.lastBgPid != 0:
+		_, pErr = fmt.Fprintf(s.stderr, "[%d] %d\n", j.id, opts.lastBgPid)
+	default:
+		_, pErr = fmt.Fprintf(s.stderr, "[%d]\n", j.id)
+	}
+	if pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+
+	opts.lastCmdCode = 0
+	return Status{code: 0}
+}
+
+func jobs(cmd *CMD, opts *options) Status {
+	long, pidsOnly := false, false
+	specs := []string{}
+	for _, arg := range cmd.args {
+		switch arg {
+		case "-l":
+			long = true
+		case "-p":
+			pidsOnly = true
+		default:
+			specs = append(specs, arg)
+		}
+	}
+
+	list := opts.jobs.list()
+	if len(specs) > 0 {
+		list = nil
+		for _, spec := range specs {
+			j, err := opts.jobs.find(spec)
+			if err != nil {
+				return Status{code: 1, err: fmt.Errorf("jobs: %w", err)}
+			}
+			list = append(list, j)
+		}
+	}
+
+	for _, j := range list {
+		line := opts.jobs.format(j, long)
+		if pidsOnly {
+			line = strconv.Itoa(j.pid())
+		}
+
+		if _, pErr := fmt.Fprintln(cmd.stdout, line); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+
+		j.mu.Lock()
+		j.notified = true
+		j.mu.Unlock()
+		if j.getState() == jobDone {
+			opts.jobs.forget(j)
+		}
+	}
+
+	return Status{code: 0}
+}
+
+func fg(cmd *CMD, opts *options) Status {
+	if len(cmd.args) > 1 {
+		return Status{code: 1, err: ErrFgTooManyArgs}
+	}
+
+	spec := ""
+	if len(cmd.args) == 1 {
+		spec = cmd.args[0]
+	}
+
+	j, err := opts.jobs.find(spec)
+	if err != nil {
+		return Status{code: 1, err: fmt.Errorf("fg: %w", err)}
+	}
+
+	if j.getState() == jobDone {
+		opts.jobs.forget(j)
+		return Status{code: 1, err: fmt.Errorf("fg: %w", ErrJobTerminated)}
+	}
+
+	if _, pErr := fmt.Fprintln(cmd.stdout, j.cmdline); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+
+	j.foreground(opts.jobControl)
+	if err := j.cont(); err != nil {
+		j.reclaimTerminal()
+		return Status{code: 1, err: fmt.Errorf("fg: %w", err)}
+	}
+
+	status := opts.jobs.waitForeground(j, cmd.stderr)
+	// Задание выполняется как подоболочка: exit в нем не завершает шелл.
+	if status.err == nil {
+		status.exit = false
+	}
+	return status
+}
+
+func bg(cmd *CMD, opts *options) Status {
+	specs := cmd.args
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+
+	status := Status{code: 0}
+	for _, spec := range specs {
+		j, err := opts.jobs.find(spec)
+		if err != nil {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("bg: %w", err)})
+			continue
+		}
+
+		if j.getState() == jobDone {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("bg: %w", ErrJobTerminated)})
+			continue
+		}
+
+		j.mu.Lock()
+		j.background = true
+		j.mu.Unlock()
+
+		if err := j.cont(); err != nil {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("bg: %w", err)})
+			continue
+		}
+		opts.jobs.add(j)
+
+		if _, pErr := fmt.Fprintf(cmd.stdout, "[%d]%c %s\n", j.id, opts.jobs.marker(j), j.command()); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+	}
+
+	return status
+}
+
+// waitFor реализует wait: без аргументов ждет все выполняющиеся задания,
+// иначе - указанные задания или процессы и возвращает код последнего.
+func waitFor(cmd *CMD, opts *options) Status {
+	if len(cmd.args) == 0 {
+		for _, j := range opts.jobs.list() {
+			if j.getState() == jobStopped {
+				continue
+			}
+
+			select {
+			case <-j.done:
+			case <-j.stopped:
+			}
+		}
+		return Status{code: 0}
+	}
+
+	status := Status{code: 0}
+	for _, arg := range cmd.args {
+		var j *job
+		if strings.HasPrefix(arg, "%") {
+			var err error
+			if j, err = opts.jobs.find(arg); err != nil {
+				status = cmd.report(Status{code: 127, err: fmt.Errorf("wait: %w", err)})
+				continue
+			}
+		} else {
+			pid, err := strconv.Atoi(arg)
+			if err != nil {
+				status = cmd.report(Status{code: 1, err: fmt.Errorf("wait: `%s': %w", arg, ErrNotJobSpec)})
+				continue
+			}
+
+			for _, item := range opts.jobs.list() {
+				if item.hasPid(pid) {
+					j = item
+				}
+			}
+			if code, ok := opts.jobs.reap(pid); ok && j == nil {
+				status = Status{code: code}
+				continue
+			}
+			if j == nil {
+				status = cmd.report(Status{code: 127, err: fmt.Errorf("wait: pid %d %w", pid, ErrNotChild)})
+				continue
+			}
+		}
+
+		select {
+		case <-j.done:
+			opts.jobs.remove(j)
+			status = Status{code: j.getStatus().code}
+		case <-j.stopped:
+			status = Status{code: 128 + int(syscall.SIGTSTP)}
+		}
+	}
+
+	return status
+}
+
+func disown(cmd *CMD, opts *options) Status {
+	all, runningOnly := false, false
+	specs := []string{}
+	for _, arg := range cmd.args {
+		switch arg {
+		case "-a":
+			all = true
+		case "-r":
+			runningOnly = true
+		default:
+			specs = append(specs, arg)
+		}
+	}
+
+	list := []*job{}
+	switch {
+	case all || (runningOnly && len(specs) == 0):
+		list = opts.jobs.list()
+	case len(specs) == 0:
+		specs = []string{""}
+	}
+
+	for _, spec := range specs {
+		j, err := opts.jobs.find(spec)
+		if err != nil {
+			return Status{code: 1, err: fmt.Errorf("disown: %w", err)}
+		}
+		list = append(list, j)
+	}
+
+	for _, j := range list {
+		if runningOnly && j.getState() != jobRunning {
+			continue
+		}
+		opts.jobs.remove(j)
+	}
+
+	return Status{code: 0}
+}
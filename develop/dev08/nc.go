@@ -0,0 +1,472 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrNcUsage = errors.New("usage: nc [-uvz] [-w timeout] host port[-port] or nc -l [-uv] [-w timeout] [host] port")
+var ErrInvalidPort = errors.New("invalid port")
+var ErrInvalidTimeout = errors.New("invalid timeout")
+var ErrConnectionTimedOut = errors.New("connection timed out")
+
+// ncOptions - настройки nc.
+type ncOptions struct {
+	network string
+	listen  bool
+	scan    bool
+	verbose bool
+	// timeout - время на подключение и наибольший простой соединения; 0 -
+	// без ограничения.
+	timeout time.Duration
+	host    string
+	ports   []int
+}
+
+// nc - клиент netcat: передает stdin в TCP- или, с -u, UDP-соединение, а
+// полученное из него выводит в stdout. Когда stdin кончается, TCP-соединение
+// закрывается на запись, и nc ждет, пока его закроет другая сторона. С -l nc
+// ждет одного входящего соединения, с -z только проверяет, открыты ли порты,
+// -w ограничивает время подключения и простоя, -v сообщает о соединениях в
+// stderr.
+func nc(cmd *CMD, opts *options) Status {
+	o, err := parseNcArgs(cmd.args)
+	if err != nil {
+		return Status{code: 2, err: fmt.Errorf("nc: %w", err)}
+	}
+
+	// Встроенная команда выполняется в процессе шелла, который перехватывает
+	// Ctrl+C, поэтому nc прерывается сама: закрывает соединение.
+	intr := make(chan os.Signal, 1)
+	signal.Notify(intr, syscall.SIGINT)
+	defer signal.Stop(intr)
+
+	if o.scan {
+		return cmd.ncScan(o)
+	}
+
+	var conn net.Conn
+	if o.listen {
+		conn, err = o.accept(intr)
+		if errors.Is(err, errInterrupted) {
+			return Status{code: 130}
+		}
+		if err != nil {
+			return Status{code: 1, err: fmt.Errorf("nc: %w", err)}
+		}
+	} else {
+		d := net.Dialer{Timeout: o.timeout}
+		conn, err = d.Dial(o.network, net.JoinHostPort(o.host, strconv.Itoa(o.ports[0])))
+		if err != nil {
+			return Status{code: 1, err: fmt.Errorf("nc: connect to %s port %d (%s) failed: %w", o.host, o.ports[0], o.network, connError(err))}
+		}
+	}
+
+	if o.verbose {
+		if o.listen {
+			fmt.Fprintf(cmd.stderr, "Connection received on %s\n", conn.RemoteAddr())
+		} else {
+			fmt.Fprintf(cmd.stderr, "Connection to %s %d port [%s] succeeded!\n", o.host, o.ports[0], o.network)
+		}
+	}
+	return cmd.ncTransfer(conn, o, intr)
+}
+
+func parseNcArgs(args []string) (*ncOptions, error) {
+	o := &ncOptions{network: "tcp"}
+
+options:
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			switch arg[i] {
+			case 'u':
+				o.network = "udp"
+			case 'l':
+				o.listen = true
+			case 'z':
+				o.scan = true
+			case 'v':
+				o.verbose = true
+			case 'w':
+				value := arg[i+1:]
+				if value == "" {
+					if len(args) == 0 {
+						return nil, fmt.Errorf("-w: %w", ErrOptionRequiresArgument)
+					}
+					value, args = args[0], args[1:]
+				}
+				timeout, err := parseNcTimeout(value)
+				if err != nil {
+					return nil, err
+				}
+				o.timeout = timeout
+				continue options
+			default:
+				return nil, fmt.Errorf("-%c: %w", arg[i], ErrInvalidOption)
+			}
+		}
+	}
+
+	// В режиме прослушивания хост можно не указывать.
+	if o.listen && len(args) == 1 {
+		args = append([]string{""}, args...)
+	}
+	if len(args) != 2 || o.listen && o.scan {
+		return nil, ErrNcUsage
+	}
+	o.host = args[0]
+
+	first, last, isRange := strings.Cut(args[1], "-")
+	if isRange && !o.scan {
+		return nil, fmt.Errorf("%s: %w", args[1], ErrInvalidPort)
+	}
+	from, err := o.parsePort(first)
+	if err != nil {
+		return nil, err
+	}
+	to := from
+	if isRange {
+		if to, err = o.parsePort(last); err != nil {
+			return nil, err
+		}
+	}
+	for port := from; port <= to; port++ {
+		o.ports = append(o.ports, port)
+	}
+	return o, nil
+}
+
+// parsePort разбирает номер порта или имя службы.
+func (o *ncOptions) parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		port, err = net.LookupPort(o.network, s)
+	}
+	if err != nil || port < 0 || port > 65535 || port == 0 && !o.listen {
+		return 0, fmt.Errorf("%s: %w", s, ErrInvalidPort)
+	}
+	return port, nil
+}
+
+// parseNcTimeout разбирает таймаут в секундах, как у nc, или с единицами:
+// "500ms", "1m".
+func parseNcTimeout(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("%s: %w", s, ErrInvalidTimeout)
+}
+
+// ncScan проверяет порты: код возврата 0, если открыт хотя бы один. Для UDP
+// порт считается открытым, если на пробный пакет не пришел отказ.
+func (cmd *CMD) ncScan(o *ncOptions) Status {
+	open := false
+	for _, port := range o.ports {
+		addr := net.JoinHostPort(o.host, strconv.Itoa(port))
+		d := net.Dialer{Timeout: o.timeout}
+		conn, err := d.Dial(o.network, addr)
+		if err == nil && o.network == "udp" {
+			err = probeUDP(conn)
+		}
+		if err != nil {
+			if o.verbose {
+				fmt.Fprintf(cmd.stderr, "nc: connect to %s port %d (%s) failed: %v\n", o.host, port, o.network, connError(err))
+			}
+			continue
+		}
+
+		conn.Close()
+		open = true
+		if o.verbose {
+			fmt.Fprintf(cmd.stderr, "Connection to %s %d port [%s] succeeded!\n", o.host, port, o.network)
+		}
+	}
+
+	if !open {
+		return Status{code: 1}
+	}
+	return Status{code: 0}
+}
+
+// probeUDP отправляет пустой пакет и недолго ждет ответа: закрытый порт
+// отвечает ICMP, и чтение возвращает "connection refused".
+func probeUDP(conn net.Conn) error {
+	if _, err := conn.Write(nil); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	var buf [1]byte
+	if _, err := conn.Read(buf[:]); err != nil && !isTimeout(err) {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// connError убирает из ошибки соединения адреса, которые nc уже вывел.
+func connError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		var sysErr *os.SyscallError
+		if errors.As(opErr.Err, &sysErr) {
+			return sysErr.Err
+		}
+		return opErr.Err
+	}
+	return err
+}
+
+// accept ждет одного входящего соединения; для UDP соединением считается
+// адрес, с которого пришел первый пакет.
+func (o *ncOptions) accept(intr <-chan os.Signal) (net.Conn, error) {
+	addr := net.JoinHostPort(o.host, strconv.Itoa(o.ports[0]))
+
+	var closer io.Closer
+	var accept func() (net.Conn, error)
+	if o.network == "udp" {
+		pc, err := net.ListenPacket(o.network, addr)
+		if err != nil {
+			return nil, err
+		}
+		closer = pc
+		accept = func() (net.Conn, error) {
+			return acceptPacket(pc)
+		}
+	} else {
+		ln, err := net.Listen(o.network, addr)
+		if err != nil {
+			return nil, err
+		}
+		closer = ln
+		accept = ln.Accept
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	var timedOut <-chan time.Time
+	if o.timeout > 0 {
+		timer := time.NewTimer(o.timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+
+	// Прерывание и таймаут закрывают слушающий сокет, чтобы вернуться из
+	// accept.
+	var reason error
+	var mu sync.Mutex
+	go func() {
+		var err error
+		select {
+		case <-intr:
+			err = errInterrupted
+		case <-timedOut:
+			err = ErrConnectionTimedOut
+		case <-done:
+			return
+		}
+		mu.Lock()
+		reason = err
+		mu.Unlock()
+		closer.Close()
+	}()
+
+	conn, err := accept()
+	if o.network == "tcp" {
+		closer.Close()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if reason != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, reason
+	}
+	if err != nil && o.network == "udp" {
+		closer.Close()
+	}
+	return conn, err
+}
+
+// packetConn - UDP-сокет, привязанный к первому отправителю: чтение
+// пропускает пакеты от других адресов, а запись отправляет пакеты ему.
+type packetConn struct {
+	net.PacketConn
+	peer net.Addr
+	// first - первый пакет, полученный до создания соединения.
+	first []byte
+}
+
+func acceptPacket(pc net.PacketConn) (net.Conn, error) {
+	buf := make([]byte, 64*1024)
+	n, peer, err := pc.ReadFrom(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &packetConn{PacketConn: pc, peer: peer, first: buf[:n]}, nil
+}
+
+func (c *packetConn) Read(b []byte) (int, error) {
+	if c.first != nil {
+		n := copy(b, c.first)
+		c.first = nil
+		return n, nil
+	}
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil || addr.String() == c.peer.String() {
+			return n, err
+		}
+	}
+}
+
+func (c *packetConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.peer)
+}
+
+func (c *packetConn) RemoteAddr() net.Addr {
+	return c.peer
+}
+
+// ncTransfer передает stdin в соединение, а полученное - в stdout, пока
+// соединение не закроет другая сторона, не истечет время простоя или nc не
+// прервут.
+func (cmd *CMD) ncTransfer(conn net.Conn, o *ncOptions, intr <-chan os.Signal) Status {
+	var closeOnce sync.Once
+	closeConn := func() { closeOnce.Do(func() { conn.Close() }) }
+	defer closeConn()
+
+	in, release := cmd.ncInput()
+	defer release()
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		if in != nil {
+			io.Copy(conn, in)
+		}
+		// Полузакрытие: другая сторона получит EOF, но сможет ответить.
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}()
+
+	interrupted := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-intr:
+			close(interrupted)
+			closeConn()
+		case <-done:
+		}
+	}()
+
+	status := Status{code: 0}
+	eof := false
+	buf := make([]byte, 32*1024)
+	for {
+		if o.timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(o.timeout))
+		}
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if _, pErr := cmd.stdout.Write(buf[:n]); pErr != nil {
+				status = Status{exit: true, code: 1, err: pErr}
+				break
+			}
+		}
+		if err == nil {
+			continue
+		}
+
+		select {
+		case <-interrupted:
+			status = Status{code: 130}
+		default:
+			eof = err == io.EOF
+			if !eof && !isTimeout(err) {
+				status = Status{code: 1, err: fmt.Errorf("nc: %w", connError(err))}
+			}
+		}
+		break
+	}
+
+	// Другая сторона могла закрыть соединение только на запись, поэтому
+	// stdin передается до конца. С терминала nc тогда ждала бы Ctrl+D, и
+	// его чтение прерывается сразу.
+	if f, ok := cmd.stdin.(*os.File); eof && !(ok && isTerminal(f)) {
+		select {
+		case <-sent:
+		case <-interrupted:
+			status = Status{code: 130}
+		}
+	}
+	closeConn()
+
+	stopReading(in, sent)
+	return status
+}
+
+// ncInput возвращает stdin для передачи в соединение и функцию, которая
+// освобождает его. Блокирующее чтение терминала нельзя прервать, и горутина
+// забрала бы строку, введенную уже для шелла. Неблокирующий режим общий у
+// всех копий дескриптора, и шелл получил бы EAGAIN, поэтому терминал заново
+// открывается через /proc: у nc получается свое открытое описание файла.
+func (cmd *CMD) ncInput() (io.Reader, func()) {
+	f, ok := cmd.stdin.(*os.File)
+	if !ok || !isTerminal(f) {
+		return cmd.stdin, func() {}
+	}
+
+	tty, err := os.Open(fmt.Sprintf("/proc/self/fd/%d", f.Fd()))
+	if err != nil {
+		return cmd.stdin, func() {}
+	}
+	return tty, func() { tty.Close() }
+}
+
+// stopReading прерывает чтение in горутиной, которая закроет done. Каналы
+// конвейера и терминал из ncInput поддерживают таймауты, остальные
+// источники читаются до конца.
+func stopReading(in io.Reader, done <-chan struct{}) {
+	f, ok := in.(*os.File)
+	if !ok {
+		<-done
+		return
+	}
+
+	if err := f.SetReadDeadline(time.Now()); err != nil {
+		return
+	}
+	<-done
+	f.SetReadDeadline(time.Time{})
+}
@@ -0,0 +1,1027 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Грамматика, которую разбирает parser:
+//
+//	list     := and_or ((';' | '&' | '\n') and_or)* [';' | '&']
+//	and_or   := pipeline (('&&' | '||') linebreak pipeline)*
+//	pipeline := ['!'] command ('|' linebreak command)*
+//	command  := simple | compound redirect* | funcdef
+//	compound := '(' list ')' | '{' list '}'
+//	          | 'if' list 'then' list ('elif' list 'then' list)* ['else' list] 'fi'
+//	          | ('while' | 'until') list 'do' list 'done'
+//	          | 'for' NAME ['in' WORD* (';' | '\n')] linebreak 'do' list 'done'
+//	          | 'case' WORD linebreak 'in' linebreak case_item* 'esac'
+//	case_item := ['('] WORD ('|' WORD)* ')' list [';;' linebreak]
+//	funcdef  := NAME '(' ')' linebreak compound redirect*
+//	          | 'function' NAME ['(' ')'] linebreak compound redirect*
+//	simple   := (ASSIGNMENT | redirect)* (WORD | redirect)*
+//	redirect := [IO_NUMBER] OP WORD
+
+// ErrUnexpectedEOF - строка закончилась посреди команды: незакрытые кавычки,
+// "|" или "&&" в конце, незакрытая скобка, here-документ без разделителя.
+var ErrUnexpectedEOF = errors.New("syntax error: unexpected end of file")
+
+const (
+	tokEOF = iota
+	tokNewline
+	tokWord
+	tokIONumber
+	tokOp
+)
+
+type token struct {
+	kind int
+	val  string
+	// aliases - псевдонимы, при раскрытии которых получен токен; они не
+	// раскрываются в нем повторно.
+	aliases []string
+	// body - тело here-документа, если слово - разделитель после "<<" или
+	// "<<-".
+	body string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF, tokNewline:
+		return "newline"
+	}
+	return t.val
+}
+
+// Операторы в порядке убывания длины, чтобы находилось самое длинное
+// совпадение.
+var operators = []string{
+	"&>>", "<<<", "<<-",
+	"&&", "||", ";;", "&>", ">>", ">&", "<&", ">|", "<<",
+	"|", "&", ";", "(", ")", "<", ">",
+}
+
+func isRedirectOp(op string) bool {
+	switch op {
+	case "&>>", "<<<", "<<-", "&>", ">>", ">&", "<&", ">|", "<<", "<", ">":
+		return true
+	}
+	return false
+}
+
+func isMetaChar(c byte) bool {
+	return strings.IndexByte(" \t\n|&;()<>", c) >= 0
+}
+
+// lexer разбивает строку на токены. Слова сохраняются как есть, с кавычками
+// и "$", их раскрытие выполняется позже, при запуске команды.
+type lexer struct {
+	src string
+	pos int
+}
+
+func tokenize(src string) ([]token, error) {
+	lx := &lexer{src: src}
+	tokens := []token{}
+	// heredocs - индексы разделителей here-документов, тела которых
+	// начинаются со следующей строки.
+	heredocs := []int{}
+
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if last := len(tokens) - 1; tok.kind == tokWord && last >= 0 && isHeredocOp(tokens[last]) {
+			heredocs = append(heredocs, len(tokens))
+		}
+		tokens = append(tokens, tok)
+
+		switch tok.kind {
+		case tokNewline:
+			for _, i := range heredocs {
+				body, err := lx.heredoc(tokens[i].val, tokens[i-1].val == "<<-")
+				if err != nil {
+					return nil, err
+				}
+				tokens[i].body = body
+			}
+			heredocs = heredocs[:0]
+		case tokEOF:
+			if len(heredocs) > 0 {
+				return nil, ErrUnexpectedEOF
+			}
+			return tokens, nil
+		}
+	}
+}
+
+func isHeredocOp(tok token) bool {
+	return tok.kind == tokOp && (tok.val == "<<" || tok.val == "<<-")
+}
+
+// heredoc читает тело here-документа до строки, равной разделителю word без
+// кавычек. С strip ("<<-") из начала строк тела и разделителя удаляются
+// табуляции.
+func (lx *lexer) heredoc(word string, strip bool) (string, error) {
+	delim, _ := unquoteWord(word)
+
+	var body strings.Builder
+	for lx.pos < len(lx.src) {
+		line := lx.src[lx.pos:]
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+			lx.pos++
+		}
+		lx.pos += len(line)
+
+		if strip {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == delim {
+			return body.String(), nil
+		}
+		body.WriteString(line + "\n")
+	}
+
+	return "", ErrUnexpectedEOF
+}
+
+// unquoteWord удаляет из слова кавычки и экранирующие "\" без подстановок;
+// quoted сообщает, были ли они.
+func unquoteWord(word string) (res string, quoted bool) {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		switch {
+		case quote == '\'' && c != '\'', quote == '"' && c != '"' && c != '\\':
+			b.WriteByte(c)
+		case c == '\'' || c == '"':
+			quoted = true
+			if quote == c {
+				quote = 0
+			} else {
+				quote = c
+			}
+		case c == '\\':
+			quoted = true
+			if i+1 < len(word) {
+				i++
+				if quote == '"' && strings.IndexByte("$`\"\\", word[i]) < 0 {
+					b.WriteByte('\\')
+				}
+				b.WriteByte(word[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), quoted
+}
+
+func (lx *lexer) next() (token, error) {
+	// Пропускаем пробелы и продолжения строки.
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		if c == ' ' || c == '\t' {
+			lx.pos++
+		} else if strings.HasPrefix(lx.src[lx.pos:], "\\\n") {
+			lx.pos += 2
+		} else {
+			break
+		}
+	}
+
+	if lx.pos == len(lx.src) {
+		return token{kind: tokEOF}, nil
+	}
+
+	// Комментарий до конца строки.
+	if lx.src[lx.pos] == '#' {
+		for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+			lx.pos++
+		}
+		return lx.next()
+	}
+
+	if lx.src[lx.pos] == '\n' {
+		lx.pos++
+		return token{kind: tokNewline, val: "\n"}, nil
+	}
+
+	rest := lx.src[lx.pos:]
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			lx.pos += len(op)
+			return token{kind: tokOp, val: op}, nil
+		}
+	}
+
+	// Номер дескриптора перед перенаправлением: "2>".
+	i := lx.pos
+	for i < len(lx.src) && lx.src[i] >= '0' && lx.src[i] <= '9' {
+		i++
+	}
+	if i > lx.pos && i < len(lx.src) && (lx.src[i] == '<' || lx.src[i] == '>') {
+		tok := token{kind: tokIONumber, val: lx.src[lx.pos:i]}
+		lx.pos = i
+		return tok, nil
+	}
+
+	start := lx.pos
+	if err := lx.scanWord(); err != nil {
+		return token{}, err
+	}
+
+	return token{kind: tokWord, val: lx.src[start:lx.pos]}, nil
+}
+
+// scanWord пропускает слово до первого незаэкранированного метасимвола вне
+// кавычек.
+func (lx *lexer) scanWord() error {
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		if isMetaChar(c) {
+			return nil
+		}
+
+		if err := lx.scanUnit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanUnit пропускает один элемент слова: символ, экранированный символ,
+// строку в кавычках или подстановку "$(...)", "${...}", "`...`".
+func (lx *lexer) scanUnit() error {
+	c := lx.src[lx.pos]
+
+	switch {
+	case c == '\\':
+		if lx.pos+1 == len(lx.src) {
+			return ErrUnexpectedEOF
+		}
+		lx.pos += 2
+	case c == '\'':
+		end := strings.IndexByte(lx.src[lx.pos+1:], '\'')
+		if end < 0 {
+			return ErrUnexpectedEOF
+		}
+		lx.pos += end + 2
+	case c == '"':
+		return lx.scanDoubleQuoted()
+	case c == '`':
+		return lx.scanBackquoted()
+	case c == '$' && lx.pos+1 < len(lx.src) && lx.src[lx.pos+1] == '(':
+		lx.pos++
+		return lx.scanSubstitution()
+	case c == '$' && lx.pos+1 < len(lx.src) && lx.src[lx.pos+1] == '{':
+		lx.pos++
+		return lx.scanNested('{', '}')
+	default:
+		lx.pos++
+	}
+
+	return nil
+}
+
+func (lx *lexer) scanDoubleQuoted() error {
+	lx.pos++
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '"':
+			lx.pos++
+			return nil
+		case c == '\\' || c == '`' || c == '$':
+			if err := lx.scanUnit(); err != nil {
+				return err
+			}
+		default:
+			lx.pos++
+		}
+	}
+
+	return ErrUnexpectedEOF
+}
+
+func (lx *lexer) scanBackquoted() error {
+	lx.pos++
+	for lx.pos < len(lx.src) {
+		switch lx.src[lx.pos] {
+		case '`':
+			lx.pos++
+			return nil
+		case '\\':
+			lx.pos++
+		}
+		lx.pos++
+	}
+
+	return ErrUnexpectedEOF
+}
+
+// scanNested пропускает содержимое скобок с учетом вложенности и кавычек.
+func (lx *lexer) scanNested(open byte, close byte) error {
+	depth := 0
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == open:
+			depth++
+			lx.pos++
+		case c == close:
+			depth--
+			lx.pos++
+			if depth == 0 {
+				return nil
+			}
+		case c == '\\' || c == '\'' || c == '"' || c == '`' || c == '$':
+			if err := lx.scanUnit(); err != nil {
+				return err
+			}
+		default:
+			lx.pos++
+		}
+	}
+
+	return ErrUnexpectedEOF
+}
+
+// Состояния case внутри подстановки команды.
+const (
+	// caseWord - после "case", до "in".
+	caseWord = iota
+	// casePattern - шаблоны варианта до ")".
+	casePattern
+	// caseBody - команды варианта до ";;" или "esac".
+	caseBody
+)
+
+// scanSubstitution пропускает подстановку "$(...)". Как scanNested, но
+// учитывает case: ")" после шаблона варианта не закрывает подстановку, - и
+// комментарии.
+func (lx *lexer) scanSubstitution() error {
+	depth := 0
+	// cases - состояния вложенных case, последний - внутренний.
+	var cases []int
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		state := -1
+		if len(cases) > 0 {
+			state = cases[len(cases)-1]
+		}
+
+		switch {
+		case state == casePattern && (c == '(' || c == ')'):
+			// Перед шаблоном может стоять необязательная "(".
+			if c == ')' {
+				cases[len(cases)-1] = caseBody
+			}
+			lx.pos++
+		case c == '(':
+			depth++
+			lx.pos++
+		case c == ')':
+			depth--
+			lx.pos++
+			if depth == 0 {
+				return nil
+			}
+		case c == '#' && (lx.pos == 0 || isMetaChar(lx.src[lx.pos-1])):
+			// Комментарий до конца строки: кавычки и скобки в нем не
+			// считаются.
+			if end := strings.IndexByte(lx.src[lx.pos:], '\n'); end >= 0 {
+				lx.pos += end
+			} else {
+				lx.pos = len(lx.src)
+			}
+		case state == caseBody && strings.HasPrefix(lx.src[lx.pos:], ";;"):
+			cases[len(cases)-1] = casePattern
+			lx.pos += 2
+		case isLetter(c) && (lx.pos == 0 || isMetaChar(lx.src[lx.pos-1])):
+			end := lx.pos
+			for end < len(lx.src) && isLetter(lx.src[end]) {
+				end++
+			}
+			if end == len(lx.src) || isMetaChar(lx.src[end]) {
+				switch word := lx.src[lx.pos:end]; {
+				case word == "case":
+					cases = append(cases, caseWord)
+				case word == "in" && state == caseWord:
+					cases[len(cases)-1] = casePattern
+				case word == "esac" && (state == casePattern || state == caseBody):
+					cases = cases[:len(cases)-1]
+				}
+			}
+			lx.pos = end
+		case c == '\\' || c == '\'' || c == '"' || c == '`' || c == '$':
+			if err := lx.scanUnit(); err != nil {
+				return err
+			}
+		default:
+			lx.pos++
+		}
+	}
+
+	return ErrUnexpectedEOF
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	// aliases - псевдонимы, раскрываемые на месте имени команды.
+	aliases map[string]string
+	// aliasNext - индекс слова после псевдонима, значение которого
+	// заканчивается пробелом: это слово тоже может быть псевдонимом.
+	aliasNext int
+}
+
+// parse разбирает строку в список команд.
+func parse(src string) (*listNode, error) {
+	return parseAliases(src, nil)
+}
+
+// parseAliases разбирает строку, раскрывая псевдонимы.
+func parseAliases(src string, aliases map[string]string) (*listNode, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, aliases: aliases, aliasNext: -1}
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &SyntaxError{token: tok.String()}
+	}
+
+	return list, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isOp(op string) bool {
+	tok := p.peek()
+	return tok.kind == tokOp && tok.val == op
+}
+
+// isReserved сообщает, является ли текущий токен зарезервированным словом.
+// Такие слова распознаются только на месте имени команды.
+func (p *parser) isReserved(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokWord && tok.val == word
+}
+
+func (p *parser) skipNewlines() {
+	for p.peek().kind == tokNewline {
+		p.advance()
+	}
+}
+
+// unexpected возвращает ошибку для текущего токена. Конец строки означает,
+// что команда не закончена.
+func (p *parser) unexpected() error {
+	tok := p.peek()
+	if tok.kind == tokEOF {
+		return ErrUnexpectedEOF
+	}
+	return &SyntaxError{token: tok.String()}
+}
+
+// isClosingWord сообщает, закрывает ли зарезервированное слово часть
+// составной команды. На месте имени команды такое слово завершает список.
+func isClosingWord(word string) bool {
+	switch word {
+	case "then", "elif", "else", "fi", "do", "done", "esac", "}":
+		return true
+	}
+	return false
+}
+
+// parseList разбирает команды до конца строки, закрывающей скобки, ";;" или
+// зарезервированного слова, закрывающего составную команду. Проверить, что
+// список закрыт нужным токеном, должен вызывающий.
+func (p *parser) parseList() (*listNode, error) {
+	list := &listNode{}
+	p.skipNewlines()
+
+	for {
+		tok := p.peek()
+		if tok.kind == tokEOF || p.isOp(")") || p.isOp(";;") || (tok.kind == tokWord && isClosingWord(tok.val)) {
+			return list, nil
+		}
+
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.items = append(list.items, andOr)
+
+		if p.isOp("&") {
+			andOr.background = true
+		}
+
+		if p.isOp(";") || p.isOp("&") || p.peek().kind == tokNewline {
+			p.advance()
+			p.skipNewlines()
+			continue
+		}
+
+		return list, nil
+	}
+}
+
+func (p *parser) parseAndOr() (*andOrNode, error) {
+	pipeline, err := p.parsePipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &andOrNode{pipelines: []*Pipeline{pipeline}}
+	for p.isOp("&&") || p.isOp("||") {
+		node.ops = append(node.ops, p.advance().val)
+		p.skipNewlines()
+
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		node.pipelines = append(node.pipelines, pipeline)
+	}
+
+	return node, nil
+}
+
+func (p *parser) parsePipeline() (*Pipeline, error) {
+	pipeline := &Pipeline{}
+	if p.isReserved("!") {
+		p.advance()
+		pipeline.negate = true
+	}
+
+	for {
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.cmds = append(pipeline.cmds, cmd)
+
+		if !p.isOp("|") {
+			return pipeline, nil
+		}
+
+		p.advance()
+		p.skipNewlines()
+	}
+}
+
+func (p *parser) parseCommand() (command, error) {
+	if _, err := p.expandAlias(); err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.kind == tokWord && isClosingWord(tok.val):
+		return nil, &SyntaxError{token: tok.val}
+	case p.isOp("("):
+		p.advance()
+		body, _, err := p.parseCompoundBody(")")
+		if err != nil {
+			return nil, err
+		}
+		node := &subshellNode{body: body}
+		node.redirects, err = p.parseRedirects()
+		return node, err
+	case p.isReserved("{"):
+		p.advance()
+		body, _, err := p.parseCompoundBody("}")
+		if err != nil {
+			return nil, err
+		}
+		node := &groupNode{body: body}
+		node.redirects, err = p.parseRedirects()
+		return node, err
+	case p.isReserved("if"):
+		return p.parseIf()
+	case p.isReserved("while"), p.isReserved("until"):
+		return p.parseLoop()
+	case p.isReserved("for"):
+		return p.parseFor()
+	case p.isReserved("case"):
+		return p.parseCase()
+	case p.isReserved("function") || p.isFuncDef():
+		return p.parseFuncDef()
+	}
+
+	return p.parseSimpleCommand()
+}
+
+// parseCompoundBody разбирает непустой список команд вместе с закрывающим
+// его токеном - одним из ends - и возвращает этот токен.
+func (p *parser) parseCompoundBody(ends ...string) (*listNode, string, error) {
+	body, err := p.parseList()
+	if err != nil {
+		return nil, "", err
+	}
+
+	tok := p.peek()
+	end := ""
+	for _, e := range ends {
+		if tok.val == e && tok.kind != tokIONumber {
+			end = e
+		}
+	}
+	if end == "" {
+		return nil, "", p.unexpected()
+	}
+
+	if len(body.items) == 0 {
+		return nil, "", &SyntaxError{token: end}
+	}
+
+	p.advance()
+	return body, end, nil
+}
+
+func (p *parser) parseIf() (command, error) {
+	p.advance()
+	node := &ifNode{}
+
+	for {
+		cond, _, err := p.parseCompoundBody("then")
+		if err != nil {
+			return nil, err
+		}
+
+		body, end, err := p.parseCompoundBody("elif", "else", "fi")
+		if err != nil {
+			return nil, err
+		}
+		node.conds = append(node.conds, cond)
+		node.bodies = append(node.bodies, body)
+
+		if end == "elif" {
+			continue
+		}
+
+		if end == "else" {
+			if node.elseBody, _, err = p.parseCompoundBody("fi"); err != nil {
+				return nil, err
+			}
+		}
+
+		node.redirects, err = p.parseRedirects()
+		return node, err
+	}
+}
+
+func (p *parser) parseLoop() (command, error) {
+	node := &loopNode{until: p.advance().val == "until"}
+
+	var err error
+	if node.cond, _, err = p.parseCompoundBody("do"); err != nil {
+		return nil, err
+	}
+	if node.body, _, err = p.parseCompoundBody("done"); err != nil {
+		return nil, err
+	}
+
+	node.redirects, err = p.parseRedirects()
+	return node, err
+}
+
+func (p *parser) parseFor() (command, error) {
+	p.advance()
+
+	tok := p.peek()
+	if tok.kind != tokWord {
+		return nil, p.unexpected()
+	}
+	if !isName(tok.val) {
+		return nil, fmt.Errorf("`%s': %w", tok.val, ErrInvalidName)
+	}
+	node := &forNode{name: p.advance().val}
+
+	p.skipNewlines()
+	if p.isReserved("in") {
+		p.advance()
+		node.words = []string{}
+		for p.peek().kind == tokWord {
+			node.words = append(node.words, p.advance().val)
+		}
+
+		if !p.isOp(";") && p.peek().kind != tokNewline {
+			return nil, p.unexpected()
+		}
+		p.advance()
+	} else if p.isOp(";") {
+		p.advance()
+	}
+
+	p.skipNewlines()
+	if !p.isReserved("do") {
+		return nil, p.unexpected()
+	}
+	p.advance()
+
+	var err error
+	if node.body, _, err = p.parseCompoundBody("done"); err != nil {
+		return nil, err
+	}
+
+	node.redirects, err = p.parseRedirects()
+	return node, err
+}
+
+func (p *parser) parseCase() (command, error) {
+	p.advance()
+
+	if p.peek().kind != tokWord {
+		return nil, &SyntaxError{token: p.peek().String()}
+	}
+	node := &caseNode{word: p.advance().val}
+
+	p.skipNewlines()
+	if !p.isReserved("in") {
+		return nil, p.unexpected()
+	}
+	p.advance()
+	p.skipNewlines()
+
+	for !p.isReserved("esac") {
+		item := &caseItem{}
+		if p.isOp("(") {
+			p.advance()
+		}
+
+		for {
+			if p.peek().kind != tokWord {
+				return nil, p.unexpected()
+			}
+			item.patterns = append(item.patterns, p.advance().val)
+
+			if !p.isOp("|") {
+				break
+			}
+			p.advance()
+		}
+
+		if !p.isOp(")") {
+			return nil, p.unexpected()
+		}
+		p.advance()
+
+		body, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		item.body = body
+		node.items = append(node.items, item)
+
+		// После последнего варианта ";;" можно опустить.
+		if p.isOp(";;") {
+			p.advance()
+			p.skipNewlines()
+		} else if !p.isReserved("esac") {
+			return nil, p.unexpected()
+		}
+	}
+	p.advance()
+
+	var err error
+	node.redirects, err = p.parseRedirects()
+	return node, err
+}
+
+// isFuncDef сообщает, начинается ли с текущего токена определение функции
+// "name()".
+func (p *parser) isFuncDef() bool {
+	if p.pos+2 >= len(p.tokens) {
+		return false
+	}
+
+	name, open, close := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	return name.kind == tokWord && open.kind == tokOp && open.val == "(" && close.kind == tokOp && close.val == ")"
+}
+
+func (p *parser) parseFuncDef() (command, error) {
+	keyword := p.isReserved("function")
+	if keyword {
+		p.advance()
+	}
+
+	tok := p.peek()
+	if tok.kind != tokWord {
+		return nil, p.unexpected()
+	}
+	if !isName(tok.val) || isReservedWord(tok.val) {
+		return nil, fmt.Errorf("`%s': %w", tok.val, ErrInvalidName)
+	}
+	node := &funcDef{name: p.advance().val}
+
+	if p.isOp("(") {
+		p.advance()
+		if !p.isOp(")") {
+			return nil, p.unexpected()
+		}
+		p.advance()
+	} else if !keyword {
+		return nil, p.unexpected()
+	}
+
+	// Тело функции - составная команда, возможно, с перенаправлениями.
+	p.skipNewlines()
+	start := p.pos
+	body, err := p.parseCommand()
+	if err != nil {
+		return nil, err
+	}
+	switch body.(type) {
+	case *simpleCommand, *funcDef:
+		p.pos = start
+		return nil, p.unexpected()
+	}
+
+	node.body = body
+	return node, nil
+}
+
+// isReservedWord сообщает, является ли слово зарезервированным.
+func isReservedWord(word string) bool {
+	switch word {
+	case "if", "while", "until", "for", "case", "function", "in", "{", "!":
+		return true
+	}
+	return isClosingWord(word)
+}
+
+func (p *parser) parseSimpleCommand() (command, error) {
+	cmd := &simpleCommand{}
+
+	for {
+		tok := p.peek()
+		if tok.kind == tokWord {
+			// Имя команды после присваиваний тоже может быть псевдонимом.
+			if len(cmd.words) == 0 && !isAssignment(tok.val) || p.pos == p.aliasNext {
+				expanded, err := p.expandAlias()
+				if err != nil {
+					return nil, err
+				}
+				if expanded {
+					continue
+				}
+			}
+
+			// NAME=value до имени команды - присваивание.
+			if len(cmd.words) == 0 && isAssignment(tok.val) {
+				cmd.assigns = append(cmd.assigns, p.advance().val)
+			} else {
+				cmd.words = append(cmd.words, p.advance().val)
+			}
+			continue
+		}
+
+		if tok.kind == tokIONumber || (tok.kind == tokOp && isRedirectOp(tok.val)) {
+			redir, err := p.parseRedirect()
+			if err != nil {
+				return nil, err
+			}
+			cmd.redirects = append(cmd.redirects, redir)
+			continue
+		}
+
+		break
+	}
+
+	if len(cmd.assigns) == 0 && len(cmd.words) == 0 && len(cmd.redirects) == 0 {
+		return nil, p.unexpected()
+	}
+
+	return cmd, nil
+}
+
+// expandAlias заменяет текущее слово значением псевдонима, пока это слово -
+// псевдоним, который не раскрывался при его получении: "alias ls='ls -F'"
+// не зацикливается. Слово в кавычках или с "\" и зарезервированные слова не
+// раскрываются.
+func (p *parser) expandAlias() (bool, error) {
+	expanded := false
+	// next - число токенов после псевдонима, значение которого
+	// заканчивается пробелом.
+	next := -1
+	for {
+		tok := p.peek()
+		value, ok := p.aliases[tok.val]
+		if tok.kind != tokWord || !ok || isReservedWord(tok.val) || strings.ContainsAny(tok.val, `'"\\`) || containsString(tok.aliases, tok.val) {
+			break
+		}
+
+		tokens, err := tokenize(value)
+		if err != nil {
+			return false, err
+		}
+		tokens = tokens[:len(tokens)-1]
+		from := append(tok.aliases[:len(tok.aliases):len(tok.aliases)], tok.val)
+		for i := range tokens {
+			tokens[i].aliases = from
+		}
+
+		rest := p.tokens[p.pos+1:]
+		p.tokens = append(append(p.tokens[:p.pos:p.pos], tokens...), rest...)
+		expanded = true
+
+		if strings.HasSuffix(value, " ") || strings.HasSuffix(value, "\t") {
+			next = len(rest)
+		}
+	}
+
+	if next >= 0 {
+		p.aliasNext = len(p.tokens) - next
+	}
+	return expanded, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseRedirects() ([]*redirect, error) {
+	redirects := []*redirect{}
+	for {
+		tok := p.peek()
+		if tok.kind != tokIONumber && (tok.kind != tokOp || !isRedirectOp(tok.val)) {
+			return redirects, nil
+		}
+
+		redir, err := p.parseRedirect()
+		if err != nil {
+			return nil, err
+		}
+		redirects = append(redirects, redir)
+	}
+}
+
+func (p *parser) parseRedirect() (*redirect, error) {
+	redir := &redirect{fd: -1}
+
+	if p.peek().kind == tokIONumber {
+		num := p.advance().val
+		fd, err := strconv.Atoi(num)
+		if err != nil || fd > 2 {
+			return nil, fmt.Errorf("%s: %w", num, ErrBadFd)
+		}
+		redir.fd = fd
+
+		if p.isOp("&>") || p.isOp("&>>") {
+			return nil, &SyntaxError{token: p.peek().val}
+		}
+	}
+
+	redir.op = p.advance().val
+	if redir.op == ">|" {
+		redir.op = ">"
+	}
+
+	if redir.fd == -1 {
+		redir.fd = 1
+		if strings.HasPrefix(redir.op, "<") {
+			redir.fd = 0
+		}
+	}
+
+	if p.peek().kind != tokWord {
+		return nil, &SyntaxError{token: p.peek().String()}
+	}
+
+	tok := p.advance()
+	redir.target, redir.body = tok.val, tok.body
+	return redir, nil
+}
@@ -0,0 +1,162 @@
+//go:build unix
+
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// matchPattern сопоставляет строку с шаблоном шелла целиком: "*" - любая
+// последовательность символов, "?" - любой символ, "[...]" - класс символов
+// ("[!...]" и "[^...]" - отрицание, "a-z" - диапазон), "\" экранирует
+// следующий символ. В отличие от path.Match, "*" совпадает и с "/".
+func matchPattern(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+
+			for i := 0; i <= len(s); {
+				if matchPattern(pattern, s[i:]) {
+					return true
+				}
+				if i == len(s) {
+					break
+				}
+				_, size := utf8.DecodeRuneInString(s[i:])
+				i += size
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(s)
+			pattern, s = pattern[1:], s[size:]
+		case '[':
+			if s == "" {
+				return false
+			}
+			r, size := utf8.DecodeRuneInString(s)
+			matched, rest, ok := matchClass(pattern, r)
+			if !ok {
+				// Незакрытая "[" - обычный символ.
+				if s[0] != '[' {
+					return false
+				}
+				pattern, s = pattern[1:], s[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pattern, s = rest, s[size:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			pr, psize := utf8.DecodeRuneInString(pattern)
+			r, size := utf8.DecodeRuneInString(s)
+			if s == "" || pr != r {
+				return false
+			}
+			pattern, s = pattern[psize:], s[size:]
+		}
+	}
+
+	return s == ""
+}
+
+// matchClass проверяет руну по классу "[...]" в начале шаблона и возвращает
+// остаток шаблона после класса. ok == false, если класс не закрыт.
+func matchClass(pattern string, r rune) (matched bool, rest string, ok bool) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+
+	for first := true; i < len(pattern); first = false {
+		if pattern[i] == ']' && !first {
+			return matched != negate, pattern[i+1:], true
+		}
+
+		lo, size := classRune(pattern[i:])
+		i += size
+		hi := lo
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			hi, size = classRune(pattern[i+1:])
+			i += size + 1
+		}
+
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+
+	return false, "", false
+}
+
+func classRune(s string) (rune, int) {
+	if s[0] == '\\' && len(s) > 1 {
+		r, size := utf8.DecodeRuneInString(s[1:])
+		return r, size + 1
+	}
+	return utf8.DecodeRuneInString(s)
+}
+
+// escapePattern экранирует символы шаблона, чтобы они совпадали буквально.
+func escapePattern(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// trimPattern удаляет из s префикс (suffix == false) или суффикс, совпадающий
+// с шаблоном: самый короткий или, если longest, самый длинный.
+func trimPattern(s string, pattern string, suffix bool, longest bool) string {
+	bounds := make([]int, 0, len(s)+1)
+	for i := range s {
+		bounds = append(bounds, i)
+	}
+	bounds = append(bounds, len(s))
+
+	for n := range bounds {
+		// Кратчайшее совпадение ищем от пустой строки, длиннейшее - от всей.
+		k := n
+		if longest {
+			k = len(bounds) - 1 - n
+		}
+
+		if suffix {
+			i := bounds[len(bounds)-1-k]
+			if matchPattern(pattern, s[i:]) {
+				return s[:i]
+			}
+		} else {
+			i := bounds[k]
+			if matchPattern(pattern, s[:i]) {
+				return s[i:]
+			}
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,318 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrPrintfUsage = errors.New("usage: printf [-v var] format [arguments]")
+var ErrInvalidNumber = errors.New("invalid number")
+var ErrInvalidFormat = errors.New("invalid format character")
+
+// printf выводит аргументы по формату, как printf(1): %s, %b (строка с
+// escape-последовательностями), %q (строка в кавычках шелла), %c, %d, %i,
+// %o, %u, %x, %X, %e, %E, %f, %F, %g, %G и %% с флагами, шириной и
+// точностью, в том числе "*". Если аргументов больше, чем преобразований,
+// формат применяется снова; недостающие аргументы считаются пустой строкой
+// или нулем. С -v результат присваивается переменной.
+func printf(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	name := ""
+	if len(args) > 0 && args[0] == "-v" {
+		if len(args) < 2 {
+			return Status{code: 2, err: fmt.Errorf("printf: -v: %w", ErrOptionRequiresArgument)}
+		}
+		name, args = args[1], args[2:]
+		if !isName(name) {
+			return Status{code: 2, err: fmt.Errorf("printf: `%s': %w", name, ErrInvalidName)}
+		}
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return Status{code: 2, err: fmt.Errorf("printf: %w", ErrPrintfUsage)}
+	}
+
+	f := &formatter{args: args[1:]}
+	for {
+		pos := f.pos
+		if err := f.format(args[0]); err != nil {
+			f.errs = append(f.errs, err)
+			break
+		}
+		if f.stop || f.pos == pos || f.pos >= len(f.args) {
+			break
+		}
+	}
+
+	if name != "" {
+		if err := opts.setVar(name, f.out.String()); err != nil {
+			return Status{code: 1, err: fmt.Errorf("printf: %w", err)}
+		}
+	} else if _, pErr := fmt.Fprint(cmd.stdout, f.out.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+
+	// Ошибки выводятся после результата, который собирается целиком.
+	status := Status{code: 0}
+	for _, err := range f.errs {
+		status = cmd.report(Status{code: 1, err: fmt.Errorf("printf: %w", err)})
+	}
+	return status
+}
+
+// formatter выводит аргументы printf по формату.
+type formatter struct {
+	args []string
+	pos  int
+	out  strings.Builder
+	errs []error
+	// stop - встретился "\c" в аргументе %b: вывод прекращается.
+	stop bool
+}
+
+// next возвращает следующий аргумент или пустую строку, если их не осталось.
+func (f *formatter) next() string {
+	if f.pos >= len(f.args) {
+		return ""
+	}
+	f.pos++
+	return f.args[f.pos-1]
+}
+
+// number разбирает числовой аргумент: десятичный, "0x" - шестнадцатеричный,
+// "0" - восьмеричный, а "'c" или "\"c" - код символа. При ошибке вывод
+// продолжается с нулем.
+func (f *formatter) number(arg string) int64 {
+	if arg == "" {
+		return 0
+	}
+	if arg[0] == '\'' || arg[0] == '"' {
+		if len(arg) == 1 {
+			return 0
+		}
+		return int64([]rune(arg[1:])[0])
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(arg), 0, 64)
+	if err != nil {
+		if u, uErr := strconv.ParseUint(strings.TrimSpace(arg), 0, 64); uErr == nil {
+			return int64(u)
+		}
+		f.errs = append(f.errs, fmt.Errorf("%s: %w", arg, ErrInvalidNumber))
+		return 0
+	}
+	return n
+}
+
+func (f *formatter) float(arg string) float64 {
+	if arg == "" {
+		return 0
+	}
+	if arg[0] == '\'' || arg[0] == '"' {
+		return float64(f.number(arg))
+	}
+
+	x, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+	if err != nil {
+		return float64(f.number(arg))
+	}
+	return x
+}
+
+// format выводит аргументы по формату один раз.
+func (f *formatter) format(format string) error {
+	for i := 0; i < len(format) && !f.stop; i++ {
+		switch c := format[i]; c {
+		case '\\':
+			s, n, _ := unescape(format[i:], false)
+			f.out.WriteString(s)
+			i += n - 1
+		case '%':
+			n, err := f.conversion(format[i:])
+			if err != nil {
+				return err
+			}
+			i += n - 1
+		default:
+			f.out.WriteByte(c)
+		}
+	}
+	return nil
+}
+
+// conversion выводит один аргумент по спецификации в начале spec и
+// возвращает ее длину.
+func (f *formatter) conversion(spec string) (int, error) {
+	i := 1
+	for i < len(spec) && strings.IndexByte("-+ #0", spec[i]) >= 0 {
+		i++
+	}
+	flags := spec[1:i]
+
+	// Ширина и точность берутся из формата или, если это "*", из аргументов.
+	width := ""
+	if i < len(spec) && spec[i] == '*' {
+		width = strconv.FormatInt(f.number(f.next()), 10)
+		i++
+	} else {
+		start := i
+		for i < len(spec) && isDigit(spec[i]) {
+			i++
+		}
+		width = spec[start:i]
+	}
+	if strings.HasPrefix(width, "-") {
+		flags, width = flags+"-", width[1:]
+	}
+
+	precision := ""
+	if i < len(spec) && spec[i] == '.' {
+		i++
+		if i < len(spec) && spec[i] == '*' {
+			precision = "." + strconv.FormatInt(f.number(f.next()), 10)
+			i++
+		} else {
+			start := i
+			for i < len(spec) && isDigit(spec[i]) {
+				i++
+			}
+			precision = "." + spec[start:i]
+		}
+	}
+
+	if i == len(spec) {
+		return i, fmt.Errorf("%s: %w", spec, ErrInvalidFormat)
+	}
+	verb := spec[i]
+	i++
+	goSpec := "%" + flags + width + precision
+
+	switch verb {
+	case '%':
+		f.out.WriteByte('%')
+	case 's':
+		fmt.Fprintf(&f.out, goSpec+"s", f.next())
+	case 'b':
+		s, _, stop := unescape(f.next(), true)
+		fmt.Fprintf(&f.out, goSpec+"s", s)
+		f.stop = stop
+	case 'q':
+		arg := f.next()
+		if arg == "" {
+			arg = "''"
+		}
+		fmt.Fprintf(&f.out, goSpec+"s", escapeWord(arg))
+	case 'c':
+		arg := f.next()
+		if arg != "" {
+			arg = arg[:1]
+		}
+		fmt.Fprintf(&f.out, "%"+flags+width+"s", arg)
+	case 'd', 'i':
+		fmt.Fprintf(&f.out, goSpec+"d", f.number(f.next()))
+	case 'u':
+		fmt.Fprintf(&f.out, goSpec+"d", uint64(f.number(f.next())))
+	case 'o', 'x', 'X':
+		fmt.Fprintf(&f.out, goSpec+string(verb), uint64(f.number(f.next())))
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		// Как и в C, точность по умолчанию - 6 знаков; %g в Go без
+		// точности выводит все значащие цифры.
+		if precision == "" {
+			goSpec += ".6"
+		}
+		fmt.Fprintf(&f.out, goSpec+string(verb), f.float(f.next()))
+	default:
+		return i, fmt.Errorf("%%%c: %w", verb, ErrInvalidFormat)
+	}
+	return i, nil
+}
+
+// unescape раскрывает escape-последовательность в начале s и возвращает ее
+// значение и длину; s, не начинающаяся с "\", раскрывается целиком. В
+// аргументах %b (arg) восьмеричный код пишется как \0NNN, а \c прекращает
+// вывод: тогда stop == true.
+func unescape(s string, arg bool) (res string, n int, stop bool) {
+	var b strings.Builder
+	i := 0
+	for i < len(s) {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			i++
+			if !arg {
+				return b.String(), i, false
+			}
+			continue
+		}
+
+		c := s[i+1]
+		i += 2
+		switch c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'e', 'E':
+			b.WriteByte('\x1b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '\\':
+			b.WriteByte('\\')
+		case 'c':
+			if arg {
+				return b.String(), i, true
+			}
+			b.WriteString(`\c`)
+		case 'x':
+			j := i
+			for j < len(s) && j < i+2 && isHexDigit(s[j]) {
+				j++
+			}
+			if j == i {
+				b.WriteString(`\x`)
+				break
+			}
+			code, _ := strconv.ParseUint(s[i:j], 16, 8)
+			b.WriteByte(byte(code))
+			i = j
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// В %b код начинается с нуля и может иметь еще три цифры.
+			start, limit := i-1, i+2
+			if arg && c == '0' {
+				start, limit = i, i+3
+			}
+			j := start
+			for j < len(s) && j < limit && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			code, _ := strconv.ParseUint("0"+s[start:j], 8, 16)
+			b.WriteByte(byte(code))
+			i = j
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		}
+
+		if !arg {
+			return b.String(), i, false
+		}
+	}
+	return b.String(), i, false
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,191 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPS1 - приглашение, если переменная PS1 не задана.
+const defaultPS1 = `\u@\H:\w $ `
+
+// defaultPS2 - приглашение для продолжения команды, если не задана PS2.
+const defaultPS2 = "> "
+
+// promptSegment возвращает текст сегмента приглашения "\{имя}"; пустая
+// строка - сегмент сейчас не нужен, например, вне git-репозитория.
+type promptSegment func(opts *options) string
+
+// promptSegments - сегменты, которые можно вставить в PS1 по имени.
+var promptSegments = map[string]promptSegment{
+	"git": gitBranch,
+}
+
+// prompt возвращает приглашение по шаблону $PS1.
+func (opts *options) prompt() string {
+	ps1, ok := opts.getVar("PS1")
+	if !ok {
+		ps1 = defaultPS1
+	}
+	return opts.expandPrompt(ps1, time.Now())
+}
+
+// continuationPrompt возвращает приглашение $PS2 для следующей строки
+// незаконченной команды.
+func (opts *options) continuationPrompt() string {
+	ps2, ok := opts.getVar("PS2")
+	if !ok {
+		ps2 = defaultPS2
+	}
+	return opts.expandPrompt(ps2, time.Now())
+}
+
+// expandPrompt раскрывает в шаблоне приглашения escape-последовательности
+// bash: \u - пользователь, \h и \H - имя хоста до первой точки и целиком, \w
+// и \W - текущий каталог и его последний элемент, \$ - "#" для root и "$"
+// для остальных, \t, \T, \@ и \A - время, \d - дата, \j - число заданий, \? -
+// код возврата последней команды, \e и \NNN - символы по коду (для цветов
+// ANSI), \{имя} - сегмент из promptSegments. \[ и \] обрамляют непечатаемые
+// символы; редактор строки и так не считает их в ширине приглашения.
+func (opts *options) expandPrompt(ps1 string, now time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(ps1); i++ {
+		if ps1[i] != '\\' || i+1 == len(ps1) {
+			b.WriteByte(ps1[i])
+			continue
+		}
+
+		i++
+		switch c := ps1[i]; c {
+		case 'u':
+			b.WriteString(opts.username)
+		case 'h':
+			host, _, _ := strings.Cut(opts.hostname, ".")
+			b.WriteString(host)
+		case 'H':
+			b.WriteString(opts.hostname)
+		case 'w':
+			b.WriteString(opts.promptDir())
+		case 'W':
+			if dir := opts.promptDir(); dir == "~" || dir == "/" {
+				b.WriteString(dir)
+			} else {
+				b.WriteString(filepath.Base(dir))
+			}
+		case '$':
+			if os.Geteuid() == 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('$')
+			}
+		case 't':
+			b.WriteString(now.Format("15:04:05"))
+		case 'T':
+			b.WriteString(now.Format("03:04:05"))
+		case '@':
+			b.WriteString(now.Format("03:04 PM"))
+		case 'A':
+			b.WriteString(now.Format("15:04"))
+		case 'd':
+			b.WriteString(now.Format("Mon Jan 02"))
+		case 'j':
+			if opts.jobs != nil {
+				b.WriteString(strconv.Itoa(len(opts.jobs.list())))
+			} else {
+				b.WriteByte('0')
+			}
+		case '?':
+			b.WriteString(strconv.Itoa(opts.lastCmdCode))
+		case 's':
+			b.WriteString(filepath.Base(opts.arg0))
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'a':
+			b.WriteByte('\a')
+		case 'e':
+			b.WriteByte('\x1b')
+		case '\\':
+			b.WriteByte('\\')
+		case '[', ']':
+		case '{':
+			end := strings.IndexByte(ps1[i:], '}')
+			segment, ok := promptSegment(nil), false
+			if end > 0 {
+				segment, ok = promptSegments[ps1[i+1:i+end]]
+			}
+			if !ok {
+				b.WriteString(`\{`)
+				continue
+			}
+			b.WriteString(segment(opts))
+			i += end
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(ps1) && j < i+3 && ps1[j] >= '0' && ps1[j] <= '7' {
+				j++
+			}
+			n, _ := strconv.ParseUint(ps1[i:j], 8, 8)
+			b.WriteByte(byte(n))
+			i = j - 1
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// promptDir возвращает текущий каталог, в котором домашний каталог заменен
+// на "~".
+func (opts *options) promptDir() string {
+	return opts.abbreviateHome(opts.workDir)
+}
+
+// gitBranch - сегмент "git": ветка git-репозитория, в котором находится
+// текущий каталог, или начало хеша коммита, если ветки нет.
+func gitBranch(opts *options) string {
+	for dir := opts.workDir; ; dir = filepath.Dir(dir) {
+		gitDir := filepath.Join(dir, ".git")
+		if info, err := os.Stat(gitDir); err == nil {
+			if !info.IsDir() {
+				// В рабочем дереве и подмодуле .git - файл "gitdir: путь".
+				data, err := os.ReadFile(gitDir)
+				if err != nil || !strings.HasPrefix(string(data), "gitdir: ") {
+					return ""
+				}
+				gitDir = strings.TrimSpace(string(data)[len("gitdir: "):])
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+			}
+			return headName(gitDir)
+		}
+
+		if dir == filepath.Dir(dir) {
+			return ""
+		}
+	}
+}
+
+// headName читает HEAD репозитория.
+func headName(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+
+	head := strings.TrimSpace(string(data))
+	if strings.HasPrefix(head, "ref: ") {
+		return strings.TrimPrefix(head[len("ref: "):], "refs/heads/")
+	}
+	if len(head) > 7 {
+		head = head[:7]
+	}
+	return head
+}
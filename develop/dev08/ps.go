@@ -0,0 +1,535 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("unknown format specifier")
+var ErrUnknownSortKey = errors.New("unknown sort specifier")
+var ErrBadProcStat = errors.New("malformed stat")
+
+// procRoot - файловая система proc, из которой ps читает процессы.
+const procRoot = "/proc"
+
+// clockTicks - единица времени в /proc/<pid>/stat (sysconf(_SC_CLK_TCK)),
+// на Linux всегда 100.
+const clockTicks = 100
+
+// process - сведения о процессе из /proc/<pid>/stat, status и cmdline.
+type process struct {
+	pid   int
+	ppid  int
+	state string
+	comm  string
+	// args - аргументы командной строки, пустые у потоков ядра и зомби.
+	args []string
+	uid  int
+	user string
+	// tty - номер устройства управляющего терминала, 0 - терминала нет.
+	tty int
+	// cpu - время процессора в тиках, start - время запуска.
+	cpu   int64
+	start time.Time
+	// rss и vsz - память в килобайтах.
+	rss int64
+	vsz int64
+}
+
+// readProcesses читает все процессы из каталога root, устроенного как /proc.
+// Процессы, завершившиеся во время чтения, пропускаются.
+func readProcesses(root string) ([]*process, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	boot, err := bootTime(root)
+	if err != nil {
+		return nil, err
+	}
+
+	users := map[int]string{}
+	procs := []*process{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		p, err := readProcess(root, pid, boot)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		name, ok := users[p.uid]
+		if !ok {
+			name = strconv.Itoa(p.uid)
+			if u, err := user.LookupId(name); err == nil {
+				name = u.Username
+			}
+			users[p.uid] = name
+		}
+		p.user = name
+
+		procs = append(procs, p)
+	}
+
+	sort.Slice(procs, func(i, j int) bool { return procs[i].pid < procs[j].pid })
+	return procs, nil
+}
+
+// bootTime возвращает время загрузки системы из строки "btime" файла stat.
+func bootTime(root string) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(root, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "btime ") {
+			sec, err := strconv.ParseInt(strings.TrimSpace(line[len("btime "):]), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s: %w", filepath.Join(root, "stat"), ErrBadProcStat)
+}
+
+func readProcess(root string, pid int, boot time.Time) (*process, error) {
+	dir := filepath.Join(root, strconv.Itoa(pid))
+	p := &process{pid: pid}
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.parseStat(string(stat), boot); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, "stat"), err)
+	}
+
+	status, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer status.Close()
+	if err := p.parseStatus(status); err != nil {
+		return nil, err
+	}
+
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	if cmdline = bytes.TrimRight(cmdline, "\x00"); len(cmdline) > 0 {
+		p.args = strings.Split(string(cmdline), "\x00")
+	}
+
+	return p, nil
+}
+
+// parseStat разбирает /proc/<pid>/stat. Имя команды в скобках может
+// содержать пробелы и скобки, поэтому поля отсчитываются от последней ")".
+func (p *process) parseStat(stat string, boot time.Time) error {
+	open, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return ErrBadProcStat
+	}
+	p.comm = stat[open+1 : end]
+
+	// Поля после имени, начиная с состояния (поле 3 в proc(5)).
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return ErrBadProcStat
+	}
+
+	var err error
+	num := func(i int) int64 {
+		v, numErr := strconv.ParseInt(fields[i], 10, 64)
+		if numErr != nil {
+			err = ErrBadProcStat
+		}
+		return v
+	}
+
+	p.state = fields[0]
+	p.ppid = int(num(1))
+	p.tty = int(num(4))
+	p.cpu = num(11) + num(12)
+	p.start = boot.Add(time.Duration(num(19)) * time.Second / clockTicks)
+	return err
+}
+
+// parseStatus берет из /proc/<pid>/status действующий UID и память.
+func (p *process) parseStatus(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch name {
+		case "Uid":
+			if len(fields) > 1 {
+				p.uid, _ = strconv.Atoi(fields[1])
+			}
+		case "VmRSS":
+			p.rss, _ = strconv.ParseInt(fields[0], 10, 64)
+		case "VmSize":
+			p.vsz, _ = strconv.ParseInt(fields[0], 10, 64)
+		}
+	}
+	return scanner.Err()
+}
+
+// command возвращает командную строку процесса, а если ее нет - имя в
+// квадратных скобках, как у потоков ядра.
+func (p *process) command() string {
+	if len(p.args) == 0 {
+		return "[" + p.comm + "]"
+	}
+	return strings.Join(p.args, " ")
+}
+
+// ttyName возвращает имя терминала по номеру устройства: "pts/0", "tty1"
+// или "?", если терминала нет.
+func ttyName(dev int) string {
+	major, minor := (dev>>8)&0xfff, (dev&0xff)|((dev>>12)&0xfff00)
+	switch {
+	case dev == 0:
+		return "?"
+	case major >= 136 && major <= 143:
+		return fmt.Sprintf("pts/%d", (major-136)*256+minor)
+	case major == 4 && minor < 64:
+		return fmt.Sprintf("tty%d", minor)
+	case major == 4:
+		return fmt.Sprintf("ttyS%d", minor-64)
+	}
+	return fmt.Sprintf("%d,%d", major, minor)
+}
+
+// formatCPUTime форматирует время процессора как [DD-]HH:MM:SS.
+func formatCPUTime(ticks int64) string {
+	sec := ticks / clockTicks
+	res := fmt.Sprintf("%02d:%02d:%02d", sec/3600%24, sec/60%60, sec%60)
+	if days := sec / 86400; days > 0 {
+		res = fmt.Sprintf("%d-%s", days, res)
+	}
+	return res
+}
+
+// psColumn - колонка вывода ps.
+type psColumn struct {
+	header string
+	// right - числовая колонка, выравнивается по правому краю.
+	right bool
+	value func(p *process) string
+	// key - ключ сортировки; nil - сортировка по value.
+	key func(p *process) int64
+}
+
+var psColumns = map[string]psColumn{
+	"pid": {header: "PID", right: true,
+		value: func(p *process) string { return strconv.Itoa(p.pid) },
+		key:   func(p *process) int64 { return int64(p.pid) }},
+	"ppid": {header: "PPID", right: true,
+		value: func(p *process) string { return strconv.Itoa(p.ppid) },
+		key:   func(p *process) int64 { return int64(p.ppid) }},
+	"uid": {header: "UID", right: true,
+		value: func(p *process) string { return strconv.Itoa(p.uid) },
+		key:   func(p *process) int64 { return int64(p.uid) }},
+	"user": {header: "USER",
+		value: func(p *process) string { return p.user }},
+	"rss": {header: "RSS", right: true,
+		value: func(p *process) string { return strconv.FormatInt(p.rss, 10) },
+		key:   func(p *process) int64 { return p.rss }},
+	"vsz": {header: "VSZ", right: true,
+		value: func(p *process) string { return strconv.FormatInt(p.vsz, 10) },
+		key:   func(p *process) int64 { return p.vsz }},
+	"tty": {header: "TTY",
+		value: func(p *process) string { return ttyName(p.tty) }},
+	"stat": {header: "STAT",
+		value: func(p *process) string { return p.state }},
+	"time": {header: "TIME", right: true,
+		value: func(p *process) string { return formatCPUTime(p.cpu) },
+		key:   func(p *process) int64 { return p.cpu }},
+	"stime": {header: "STIME",
+		value: func(p *process) string {
+			// Процессы, запущенные не сегодня, показываются с датой.
+			if p.start.Format("20060102") != time.Now().Format("20060102") {
+				return p.start.Format("Jan02")
+			}
+			return p.start.Format("15:04")
+		},
+		key: func(p *process) int64 { return p.start.UnixNano() }},
+	"comm": {header: "COMMAND",
+		value: func(p *process) string { return p.comm }},
+	"cmd": {header: "CMD",
+		value: func(p *process) string { return p.command() }},
+	"args": {header: "COMMAND",
+		value: func(p *process) string { return p.command() }},
+}
+
+// Форматы вывода ps: по умолчанию и с -f.
+const (
+	psDefaultFormat = "pid,tty,time,comm=CMD"
+	psFullFormat    = "user=UID,pid,ppid,stime,tty,time,cmd"
+)
+
+// psField - колонка в формате -o: "name" или "name=ЗАГОЛОВОК".
+type psField struct {
+	psColumn
+	header string
+}
+
+func parsePsFormat(format string) ([]psField, error) {
+	fields := []psField{}
+	for _, spec := range strings.Split(format, ",") {
+		name, header, hasHeader := strings.Cut(spec, "=")
+		column, ok := psColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", name, ErrUnknownFormat)
+		}
+		if !hasHeader {
+			header = column.header
+		}
+		fields = append(fields, psField{psColumn: column, header: header})
+	}
+	return fields, nil
+}
+
+// psSort - ключ сортировки "--sort": "-name" - по убыванию.
+type psSort struct {
+	psColumn
+	desc bool
+}
+
+func parsePsSort(spec string) ([]psSort, error) {
+	keys := []psSort{}
+	for _, name := range strings.Split(spec, ",") {
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimLeft(name, "+-")
+		column, ok := psColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", name, ErrUnknownSortKey)
+		}
+		keys = append(keys, psSort{psColumn: column, desc: desc})
+	}
+	return keys, nil
+}
+
+// compare сравнивает процессы по ключу: -1, 0 или 1.
+func (s psSort) compare(a, b *process) int {
+	res := 0
+	if s.key != nil {
+		ka, kb := s.key(a), s.key(b)
+		if ka < kb {
+			res = -1
+		} else if ka > kb {
+			res = 1
+		}
+	} else {
+		res = strings.Compare(s.value(a), s.value(b))
+	}
+
+	if s.desc {
+		res = -res
+	}
+	return res
+}
+
+// ps выводит процессы: без аргументов - процессы текущего пользователя на
+// терминале шелла, с -e (-A) - все. -f выводит полный формат, -o задает
+// колонки (pid, ppid, uid, user, rss, vsz, tty, stat, time, stime, comm,
+// cmd, args), --sort - порядок, например --sort=-rss,pid. Без /proc, как в
+// macOS и BSD, выполняется системная ps.
+func ps(cmd *CMD, opts *options) Status {
+	return psFrom(cmd, opts, procRoot)
+}
+
+func psFrom(cmd *CMD, opts *options, root string) Status {
+	if _, err := os.Stat(filepath.Join(root, "stat")); err != nil {
+		return run(cmd, opts)
+	}
+
+	all := false
+	format := psDefaultFormat
+	formats := []string{}
+	sortSpec := ""
+
+	args := cmd.args
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+
+		switch {
+		case arg == "--sort" || strings.HasPrefix(arg, "--sort="):
+			if strings.HasPrefix(arg, "--sort=") {
+				sortSpec = arg[len("--sort="):]
+				continue
+			}
+			if len(args) == 0 {
+				return Status{code: 1, err: fmt.Errorf("ps: --sort: %w", ErrOptionRequiresArgument)}
+			}
+			sortSpec, args = args[0], args[1:]
+		case strings.HasPrefix(arg, "-") && len(arg) > 1 && !strings.HasPrefix(arg, "--"):
+			// Короткие флаги можно объединять: "-ef", "-eo pid".
+			for i := 1; i < len(arg); i++ {
+				switch arg[i] {
+				case 'e', 'A':
+					all = true
+				case 'f':
+					format = psFullFormat
+				case 'o':
+					value := arg[i+1:]
+					if value == "" {
+						if len(args) == 0 {
+							return Status{code: 1, err: fmt.Errorf("ps: -o: %w", ErrOptionRequiresArgument)}
+						}
+						value, args = args[0], args[1:]
+					}
+					formats = append(formats, value)
+					i = len(arg)
+				default:
+					return Status{code: 1, err: fmt.Errorf("ps: -%c: %w", arg[i], ErrInvalidOption)}
+				}
+			}
+		default:
+			return Status{code: 1, err: fmt.Errorf("ps: %s: %w", arg, ErrInvalidOption)}
+		}
+	}
+
+	if len(formats) > 0 {
+		format = strings.Join(formats, ",")
+	}
+	fields, err := parsePsFormat(format)
+	if err != nil {
+		return Status{code: 1, err: fmt.Errorf("ps: %w", err)}
+	}
+
+	var keys []psSort
+	if sortSpec != "" {
+		if keys, err = parsePsSort(sortSpec); err != nil {
+			return Status{code: 1, err: fmt.Errorf("ps: %w", err)}
+		}
+	}
+
+	procs, err := readProcesses(root)
+	if err != nil {
+		return Status{code: 1, err: fmt.Errorf("ps: %w", err)}
+	}
+
+	if !all {
+		procs = sameTerminal(procs, opts.pid)
+	}
+
+	sort.SliceStable(procs, func(i, j int) bool {
+		for _, key := range keys {
+			if res := key.compare(procs[i], procs[j]); res != 0 {
+				return res < 0
+			}
+		}
+		return false
+	})
+
+	if pErr := writeProcesses(cmd.stdout, fields, procs); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return Status{code: 0}
+}
+
+// sameTerminal оставляет процессы того же пользователя и с тем же
+// терминалом, что и процесс self.
+func sameTerminal(procs []*process, self int) []*process {
+	var me *process
+	for _, p := range procs {
+		if p.pid == self {
+			me = p
+		}
+	}
+	if me == nil {
+		return nil
+	}
+
+	res := []*process{}
+	for _, p := range procs {
+		if p.uid == me.uid && p.tty == me.tty {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// writeProcesses выводит таблицу процессов. Ширина колонки - по самому
+// длинному значению, последняя колонка не дополняется пробелами.
+func writeProcesses(w io.Writer, fields []psField, procs []*process) error {
+	// Заголовок не выводится, если все заголовки пустые: "-o pid=".
+	header := make([]string, len(fields))
+	rows := [][]string{}
+	for i, field := range fields {
+		header[i] = field.header
+		if field.header != "" && len(rows) == 0 {
+			rows = append(rows, header)
+		}
+	}
+	for _, p := range procs {
+		row := make([]string, len(fields))
+		for i, field := range fields {
+			row[i] = field.value(p)
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(fields))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				line.WriteByte(' ')
+			}
+
+			pad := strings.Repeat(" ", widths[i]-len([]rune(cell)))
+			if fields[i].right {
+				line.WriteString(pad + cell)
+			} else {
+				line.WriteString(cell + pad)
+			}
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteByte('\n')
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,185 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// read читает строку из stdin и присваивает ее поля, разделенные по IFS,
+// переменным name; последней достается остаток строки, а без имен вся
+// строка попадает в $REPLY. Без -r обратная косая черта экранирует
+// следующий символ, а перед концом строки продолжает ее. -d задает
+// разделитель строк вместо перевода строки, -p - приглашение, которое
+// выводится, только если stdin - терминал. Код возврата 1 - конец ввода.
+func read(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	raw := false
+	delim := byte('\n')
+	prompt := ""
+
+options:
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			c := arg[i]
+			if c == 'r' {
+				raw = true
+				continue
+			}
+			if c != 'd' && c != 'p' {
+				return Status{code: 2, err: fmt.Errorf("read: -%c: %w", c, ErrInvalidOption)}
+			}
+
+			// Значение опции - остаток аргумента или следующий аргумент.
+			value := arg[i+1:]
+			if value == "" {
+				if len(args) == 0 {
+					return Status{code: 2, err: fmt.Errorf("read: -%c: %w", c, ErrOptionRequiresArgument)}
+				}
+				value, args = args[0], args[1:]
+			}
+			if c == 'p' {
+				prompt = value
+			} else if value == "" {
+				delim = 0
+			} else {
+				delim = value[0]
+			}
+			continue options
+		}
+	}
+
+	names := args
+	for _, name := range names {
+		if !isName(name) {
+			return Status{code: 1, err: fmt.Errorf("read: `%s': %w", name, ErrInvalidName)}
+		}
+	}
+
+	if f, ok := cmd.stdin.(*os.File); ok && prompt != "" && isTerminal(f) {
+		fmt.Fprint(cmd.stderr, prompt)
+	}
+
+	line, escaped, err := readLine(cmd.stdin, delim, raw)
+	if err != nil && err != io.EOF {
+		return Status{code: 1, err: fmt.Errorf("read: %w", err)}
+	}
+
+	if len(names) == 0 {
+		opts.setVar("REPLY", string(line))
+	} else {
+		ifs, ok := opts.getVar("IFS")
+		if !ok {
+			ifs = defaultIFS
+		}
+		fields := splitRead(line, escaped, ifs, len(names))
+		for i, name := range names {
+			value := ""
+			if i < len(fields) {
+				value = fields[i]
+			}
+			if err := opts.setVar(name, value); err != nil {
+				return Status{code: 1, err: fmt.Errorf("read: %w", err)}
+			}
+		}
+	}
+
+	if err == io.EOF {
+		return Status{code: 1}
+	}
+	return Status{code: 0}
+}
+
+// readLine читает строку до delim по одному байту, чтобы не забрать из
+// общего stdin ничего сверх нее: следующую строку может прочитать другая
+// команда. escaped отмечает символы, экранированные обратной косой чертой;
+// они не разделяют поля. В конце ввода возвращается io.EOF вместе с
+// прочитанным.
+func readLine(r io.Reader, delim byte, raw bool) (line []byte, escaped []bool, err error) {
+	if r == nil {
+		return nil, nil, io.EOF
+	}
+
+	var buf [1]byte
+	backslash := false
+	for {
+		n, err := r.Read(buf[:])
+		if n == 0 {
+			if err == nil {
+				continue
+			}
+			return line, escaped, err
+		}
+
+		c := buf[0]
+		switch {
+		case backslash:
+			backslash = false
+			if c == '\n' || c == delim {
+				continue
+			}
+			line = append(line, c)
+			escaped = append(escaped, true)
+		case c == delim:
+			return line, escaped, nil
+		case c == '\\' && !raw:
+			backslash = true
+		default:
+			line = append(line, c)
+			escaped = append(escaped, false)
+		}
+	}
+}
+
+// splitRead делит строку на не более чем n полей по IFS: пробельные
+// разделители IFS по краям отбрасываются, а подряд идущие считаются одним, и
+// последнее поле - остаток строки без пробельных разделителей в конце.
+func splitRead(line []byte, escaped []bool, ifs string, n int) []string {
+	isDelim := func(i int) bool {
+		return !escaped[i] && strings.IndexByte(ifs, line[i]) >= 0
+	}
+	isSpace := func(i int) bool {
+		return isDelim(i) && strings.IndexByte(defaultIFS, line[i]) >= 0
+	}
+	skipSpaces := func(i int) int {
+		for i < len(line) && isSpace(i) {
+			i++
+		}
+		return i
+	}
+
+	fields := []string{}
+	i := skipSpaces(0)
+	for len(fields) < n-1 && i < len(line) {
+		start := i
+		for i < len(line) && !isDelim(i) {
+			i++
+		}
+		fields = append(fields, string(line[start:i]))
+
+		// Разделитель поля - пробельные символы вокруг не более чем одного
+		// непробельного символа IFS.
+		i = skipSpaces(i)
+		if i < len(line) && isDelim(i) {
+			i = skipSpaces(i + 1)
+		}
+	}
+
+	end := len(line)
+	for end > i && isSpace(end-1) {
+		end--
+	}
+	if i < end {
+		fields = append(fields, string(line[i:end]))
+	}
+	return fields
+}
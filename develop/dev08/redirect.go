@@ -0,0 +1,196 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError - синтаксическая ошибка в строке команды с указанием токена, на
+// котором разбор не удался.
+type SyntaxError struct {
+	token string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error near unexpected token `%s'", e.token)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrInvalidSyntax
+}
+
+// redirect - перенаправление ввода-вывода команды, например "2>>log" или "2>&1".
+type redirect struct {
+	// fd - перенаправляемый дескриптор: 0, 1 или 2.
+	fd int
+	// op - оператор без номера дескриптора: ">", ">>", "<", ">&", "<&", "&>",
+	// "&>>", "<<<", "<<" или "<<-".
+	op string
+	// target - имя файла, номер дескриптора для ">&" и "<&", строка для "<<<"
+	// или разделитель here-документа в исходном виде, раскрывается при
+	// выполнении команды.
+	target string
+	// body - тело here-документа. Если в разделителе нет кавычек, в теле
+	// при выполнении подставляются параметры и команды.
+	body string
+}
+
+func (r *redirect) String() string {
+	fd := strconv.Itoa(r.fd)
+	switch {
+	case strings.HasPrefix(r.op, "&"):
+		fd = ""
+	case strings.HasPrefix(r.op, "<") && r.fd == 0:
+		fd = ""
+	case strings.HasPrefix(r.op, ">") && r.fd == 1:
+		fd = ""
+	}
+	return fd + r.op + r.target
+}
+
+var ErrBadFd = errors.New("bad file descriptor")
+var ErrAmbiguousRedirect = errors.New("ambiguous redirect")
+
+// applyRedirects подменяет потоки согласно перенаправлениям, слева направо,
+// как в bash: "2>&1 >file" и ">file 2>&1" дают разный результат. Цели
+// перенаправлений раскрываются здесь же. Возвращает открытые файлы, которые
+// нужно закрыть после выполнения команды.
+func (s *streams) applyRedirects(redirects []*redirect, opts *options) ([]io.Closer, error) {
+	closers := []io.Closer{}
+
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+
+	for _, redir := range redirects {
+		if redir.op == "<<" || redir.op == "<<-" {
+			body := redir.body
+			if _, quoted := unquoteWord(redir.target); !quoted {
+				var err error
+				if body, err = opts.expandHeredoc(body, *s); err != nil {
+					closeAll()
+					return nil, err
+				}
+			}
+			if err := s.setInput(redir.fd, strings.NewReader(body)); err != nil {
+				closeAll()
+				return nil, err
+			}
+			continue
+		}
+
+		words, err := opts.expandWords([]string{redir.target}, *s)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+
+		if len(words) != 1 {
+			closeAll()
+			return nil, fmt.Errorf("%s: %w", redir.target, ErrAmbiguousRedirect)
+		}
+
+		target := words[0]
+		if redir.op == ">" || redir.op == ">>" || redir.op == "&>" || redir.op == "&>>" {
+			if err := opts.restrictRedirect(target); err != nil {
+				closeAll()
+				return nil, err
+			}
+		}
+
+		var file *os.File
+
+		switch redir.op {
+		case ">", "&>":
+			file, err = os.OpenFile(opts.path(target), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		case ">>", "&>>":
+			file, err = os.OpenFile(opts.path(target), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		case "<":
+			file, err = os.Open(opts.path(target))
+		}
+
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+
+		if file != nil {
+			closers = append(closers, file)
+		}
+
+		switch redir.op {
+		case "<":
+			err = s.setInput(redir.fd, file)
+		case "<<<":
+			err = s.setInput(redir.fd, strings.NewReader(target+"\n"))
+		case "&>", "&>>":
+			s.stdout = file
+			s.stderr = file
+		case ">&", "<&":
+			src, convErr := strconv.Atoi(target)
+			if convErr != nil || src < 0 || src > 2 {
+				err = fmt.Errorf("%s: %w", target, ErrBadFd)
+			} else {
+				err = s.dupFd(redir.fd, src)
+			}
+		default:
+			err = s.setOutput(redir.fd, file)
+		}
+
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+	}
+
+	return closers, nil
+}
+
+func (s *streams) setInput(fd int, r io.Reader) error {
+	if fd != 0 {
+		return fmt.Errorf("%d: %w", fd, ErrBadFd)
+	}
+
+	s.stdin = r
+	return nil
+}
+
+func (s *streams) setOutput(fd int, w io.Writer) error {
+	switch fd {
+	case 1:
+		s.stdout = w
+	case 2:
+		s.stderr = w
+	default:
+		return fmt.Errorf("%d: %w", fd, ErrBadFd)
+	}
+
+	return nil
+}
+
+// dupFd делает дескриптор fd копией дескриптора src.
+func (s *streams) dupFd(fd int, src int) error {
+	if fd == src {
+		return nil
+	}
+
+	// Дублировать можно только выходные потоки.
+	if fd == 0 || src == 0 {
+		return fmt.Errorf("%d: %w", src, ErrBadFd)
+	}
+
+	w := s.stdout
+	if src == 2 {
+		w = s.stderr
+	}
+
+	return s.setOutput(fd, w)
+}
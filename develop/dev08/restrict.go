@@ -0,0 +1,332 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var ErrRestricted = errors.New("restricted")
+var ErrCommandTimedOut = errors.New("command timed out")
+var ErrInvalidRestriction = errors.New("invalid restriction")
+
+// defaultRestrictionFile - настройки ограниченного режима, если шелл запущен
+// с -r без --restrictions.
+const defaultRestrictionFile = "/etc/wbsh/restricted"
+
+// Переменные окружения, с которыми шелл запускает сам себя, чтобы поставить
+// лимиты ресурсов до exec программы: exec.Cmd не умеет задавать их
+// дочернему процессу.
+const (
+	rlimitPathEnv = "WBSH_RLIMIT_PATH"
+	rlimitsEnv    = "WBSH_RLIMITS"
+)
+
+// restriction - ограниченный режим (-r) для консоли, которую выдают
+// пользователю: нельзя менять каталог и PATH, перенаправлять вывод в файлы
+// и запускать внешние команды, кроме разрешенных в файле настроек.
+type restriction struct {
+	// allowed - имена внешних команд, которые можно запускать.
+	allowed map[string]bool
+	// path - значение PATH, если оно задано в настройках.
+	path string
+	// limits - лимиты ресурсов процессов внешних команд, timeout - время
+	// их выполнения, 0 - без ограничения.
+	limits  []rlimit
+	timeout time.Duration
+}
+
+// rlimit - лимит ресурса процесса, как в setrlimit(2).
+type rlimit struct {
+	resource int
+	value    uint64
+}
+
+// rlimitNames - ресурсы, которые можно ограничить в настройках: время
+// процессора в секундах, адресное пространство в байтах и число открытых
+// файлов.
+var rlimitNames = map[string]int{
+	"cpu":    syscall.RLIMIT_CPU,
+	"memory": rlimitMemory,
+	"files":  syscall.RLIMIT_NOFILE,
+}
+
+// restrictedVars - переменные, которые нельзя менять в ограниченном режиме.
+var restrictedVars = map[string]bool{
+	"PATH":     true,
+	"SHELL":    true,
+	"ENV":      true,
+	"HISTFILE": true,
+	// Через них можно было бы запустить другую программу вместо
+	// разрешенной.
+	rlimitPathEnv: true,
+	rlimitsEnv:    true,
+}
+
+// restrictedBuiltins - встроенные команды, запрещенные в ограниченном
+// режиме: они меняют каталог или заменяют шелл программой.
+var restrictedBuiltins = map[string]bool{
+	"cd":    true,
+	"pushd": true,
+	"popd":  true,
+	"exec":  true,
+}
+
+// loadRestriction читает настройки ограниченного режима. Каждая строка -
+// директива:
+//
+//	allow name...             разрешить внешние команды
+//	path dir[:dir...]         значение PATH
+//	limit cpu|memory|files N  лимит ресурса; у memory допустимы суффиксы K, M, G
+//	timeout время             наибольшее время выполнения команды: "30s", "5m"
+//	                          или число секунд
+//
+// Пустые строки и строки, начинающиеся с "#", пропускаются. Если файла по
+// умолчанию нет, разрешены только встроенные команды.
+func loadRestriction(path string, isDefault bool) (*restriction, error) {
+	r := &restriction{allowed: map[string]bool{}}
+	f, err := os.Open(path)
+	if isDefault && errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := r.parse(fields); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parse применяет одну директиву настроек.
+func (r *restriction) parse(fields []string) error {
+	directive, args := fields[0], fields[1:]
+	invalid := fmt.Errorf("%s: %w", strings.Join(fields, " "), ErrInvalidRestriction)
+
+	switch directive {
+	case "allow":
+		for _, name := range args {
+			if strings.Contains(name, "/") {
+				return invalid
+			}
+			r.allowed[name] = true
+		}
+	case "path":
+		if len(args) != 1 {
+			return invalid
+		}
+		r.path = args[0]
+	case "limit":
+		if len(args) != 2 {
+			return invalid
+		}
+		resource, ok := rlimitNames[args[0]]
+		if !ok {
+			return invalid
+		}
+		value, err := parseSize(args[1])
+		if err != nil {
+			return invalid
+		}
+		r.limits = append(r.limits, rlimit{resource: resource, value: value})
+	case "timeout":
+		if len(args) != 1 {
+			return invalid
+		}
+		if seconds, err := strconv.ParseUint(args[0], 10, 32); err == nil {
+			r.timeout = time.Duration(seconds) * time.Second
+			break
+		}
+		timeout, err := time.ParseDuration(args[0])
+		if err != nil || timeout < 0 {
+			return invalid
+		}
+		r.timeout = timeout
+	default:
+		return invalid
+	}
+	return nil
+}
+
+// parseSize разбирает число с необязательным суффиксом K, M или G.
+func parseSize(s string) (uint64, error) {
+	shift := 0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n > (1<<64-1)>>shift {
+		return 0, strconv.ErrRange
+	}
+	return n << shift, nil
+}
+
+// restrictBuiltin запрещает встроенные команды, которые позволили бы выйти
+// из ограниченного режима: смену каталога, exec с командой и source с "/" в
+// имени файла.
+func (opts *options) restrictBuiltin(cmd *CMD) error {
+	if opts.restricted == nil {
+		return nil
+	}
+
+	switch {
+	case cmd.prog == "exec" && len(cmd.args) == 0:
+		return nil
+	case restrictedBuiltins[cmd.prog]:
+		return fmt.Errorf("%s: %w", cmd.prog, ErrRestricted)
+	case (cmd.prog == "source" || cmd.prog == ".") && len(cmd.args) > 0 && strings.Contains(cmd.args[0], "/"):
+		return fmt.Errorf("%s: %s: %w", cmd.prog, cmd.args[0], ErrRestricted)
+	}
+	return nil
+}
+
+// restrictCommand разрешает запуск только внешних команд из настроек и без
+// "/" в имени.
+func (opts *options) restrictCommand(prog string) error {
+	switch {
+	case opts.restricted == nil:
+		return nil
+	case strings.Contains(prog, "/"):
+		return fmt.Errorf("%s: %w: cannot specify `/' in command names", prog, ErrRestricted)
+	case !opts.restricted.allowed[prog]:
+		return fmt.Errorf("%s: %w: command not allowed", prog, ErrRestricted)
+	}
+	return nil
+}
+
+// restrictVar запрещает менять и удалять переменные restrictedVars.
+func (opts *options) restrictVar(name string) error {
+	if opts.restricted != nil && restrictedVars[name] {
+		return fmt.Errorf("%s: %w: cannot modify variable", name, ErrRestricted)
+	}
+	return nil
+}
+
+// restrictRedirect запрещает перенаправлять вывод в файл target.
+func (opts *options) restrictRedirect(target string) error {
+	if opts.restricted != nil {
+		return fmt.Errorf("%s: %w: cannot redirect output", target, ErrRestricted)
+	}
+	return nil
+}
+
+// limit готовит запуск программы с ограничениями. Программа с ограничением
+// времени запускается в своей группе процессов, как в timeout(1), чтобы
+// вместе с ней завершить и запущенные ею процессы; в задании с управлением
+// группу назначит задание. Для лимитов ресурсов вместо программы
+// запускается сам шелл, который ставит лимиты и выполняет exec программы.
+func (r *restriction) limit(c *exec.Cmd) error {
+	if r == nil {
+		return nil
+	}
+	if r.timeout > 0 {
+		c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	if len(r.limits) == 0 {
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	limits := make([]string, 0, len(r.limits))
+	for _, l := range r.limits {
+		limits = append(limits, fmt.Sprintf("%d=%d", l.resource, l.value))
+	}
+
+	// При повторах в окружении действует первое значение, поэтому
+	// переданные пользователем значения убираются.
+	env := make([]string, 0, len(c.Env)+2)
+	for _, kv := range c.Env {
+		name, _, _ := strings.Cut(kv, "=")
+		if name != rlimitPathEnv && name != rlimitsEnv {
+			env = append(env, kv)
+		}
+	}
+	c.Env = append(env, rlimitPathEnv+"="+c.Path, rlimitsEnv+"="+strings.Join(limits, ","))
+	c.Path = self
+	return nil
+}
+
+// execLimited выполняется в начале main шелла, запущенного limit: ставит
+// лимиты ресурсов и заменяет процесс программой. При обычном запуске шелла
+// ничего не делает.
+func execLimited() error {
+	path, ok := os.LookupEnv(rlimitPathEnv)
+	if !ok {
+		return nil
+	}
+	limits := os.Getenv(rlimitsEnv)
+	os.Unsetenv(rlimitPathEnv)
+	os.Unsetenv(rlimitsEnv)
+
+	for _, l := range strings.Split(limits, ",") {
+		resource, value, _ := strings.Cut(l, "=")
+		res, resErr := strconv.Atoi(resource)
+		n, valueErr := strconv.ParseUint(value, 10, 64)
+		if resErr != nil || valueErr != nil {
+			return fmt.Errorf("%s: %w", rlimitsEnv, ErrInvalidRestriction)
+		}
+		if err := setRlimit(res, n); err != nil {
+			return fmt.Errorf("%s: %w", rlimitsEnv, err)
+		}
+	}
+	return syscall.Exec(path, os.Args, os.Environ())
+}
+
+// watch ограничивает время выполнения запущенной программы: по истечении
+// timeout ее группа процессов получает SIGKILL. В задании с управлением
+// группа общая для всего конвейера, и завершается весь конвейер.
+func (r *restriction) watch(c *exec.Cmd) *program {
+	p := &program{Cmd: c}
+	if r == nil || r.timeout == 0 {
+		return p
+	}
+
+	pgid, err := syscall.Getpgid(c.Process.Pid)
+	p.timer = time.AfterFunc(r.timeout, func() {
+		atomic.StoreInt32(&p.timedOut, 1)
+		// Группу шелла завершать нельзя.
+		if err != nil || pgid == syscall.Getpgrp() {
+			c.Process.Kill()
+			return
+		}
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	})
+	return p
+}
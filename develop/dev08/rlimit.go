@@ -0,0 +1,14 @@
+//go:build unix && !freebsd && !dragonfly && !openbsd
+
+package main
+
+import "syscall"
+
+// rlimitMemory - ресурс, которым ограничивается память: адресное
+// пространство процесса.
+const rlimitMemory = syscall.RLIMIT_AS
+
+// setRlimit ставит процессу шелла мягкий и жесткий лимит ресурса.
+func setRlimit(resource int, value uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+}
@@ -0,0 +1,20 @@
+//go:build freebsd || dragonfly
+
+package main
+
+import (
+	"math"
+	"syscall"
+)
+
+const rlimitMemory = syscall.RLIMIT_AS
+
+// setRlimit ставит процессу шелла мягкий и жесткий лимит ресурса. Здесь
+// лимиты знаковые: значение больше MaxInt64 означает отсутствие лимита.
+func setRlimit(resource int, value uint64) error {
+	lim := int64(math.MaxInt64)
+	if value < math.MaxInt64 {
+		lim = int64(value)
+	}
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: lim, Max: lim})
+}
@@ -0,0 +1,12 @@
+package main
+
+import "syscall"
+
+// rlimitMemory - в OpenBSD нет RLIMIT_AS, память ограничивается размером
+// сегмента данных.
+const rlimitMemory = syscall.RLIMIT_DATA
+
+// setRlimit ставит процессу шелла мягкий и жесткий лимит ресурса.
+func setRlimit(resource int, value uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+}
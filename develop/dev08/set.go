@@ -0,0 +1,257 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidOptionName = errors.New("invalid option name")
+var ErrUnboundVariable = errors.New("unbound variable")
+var ErrShiftCount = errors.New("shift count out of range")
+
+// defaultPS4 - префикс команд в трассировке "set -x", если PS4 не задана.
+const defaultPS4 = "+ "
+
+// shellOptions - настройки шелла, которые меняет set.
+type shellOptions struct {
+	// errexit - "set -e": завершить шелл, если команда вернула ошибку.
+	errexit bool
+	// noglob - "set -f": не раскрывать имена файлов.
+	noglob bool
+	// nounset - "set -u": подстановка незаданного параметра - ошибка.
+	nounset bool
+	// pipefail - код конвейера - код последней завершившейся с ошибкой
+	// команды, а не последней команды.
+	pipefail bool
+	// xtrace - "set -x": выводить команды перед выполнением.
+	xtrace bool
+}
+
+// reportExpansion выводит ошибку раскрытия слов или перенаправлений.
+// Неустановленная переменная при "set -u" завершает неинтерактивный шелл, как
+// требует POSIX; код, как в bash, 127.
+func (opts *options) reportExpansion(w io.Writer, err error) Status {
+	status := reportError(w, Status{code: 1, err: err})
+	if !status.exit && opts.script != nil && errors.Is(err, ErrUnboundVariable) {
+		status = Status{exit: true, code: 127}
+	}
+	return status
+}
+
+// setFlags - настройки set по имени для "-o name" и их однобуквенные флаги;
+// у pipefail флага нет.
+var setFlags = []struct {
+	name string
+	flag byte
+}{
+	{"errexit", 'e'},
+	{"noglob", 'f'},
+	{"nounset", 'u'},
+	{"pipefail", 0},
+	{"xtrace", 'x'},
+}
+
+// option возвращает настройку set по имени или nil, если такой нет.
+func (o *shellOptions) option(name string) *bool {
+	switch name {
+	case "errexit":
+		return &o.errexit
+	case "noglob":
+		return &o.noglob
+	case "nounset":
+		return &o.nounset
+	case "pipefail":
+		return &o.pipefail
+	case "xtrace":
+		return &o.xtrace
+	}
+	return nil
+}
+
+// flagOption возвращает настройку по однобуквенному флагу или nil.
+func (o *shellOptions) flagOption(c byte) *bool {
+	for _, f := range setFlags {
+		if f.flag != 0 && f.flag == c {
+			return o.option(f.name)
+		}
+	}
+	return nil
+}
+
+// flags возвращает включенные однобуквенные флаги - значение $-.
+func (o *shellOptions) flags() string {
+	var b strings.Builder
+	for _, f := range setFlags {
+		if f.flag != 0 && *o.option(f.name) {
+			b.WriteByte(f.flag)
+		}
+	}
+	return b.String()
+}
+
+// set включает ("-e", "-o errexit") и выключает ("+e", "+o errexit")
+// настройки шелла. "set -o" выводит их состояние, "set +o" - командами set,
+// которые его восстановят. Аргументы после настроек или "--" становятся
+// позиционными параметрами, "set -" выключает трассировку.
+func set(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	if len(args) == 0 {
+		return printSetOptions(cmd, opts, true)
+	}
+
+	setArgs := false
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" || arg == "-" {
+			if arg == "-" {
+				opts.xtrace = false
+			}
+			args, setArgs = args[1:], true
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			break
+		}
+		args = args[1:]
+
+		on := arg[0] == '-'
+		for i := 1; i < len(arg); i++ {
+			c := arg[i]
+			if c != 'o' {
+				p := opts.flagOption(c)
+				if p == nil {
+					return Status{code: 2, err: fmt.Errorf("set: %c%c: %w", arg[0], c, ErrInvalidOption)}
+				}
+				*p = on
+				continue
+			}
+
+			// "-o" без имени выводит настройки.
+			if len(args) == 0 {
+				return printSetOptions(cmd, opts, on)
+			}
+			p := opts.option(args[0])
+			if p == nil {
+				return Status{code: 2, err: fmt.Errorf("set: %s: %w", args[0], ErrInvalidOptionName)}
+			}
+			*p = on
+			args = args[1:]
+		}
+	}
+
+	if len(args) > 0 || setArgs {
+		opts.args = append([]string{}, args...)
+	}
+	return Status{code: 0}
+}
+
+// shift сдвигает позиционные параметры на n (по умолчанию 1): $n+1
+// становится $1. Если параметров меньше n, они не меняются, а код возврата -
+// 1, как в bash.
+func shift(cmd *CMD, opts *options) Status {
+	if len(cmd.args) > 1 {
+		return Status{code: 1, err: fmt.Errorf("shift: %w", ErrTooManyArgs)}
+	}
+
+	n := 1
+	if len(cmd.args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(cmd.args[0]); err != nil {
+			return Status{code: 1, err: fmt.Errorf("shift: %s: %w", cmd.args[0], ErrNumericArgument)}
+		}
+		if n < 0 {
+			return Status{code: 1, err: fmt.Errorf("shift: %d: %w", n, ErrShiftCount)}
+		}
+	}
+
+	if n > len(opts.args) {
+		return Status{code: 1}
+	}
+	opts.args = append([]string{}, opts.args[n:]...)
+	return Status{code: 0}
+}
+
+// printSetOptions выводит настройки set: в виде таблицы или, если table
+// ложно, командами "set -o name" и "set +o name".
+func printSetOptions(cmd *CMD, opts *options, table bool) Status {
+	var b strings.Builder
+	for _, f := range setFlags {
+		on := *opts.option(f.name)
+		switch {
+		case table && on:
+			fmt.Fprintf(&b, "%-15s\ton\n", f.name)
+		case table:
+			fmt.Fprintf(&b, "%-15s\toff\n", f.name)
+		case on:
+			fmt.Fprintf(&b, "set -o %s\n", f.name)
+		default:
+			fmt.Fprintf(&b, "set +o %s\n", f.name)
+		}
+	}
+
+	if _, pErr := fmt.Fprint(cmd.stdout, b.String()); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
+	}
+	return Status{code: 0}
+}
+
+// errexitStatus применяет "set -e" к коду возврата списка команд: ошибка вне
+// условия завершает шелл.
+func (opts *options) errexitStatus(status Status) Status {
+	if opts.errexit && opts.conditions == 0 && status.code != 0 && status.flow == 0 {
+		status.exit = true
+	}
+	return status
+}
+
+// condition выполняет список, в котором "set -e" не действует: условие if,
+// while или until, конвейер перед "&&" и "||" или с "!".
+func (opts *options) condition(exec func() Status) Status {
+	opts.conditions++
+	defer func() { opts.conditions-- }()
+	return exec()
+}
+
+// trace выводит в stderr команду, которую шелл сейчас выполнит, с префиксом
+// $PS4 ("set -x"). Слова, которые шелл разобрал бы иначе, берутся в кавычки.
+func (opts *options) trace(s streams, words []string) {
+	// Подстановки в PS4 не трассируются.
+	opts.xtrace = false
+	prefix, ok := opts.getVar("PS4")
+	if !ok {
+		prefix = defaultPS4
+	} else if expanded, err := opts.expandString(prefix, s); err == nil {
+		prefix = expanded
+	}
+	opts.xtrace = true
+
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, traceWord(word))
+	}
+	fmt.Fprintln(s.stderr, prefix+strings.Join(quoted, " "))
+}
+
+// traceWord берет слово в одинарные кавычки, если в нем есть символы, кроме
+// букв, цифр и "_-+=/.,:@%^". В присваивании в кавычки берется значение.
+func traceWord(word string) string {
+	if name, value, ok := strings.Cut(word, "="); ok && isName(name) {
+		return name + "=" + traceWord(value)
+	}
+
+	if word == "" {
+		return "''"
+	}
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		if !isLetter(c) && !isDigit(c) && strings.IndexByte("_-+=/.,:@%^", c) < 0 {
+			return singleQuote(word)
+		}
+	}
+	return word
+}
@@ -0,0 +1,276 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var ErrKillUsage = errors.New("usage: kill [-s sigspec | -n signum | -sigspec] pid | jobspec ... or kill -l [sigspec]")
+var ErrInvalidSignal = errors.New("invalid signal specification")
+
+// signalNames - сигналы, которые понимают kill и kill -l.
+var signalNames = map[string]syscall.Signal{
+	"HUP":    syscall.SIGHUP,
+	"INT":    syscall.SIGINT,
+	"QUIT":   syscall.SIGQUIT,
+	"ILL":    syscall.SIGILL,
+	"TRAP":   syscall.SIGTRAP,
+	"ABRT":   syscall.SIGABRT,
+	"BUS":    syscall.SIGBUS,
+	"FPE":    syscall.SIGFPE,
+	"KILL":   syscall.SIGKILL,
+	"USR1":   syscall.SIGUSR1,
+	"SEGV":   syscall.SIGSEGV,
+	"USR2":   syscall.SIGUSR2,
+	"PIPE":   syscall.SIGPIPE,
+	"ALRM":   syscall.SIGALRM,
+	"TERM":   syscall.SIGTERM,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"STOP":   syscall.SIGSTOP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+	"VTALRM": syscall.SIGVTALRM,
+	"PROF":   syscall.SIGPROF,
+	"WINCH":  syscall.SIGWINCH,
+	"IO":     syscall.SIGIO,
+	"SYS":    syscall.SIGSYS,
+}
+
+// parseSignal разбирает сигнал, заданный номером или именем с префиксом
+// "SIG" или без него, в любом регистре.
+func parseSignal(spec string) (syscall.Signal, bool) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		return syscall.Signal(n), n >= 0 && signalName(syscall.Signal(n)) != ""
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	sig, ok := signalNames[name]
+	return sig, ok
+}
+
+// signalName возвращает имя сигнала без "SIG", "" для неизвестного сигнала
+// и "0" для сигнала 0, которым проверяют существование процесса.
+func signalName(sig syscall.Signal) string {
+	if sig == 0 {
+		return "0"
+	}
+	for name, s := range signalNames {
+		if s == sig {
+			return name
+		}
+	}
+	return ""
+}
+
+// describeSignal описывает сигнал так, как bash сообщает о завершенном им
+// задании: "Killed", "Terminated".
+func describeSignal(sig syscall.Signal) string {
+	desc := sig.String()
+	return strings.ToUpper(desc[:1]) + desc[1:]
+}
+
+// jobControl - управление заданиями интерактивного шелла на управляющем
+// терминале: каждое задание выполняется в своей группе процессов, задание
+// переднего плана получает терминал, а шелл забирает его обратно, когда
+// задание завершается или останавливается.
+type jobControl struct {
+	tty *os.File
+	fd  int
+	// restore восстанавливает настройки терминала, с которыми работает шелл:
+	// остановленная программа могла оставить терминал в своем режиме.
+	restore func()
+}
+
+// enableJobControl включает управление заданиями, если f - управляющий
+// терминал шелла и шелл на нем на переднем плане.
+func (opts *options) enableJobControl(f *os.File) {
+	fg, err := tcgetpgrp(f)
+	if err != nil || fg != syscall.Getpgrp() {
+		return
+	}
+
+	// Шелл становится лидером своей группы, чтобы не делить ее с заданиями.
+	if pid := os.Getpid(); syscall.Getpgrp() != pid {
+		if err := syscall.Setpgid(0, 0); err != nil {
+			return
+		}
+		if err := tcsetpgrp(f, pid); err != nil {
+			return
+		}
+	}
+
+	restore, err := saveTerminal(f)
+	if err != nil {
+		return
+	}
+
+	opts.jobControl = &jobControl{tty: f, fd: int(f.Fd()), restore: restore}
+}
+
+// give переводит группу процессов задания на передний план терминала.
+func (jc *jobControl) give(pgid int) error {
+	return tcsetpgrp(jc.tty, pgid)
+}
+
+// reclaim возвращает терминал шеллу вместе с его настройками.
+func (jc *jobControl) reclaim() {
+	tcsetpgrp(jc.tty, syscall.Getpgrp())
+	jc.restore()
+}
+
+// reportSignal сообщает о задании переднего плана, завершенном сигналом.
+// Прерывание с терминала и закрытый канал не сообщаются: после Ctrl+C
+// достаточно перевода строки.
+func reportSignal(w io.Writer, status Status) error {
+	var err error
+	switch status.signal {
+	case 0, syscall.SIGPIPE:
+	case syscall.SIGINT:
+		_, err = fmt.Fprintln(w)
+	default:
+		_, err = fmt.Fprintf(w, "terminated by signal %d\n", status.signal)
+	}
+	return err
+}
+
+// kill посылает сигнал (по умолчанию SIGTERM) процессам и заданиям, а с -l
+// выводит имена сигналов.
+func kill(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	sig := syscall.SIGTERM
+
+	if len(args) > 0 {
+		switch arg := args[0]; {
+		case arg == "-l" || arg == "-L":
+			return listSignals(cmd, args[1:])
+		case arg == "-s" || arg == "-n":
+			if len(args) < 2 {
+				return Status{code: 2, err: fmt.Errorf("kill: %s: %w", arg, ErrOptionRequiresArgument)}
+			}
+			var ok bool
+			if sig, ok = parseSignal(args[1]); !ok {
+				return Status{code: 1, err: fmt.Errorf("kill: %s: %w", args[1], ErrInvalidSignal)}
+			}
+			args = args[2:]
+		case arg == "--":
+			args = args[1:]
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			var ok bool
+			if sig, ok = parseSignal(arg[1:]); !ok {
+				return Status{code: 1, err: fmt.Errorf("kill: %s: %w", arg[1:], ErrInvalidSignal)}
+			}
+			args = args[1:]
+		}
+	}
+
+	if len(args) == 0 {
+		return Status{code: 2, err: fmt.Errorf("kill: %w", ErrKillUsage)}
+	}
+
+	status := Status{code: 0}
+	for _, arg := range args {
+		if err := opts.signalTarget(arg, sig); err != nil {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("kill: %w", err)})
+		}
+	}
+	return status
+}
+
+// signalTarget посылает сигнал процессу, группе процессов (-PGID) или
+// заданию (%N).
+func (opts *options) signalTarget(target string, sig syscall.Signal) error {
+	if strings.HasPrefix(target, "%") {
+		j, err := opts.jobs.find(target)
+		if err != nil {
+			return err
+		}
+		if err := j.signal(sig); err != nil {
+			return fmt.Errorf("%s: %w", target, err)
+		}
+
+		// Остановленное задание получит SIGTERM или SIGHUP, только когда
+		// продолжит работу.
+		if j.getState() == jobStopped && (sig == syscall.SIGTERM || sig == syscall.SIGHUP) {
+			j.signal(syscall.SIGCONT)
+		}
+		return nil
+	}
+
+	pid, err := strconv.Atoi(target)
+	if err != nil {
+		return fmt.Errorf("`%s': %w", target, ErrNotJobSpec)
+	}
+
+	// Интерактивный шелл не завершается от собственного kill.
+	if pid == opts.pid {
+		return nil
+	}
+
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("(%d) - %w", pid, err)
+	}
+	return nil
+}
+
+// listSignals выводит все сигналы или, для каждого аргумента, имя сигнала
+// по номеру (в том числе по коду возврата 128+N) и номер по имени.
+func listSignals(cmd *CMD, specs []string) Status {
+	if len(specs) == 0 {
+		sigs := make([]int, 0, len(signalNames))
+		for _, sig := range signalNames {
+			sigs = append(sigs, int(sig))
+		}
+		sort.Ints(sigs)
+
+		var b strings.Builder
+		for i, sig := range sigs {
+			fmt.Fprintf(&b, "%2d) SIG%s", sig, signalName(syscall.Signal(sig)))
+			if i%5 == 4 || i == len(sigs)-1 {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\t")
+			}
+		}
+
+		if _, pErr := io.WriteString(cmd.stdout, b.String()); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+		return Status{code: 0}
+	}
+
+	status := Status{code: 0}
+	for _, spec := range specs {
+		var line string
+		if n, err := strconv.Atoi(spec); err == nil {
+			if n > 128 {
+				n -= 128
+			}
+			line = signalName(syscall.Signal(n))
+		} else if sig, ok := parseSignal(spec); ok {
+			line = strconv.Itoa(int(sig))
+		}
+
+		if line == "" || line == "0" {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("kill: %s: %w", spec, ErrInvalidSignal)})
+			continue
+		}
+
+		if _, pErr := fmt.Fprintln(cmd.stdout, line); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+	}
+	return status
+}
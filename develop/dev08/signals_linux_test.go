@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestHelperShell - шелл, который TestJobControl запускает отдельным
+// процессом с псевдотерминалом в роли управляющего терминала.
+func TestHelperShell(t *testing.T) {
+	if os.Getenv("WBSH_HELPER_SHELL") != "1" {
+		t.Skip("started by TestJobControl")
+	}
+
+	status := shell(nil, os.Stdin, os.Stdout, os.Stderr, new(options))
+	os.Exit(status.code)
+}
+
+func TestJobControl(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperShell$")
+	cmd.Env = append(os.Environ(), "WBSH_HELPER_SHELL=1", "HOME="+t.TempDir())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	slave.Close()
+	defer cmd.Process.Kill()
+
+	term := newTerminal(t, master)
+	line := func(keys string) {
+		t.Helper()
+		term.expect("$ ")
+		term.send(keys)
+	}
+
+	// foreground ждет, пока задание займет терминал.
+	foreground := func() {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			if pgid, err := tcgetpgrp(master); err == nil && pgid != cmd.Process.Pid {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("job did not get the terminal")
+	}
+
+	// Ctrl+C прерывает задание, но не шелл.
+	line("sleep 10\r")
+	foreground()
+	term.send("\x03")
+	line("echo code $?\r")
+	term.expect("code 130\r\n")
+
+	line("sleep 10\r")
+	foreground()
+	term.send("\x1a")
+	term.expect("[1]+  Stopped                 sleep 10\r\n")
+
+	// Задание завершается не сразу после kill, поэтому его дожидается wait.
+	line("kill %1; wait %1; echo code $?\r")
+	term.expect("code 143\r\n")
+
+	line("sh -c 'kill -TERM $$'; echo code $?\r")
+	term.expect("terminated by signal 15\r\ncode 143\r\n")
+
+	// Программа переднего плана читает с терминала.
+	line("head -1\r")
+	foreground()
+	term.send("typed\r")
+	term.expect("typed\r\ntyped\r\n")
+
+	// nc с терминала не забирает строки, введенные после ее завершения.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	release := make(chan struct{})
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Write([]byte("hello\n"))
+			conn.Close()
+		}
+		if conn, err := ln.Accept(); err == nil {
+			<-release
+			conn.Write([]byte("background\n"))
+			conn.Close()
+		}
+	}()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	line("nc 127.0.0.1 " + port + "; echo code $?\r")
+	term.expect("hello\r\ncode 0\r\n")
+	line("echo after $((1 + 1))\r")
+	term.expect("after 2\r\n")
+
+	// Фоновая nc не мешает шеллу читать терминал: пробел, введенный, пока
+	// она читает stdin, достанется шеллу или nc, но шелл не получит EAGAIN.
+	line("nc 127.0.0.1 " + port + " | cat &\r")
+	term.expect("[1] ")
+	time.Sleep(200 * time.Millisecond)
+	term.send(" ")
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	term.expect("background\r\n")
+	// nc перестает читать терминал, получив EOF из соединения.
+	time.Sleep(100 * time.Millisecond)
+	term.send("wait; echo after $((2 + 1))\r")
+	term.expect("after 3\r\n")
+
+	line("exit 3\r")
+	// Строку могла забрать и nc, тогда шелл не завершится.
+	timer := time.AfterFunc(5*time.Second, func() { cmd.Process.Kill() })
+	defer timer.Stop()
+	if err := cmd.Wait(); err == nil || cmd.ProcessState.ExitCode() != 3 {
+		t.Errorf("shell exited with %v; want exit status 3", err)
+	}
+}
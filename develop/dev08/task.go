@@ -1,3 +1,5 @@
+//go:build unix
+
 package main
 
 /*
@@ -21,19 +23,28 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"os/user"
+	"path/filepath"
 	"strconv"
 	"strings"
-
-	"github.com/mattn/go-shellwords"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 func main() {
+	if err := execLimited(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(126)
+	}
+
 	opts := new(options)
 	reader := os.Stdin
 	writer := os.Stdout
 	errs := os.Stderr
-	if status := do(reader, writer, errs, opts); status.exit {
+	if status := shell(os.Args[1:], reader, writer, errs, opts); status.exit {
 		if status.err != nil {
 			fmt.Fprintln(errs, status.err)
 		}
@@ -51,7 +62,56 @@ type options struct {
 	workDir     string
 	pid         int
 	lastCmdCode int
-	cmdParser   *shellwords.Parser
+	vars        variables
+	// arg0 и args - $0 и позиционные параметры $1, $2, ...
+	arg0 string
+	args []string
+	jobs *jobTable
+	// job - задание, в котором выполняются команды, nil на переднем плане
+	// вне конвейера.
+	job *job
+	// lastBgPid - процесс последнего фонового задания, "$!".
+	lastBgPid int
+	// substitutions - число выполненных подстановок команд; по нему команда
+	// без имени узнает, что ее код возврата - код подстановки.
+	substitutions int
+	funcs         map[string]*funcDef
+	aliases       map[string]string
+	// hash - пути программ, уже найденных в PATH.
+	hash *hashTable
+	// locals - прежние значения переменных, объявленных local в текущей
+	// функции; nil вне функции.
+	locals variables
+	// loops - число циклов, в которых выполняется команда, calls - глубина
+	// вызовов функций.
+	loops int
+	calls int
+	// sources - глубина вложенности source.
+	sources int
+	// dirStack - стек каталогов pushd и popd без текущего каталога,
+	// вершина - первый элемент.
+	dirStack []string
+	// script - скрипт или строка "-c"; nil, если команды читаются из stdin
+	// с приглашением.
+	script io.Reader
+	shellOptions
+	// conditions - глубина условий if, while и until и списков "&&" и "||",
+	// в которых "set -e" не действует.
+	conditions int
+	// Раскрытие имен файлов, эти настройки меняет shopt.
+	nullglob bool
+	failglob bool
+	globstar bool
+	dotglob  bool
+	// norc - не выполнять ~/.wbshrc при запуске, interactive - выполнять
+	// его, даже если stdin не терминал (-i).
+	norc        bool
+	interactive bool
+	// restricted - настройки ограниченного режима (-r), nil без него.
+	restricted *restriction
+	// jobControl - nil, если управления заданиями нет: шелл не интерактивный
+	// или это подоболочка.
+	jobControl *jobControl
 }
 
 func (opts *options) complete() error {
@@ -76,33 +136,239 @@ func (opts *options) complete() error {
 	opts.workDir = workDir
 	opts.pid = os.Getpid()
 
-	opts.cmdParser = shellwords.NewParser()
-	opts.cmdParser.ParseEnv = true
+	if opts.vars == nil {
+		opts.vars = environVariables()
+	}
+	if opts.funcs == nil {
+		opts.funcs = make(map[string]*funcDef)
+	}
+	if opts.aliases == nil {
+		opts.aliases = make(map[string]string)
+	}
+	if opts.arg0 == "" {
+		opts.arg0 = os.Args[0]
+	}
+	if opts.hash == nil {
+		opts.hash = newHashTable()
+	}
+	if opts.restricted != nil && opts.restricted.path != "" {
+		opts.vars["PATH"] = &variable{value: opts.restricted.path, exported: true}
+	}
+	opts.jobs = newJobTable()
 
 	return nil
 }
 
-func (opts *options) prompt() string {
-	dir := strings.Replace(opts.workDir, opts.homeDir, "~", 1)
-	prompt := fmt.Sprintf("%s@%s:%s $ ", opts.username, opts.hostname, dir)
-	return prompt
+// subshell возвращает копию состояния шелла для подоболочки.
+func (opts *options) subshell() *options {
+	sub := *opts
+	sub.vars = opts.vars.clone()
+	sub.funcs = make(map[string]*funcDef, len(opts.funcs))
+	for name, fn := range opts.funcs {
+		sub.funcs[name] = fn
+	}
+	sub.aliases = make(map[string]string, len(opts.aliases))
+	for name, value := range opts.aliases {
+		sub.aliases[name] = value
+	}
+	sub.hash = opts.hash.clone()
+	// Подоболочка не возвращается из функции, поэтому прежние значения
+	// локальных переменных ей не нужны.
+	if opts.locals != nil {
+		sub.locals = variables{}
+	}
+	sub.jobControl = nil
+	return &sub
+}
+
+// path возвращает путь относительно текущего каталога шелла.
+func (opts *options) path(p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(opts.workDir, p)
 }
 
 var ErrInvalidSyntax = errors.New("syntax error")
+var ErrOptionRequiresArgument = errors.New("option requires an argument")
+var ErrInvalidOption = errors.New("invalid option")
+
+// shell разбирает аргументы шелла: "-c команды [имя [аргументы...]]"
+// выполняет строку, "файл [аргументы...]" - скрипт, а без аргументов команды
+// читаются из stdin с приглашением. Если stdin - терминал или задан -i, шелл
+// интерактивный и сначала выполняет ~/.wbshrc (с --norc - нет). Имя и
+// аргументы становятся $0 и позиционными параметрами. -r включает
+// ограниченный режим с настройками из /etc/wbsh/restricted, а
+// "--restrictions файл" - из файла.
+func shell(args []string, in io.Reader, out io.Writer, errs io.Writer, opts *options) Status {
+	command, hasCommand := "", false
+	restricted, restrictions := false, ""
+
+options:
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		arg := args[0]
+		args = args[1:]
+
+		switch arg {
+		case "--":
+			break options
+		case "--norc":
+			opts.norc = true
+		case "-i":
+			opts.interactive = true
+		case "-r":
+			restricted = true
+		case "--restrictions":
+			if len(args) == 0 {
+				return Status{exit: true, code: 2, err: fmt.Errorf("--restrictions: %w", ErrOptionRequiresArgument)}
+			}
+			restricted, restrictions = true, args[0]
+			args = args[1:]
+		case "-c":
+			if len(args) == 0 {
+				return Status{exit: true, code: 2, err: fmt.Errorf("-c: %w", ErrOptionRequiresArgument)}
+			}
+			command, hasCommand = args[0], true
+			args = args[1:]
+		default:
+			return Status{exit: true, code: 2, err: fmt.Errorf("%s: %w", arg, ErrInvalidOption)}
+		}
+	}
+
+	// Настройки читаются до скрипта и ~/.wbshrc: ограничения действуют и
+	// в них.
+	if restricted {
+		r, err := loadRestriction(defaultRestrictionFile, true)
+		if restrictions != "" {
+			r, err = loadRestriction(restrictions, false)
+		}
+		if err != nil {
+			return Status{exit: true, code: 2, err: err}
+		}
+		opts.restricted = r
+	}
+
+	switch {
+	case hasCommand:
+		opts.script = strings.NewReader(command)
+		if len(args) > 0 {
+			opts.arg0, args = args[0], args[1:]
+		}
+	case len(args) > 0:
+		f, err := os.Open(args[0])
+		if err != nil {
+			return Status{exit: true, code: 127, err: err}
+		}
+		defer f.Close()
+
+		opts.script = f
+		opts.arg0, args = args[0], args[1:]
+	}
+
+	opts.args = args
+	return do(in, out, errs, opts)
+}
 
 func do(in io.Reader, out io.Writer, errs io.Writer, opts *options) Status {
 	if err := opts.complete(); err != nil {
 		return Status{exit: true, code: 1, err: err}
 	}
 
+	// Фоновые задания пишут в те же потоки, что и шелл.
+	if errs == out {
+		out = syncWriter(out)
+		errs = out
+	} else {
+		out = syncWriter(out)
+		errs = syncWriter(errs)
+	}
+
+	if opts.script != nil {
+		return opts.runScript(streams{stdin: in, stdout: out, stderr: errs})
+	}
+
+	// Как bash, ~/.wbshrc выполняет только интерактивный шелл.
+	f, ok := in.(*os.File)
+	terminal := ok && isTerminal(f)
+	if !opts.norc && (terminal || opts.interactive) {
+		if status := opts.runRC(streams{stdin: in, stdout: out, stderr: errs}); status.exit {
+			return status
+		}
+	}
+
 	reader := bufio.NewReader(in)
 
+	// С терминала строки читаются редактором, иначе - как есть.
+	var editor *lineEditor
+	if terminal {
+		h, err := loadHistory(opts.historyFile(), historyLimit)
+		if err != nil {
+			fmt.Fprintln(errs, err)
+		}
+		editor = newLineEditor(f, out, opts, h)
+		opts.enableJobControl(f)
+
+		// Интерактивный шелл не завершается от Ctrl+C и Ctrl+\. Сигналы
+		// перехватываются, а не игнорируются: игнорирование унаследовали
+		// бы запущенные программы.
+		intr := make(chan os.Signal, 1)
+		signal.Notify(intr, syscall.SIGINT, syscall.SIGQUIT)
+		defer func() {
+			signal.Stop(intr)
+			close(intr)
+		}()
+		go func() {
+			for range intr {
+			}
+		}()
+	}
+
+	// Ctrl+Z останавливает задание переднего плана, но не сам шелл.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTSTP)
+	defer func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}()
+	go opts.jobs.suspend(sigs)
+
+	// src - строки незаконченной команды: пока команда не разберется
+	// целиком, следующие строки читаются с приглашением $PS2.
+	src := ""
 	for {
-		if _, pErr := fmt.Fprint(out, opts.prompt()); pErr != nil {
-			return Status{exit: true, code: 1, err: pErr}
+		if err := opts.jobs.notify(errs); err != nil {
+			return Status{exit: true, code: 1, err: err}
 		}
 
-		input, err := reader.ReadString('\n')
+		prompt := opts.prompt()
+		if src != "" {
+			prompt = opts.continuationPrompt()
+		}
+
+		var input string
+		var err error
+		if editor != nil {
+			input, err = editor.readLine(prompt)
+			if err == nil {
+				input += "\n"
+			}
+		} else {
+			if _, pErr := fmt.Fprint(out, prompt); pErr != nil {
+				return Status{exit: true, code: 1, err: pErr}
+			}
+			input, err = reader.ReadString('\n')
+		}
+
+		if errors.Is(err, errInterrupted) {
+			src = ""
+			opts.lastCmdCode = 130
+			continue
+		}
+		if err == io.EOF && src != "" {
+			// Команда не закончена, а продолжения уже не будет.
+			fmt.Fprintln(out, "")
+			return Status{exit: true, code: 2, err: ErrUnexpectedEOF}
+		}
 		if err != nil {
 			if err == io.EOF {
 				fmt.Fprintln(out, "")
@@ -111,358 +377,417 @@ func do(in io.Reader, out io.Writer, errs io.Writer, opts *options) Status {
 			return Status{exit: true, code: 1, err: err}
 		}
 
-		input = strings.TrimSpace(input)
-		if input == "" {
+		if editor != nil {
+			if hErr := editor.history.add(strings.TrimSuffix(input, "\n")); hErr != nil {
+				fmt.Fprintln(errs, hErr)
+			}
+		}
+
+		src += input
+		if strings.TrimSpace(src) == "" {
+			src = ""
+			continue
+		}
+
+		list, err := opts.parse(src)
+		if isIncomplete(err, src) {
 			continue
 		}
+		src = ""
 
-		cmds, err := parsePipeline(input, opts)
 		if err != nil {
 			if _, pErr := fmt.Fprintln(errs, err); pErr != nil {
 				return Status{exit: true, code: 1, err: pErr}
 			}
+			opts.lastCmdCode = 2
 			continue
 		}
 
-		pipeline := &Pipeline{
-			cmds:   cmds,
-			stdin:  in,
-			stdout: out,
-			stderr: errs,
-		}
-
-		if status := pipeline.exec(opts); status.exit {
+		if status := list.exec(opts, streams{stdin: in, stdout: out, stderr: errs}); status.exit {
 			return status
 		}
 	}
 }
 
-type Status struct {
-	exit bool
-	code int
-	err  error
+// isIncomplete сообщает, что команда в src не закончена и нужно прочитать
+// следующую строку: открыты кавычки или скобки, строка кончается на "|",
+// "&&", "||" или "\", или не дочитан here-документ.
+func isIncomplete(err error, src string) bool {
+	return errors.Is(err, ErrUnexpectedEOF) || strings.HasSuffix(src, "\\\n")
 }
 
-func parsePipeline(input string, opts *options) ([]*CMD, error) {
-	if strings.HasPrefix(input, "|") || strings.HasSuffix(input, "|") {
-		return nil, ErrInvalidSyntax
-	}
-
-	const (
-		unquoted = iota
-		singleQuoted
-		doubleQuoted
-		escaped
-	)
-	parts := []string{}
-	b := strings.Builder{}
-	state := unquoted
-
-	for _, r := range input {
-		switch state {
-		case unquoted:
-			if r == '|' {
-				parts = append(parts, strings.TrimSpace(b.String()))
-				b.Reset()
-			} else if r == '\'' {
-				state = singleQuoted
-				b.WriteRune(r)
-			} else if r == '"' {
-				state = doubleQuoted
-				b.WriteRune(r)
-			} else {
-				b.WriteRune(r)
-			}
-		case singleQuoted:
-			if r == '\'' {
-				state = unquoted
-			}
-			b.WriteRune(r)
-		case doubleQuoted:
-			if r == '"' {
-				state = unquoted
-			} else if r == '\\' {
-				state = escaped
-			}
-			b.WriteRune(r)
-		case escaped:
-			state = doubleQuoted
-			b.WriteRune(r)
-		}
-	}
+// runScript выполняет скрипт без приглашения. Синтаксическая ошибка
+// завершает скрипт.
+func (opts *options) runScript(s streams) Status {
+	status := opts.runSource(opts.script, opts.arg0, s)
+	status.exit = true
+	return status
+}
 
-	parts = append(parts, strings.TrimSpace(b.String()))
+// runSource выполняет команды из r. Команда может занимать несколько строк:
+// строки добавляются, пока команда не разберется целиком. Синтаксическая
+// ошибка прекращает выполнение с кодом 2, name - имя источника в сообщении.
+func (opts *options) runSource(r io.Reader, name string, s streams) Status {
+	reader := bufio.NewReader(r)
+	src, line, start := "", 0, 1
 
-	if state != unquoted {
-		return nil, ErrInvalidSyntax
-	}
+	for {
+		input, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return Status{code: 1, err: err}
+		}
+		line++
+		src += input
 
-	cmds := make([]*CMD, 0, len(parts))
-	for _, part := range parts {
-		if part == "" {
-			return nil, ErrInvalidSyntax
+		list, pErr := opts.parse(src)
+		if isIncomplete(pErr, src) && err == nil {
+			continue
 		}
 
-		cmdParts, err := opts.cmdParser.Parse(part)
-		if err != nil {
-			return nil, err
+		if pErr != nil {
+			return Status{code: 2, err: fmt.Errorf("%s: line %d: %w", name, start, pErr)}
 		}
+		src, start = "", line+1
 
-		cmd := &CMD{
-			prog:     cmdParts[0],
-			args:     cmdParts[1:],
-			pipeline: true,
-			rawInput: part,
+		if status := list.exec(opts, s); status.exit {
+			return status
 		}
 
-		cmds = append(cmds, cmd)
+		if err == io.EOF {
+			return Status{code: opts.lastCmdCode}
+		}
 	}
-
-	return cmds, nil
 }
 
-type Pipeline struct {
-	cmds   []*CMD
-	stdin  io.Reader
-	stdout io.Writer
-	stderr io.Writer
+// rcFile возвращает путь к файлу, который интерактивный шелл выполняет при
+// запуске: ~/.wbshrc.
+func (opts *options) rcFile() string {
+	home, ok := opts.getVar("HOME")
+	if !ok || home == "" {
+		home = opts.homeDir
+	}
+	return filepath.Join(home, ".wbshrc")
 }
 
-func (pl *Pipeline) exec(opts *options) Status {
-	if len(pl.cmds) == 1 {
-		cmd := pl.cmds[0]
-		cmd.pipeline = false
-		cmd.stdin = pl.stdin
-		cmd.stdout = pl.stdout
-		cmd.stderr = pl.stderr
-		return cmd.exec(opts)
+// runRC выполняет ~/.wbshrc, если он есть. Ошибки в нем выводятся, но шелл
+// продолжает работу, если файл не вызвал exit.
+func (opts *options) runRC(s streams) Status {
+	path := opts.rcFile()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Status{code: 0}
 	}
+	if err != nil {
+		return reportError(s.stderr, Status{code: 1, err: err})
+	}
+	defer f.Close()
 
-	var status Status
-	var reader *os.File
-	var writer *os.File
+	return reportError(s.stderr, opts.runSource(f, path, s))
+}
 
-	for i, cmd := range pl.cmds {
-		cmd.stderr = pl.stderr
+type Status struct {
+	exit bool
+	code int
+	err  error
+	// flow - break, continue или return вместо выхода из шелла, levels -
+	// число прерываемых циклов.
+	flow   int
+	levels int
+	// signal - сигнал, которым завершен процесс; code тогда 128 + номер
+	// сигнала.
+	signal syscall.Signal
+}
 
-		r, w, err := os.Pipe()
-		if err != nil {
-			return Status{exit: true, code: 1, err: err}
-		}
+// lockedWriter позволяет нескольким командам конвейера писать в один поток.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
 
-		if i == 0 {
-			cmd.stdin = pl.stdin
-			cmd.stdout = w
-			reader = r
-			writer = w
-		} else if i == len(pl.cmds)-1 {
-			cmd.stdin = reader
-			cmd.stdout = pl.stdout
-			writer = w
-		} else {
-			cmd.stdin = reader
-			cmd.stdout = w
-			reader = r
-			writer = w
-		}
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
 
-		status = cmd.exec(opts)
-		writer.Close()
+// syncWriter оборачивает w мьютексом, если это не файл: в файл можно писать
+// конкурентно, а внешняя программа получит его дескриптор напрямую.
+func syncWriter(w io.Writer) io.Writer {
+	if _, ok := w.(*os.File); ok {
+		return w
 	}
-
-	return status
+	if _, ok := w.(*lockedWriter); ok {
+		return w
+	}
+	return &lockedWriter{w: w}
 }
 
 type CMD struct {
 	prog     string
 	args     []string
 	pipeline bool
-	rawInput string
-	stdin    io.Reader
-	stdout   io.Writer
-	stderr   io.Writer
+	// assigns - присваивания NAME=value перед именем команды.
+	assigns []string
+	// code - код возврата команды без имени: последней подстановки команды
+	// в ней или 0.
+	code      int
+	redirects []*redirect
+	streams
+	// owned - концы каналов конвейера, которые нужно закрыть, когда они
+	// больше не нужны шеллу.
+	owned []io.Closer
 }
 
-var ErrUnsupportedCommand = errors.New("unsupported command")
+func (cmd *CMD) closeOwned() {
+	closeAll(cmd.owned)
+	cmd.owned = nil
+}
 
-func (cmd *CMD) exec(opts *options) Status {
-	var status Status
-
-	switch cmd.prog {
-	case "exit":
-		status = exit(cmd, opts)
-	case "cd":
-		status = cd(cmd, opts)
-	case "pwd":
-		status = pwd(cmd, opts)
-	case "echo":
-		status = echo(cmd, opts)
-	case "kill":
-		status = kill(cmd, opts)
-	case "ps":
-		status = run(cmd)
-	case "fork":
-		status = fork(cmd, opts)
-	case "exec":
-		status = execute(cmd, opts)
-	default:
-		// status = Status{code: 1, err: ErrUnsupportedCommand}
-		status = run(cmd)
-	}
-
-	if status.exit {
-		return status
-	}
+var ErrUnsupportedCommand = errors.New("unsupported command")
 
-	if status.err != nil {
-		if _, pErr := fmt.Fprintln(cmd.stderr, status.err); pErr != nil {
-			return Status{exit: true, code: 1, err: pErr}
-		}
+// start запускает команду и возвращает функцию, ожидающую ее завершения.
+// Встроенные команды вне конвейера выполняются сразу, так как меняют
+// состояние шелла, а в конвейере - в отдельной горутине.
+func (cmd *CMD) start(opts *options) func() Status {
+	// Встроенная команда начинает фоновое задание без процесса, еще до
+	// перенаправлений: открытие FIFO может ждать другую сторону.
+	_, isFunc := opts.funcs[cmd.prog]
+	if opts.job != nil && (isFunc || isBuiltin(cmd.prog)) {
+		opts.job.begin()
 	}
 
-	opts.lastCmdCode = status.code
-	return status
-}
-
-func run(cmd *CMD) Status {
-	c := exec.Command(cmd.prog, cmd.args...)
-	c.Stdin = cmd.stdin
-	c.Stdout = cmd.stdout
-	c.Stderr = cmd.stderr
-	err := c.Run()
+	// Ошибки перенаправления выводятся в исходный stderr команды.
+	stderr := cmd.stderr
+	closers, err := cmd.applyRedirects(cmd.redirects, opts)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return Status{code: exitErr.ExitCode()}
+		cmd.closeOwned()
+		status := opts.reportExpansion(stderr, err)
+		return func() Status { return status }
+	}
+
+	// Функции выполняются как встроенные команды и имеют приоритет над
+	// ними.
+	run := cmd.builtin
+	if _, ok := opts.funcs[cmd.prog]; !ok && !isBuiltin(cmd.prog) {
+		p, err := startProcess(cmd, opts)
+		if errors.Is(err, ErrCommandNotFound) && opts.funcs[notFoundHandler] != nil {
+			run = cmd.notFound
+		} else {
+			// Ошибка выводится до закрытия файлов: stderr может быть
+			// перенаправлен в один из них.
+			var status Status
+			if err != nil {
+				status = cmd.report(startFailure(err))
+			}
+			// Дочерний процесс получил свои копии дескрипторов.
+			closeAll(closers)
+			cmd.closeOwned()
+			if err != nil {
+				return func() Status { return status }
+			}
+
+			return func() Status {
+				return cmd.report(waitProcess(p))
+			}
 		}
+	}
 
-		return Status{code: 1, err: err}
+	if !cmd.pipeline {
+		status := cmd.report(run(opts))
+		closeAll(closers)
+		cmd.closeOwned()
+		return func() Status { return status }
 	}
 
-	return Status{code: 0}
-}
+	done := make(chan Status, 1)
+	go func() {
+		status := cmd.report(run(opts))
+		closeAll(closers)
+		cmd.closeOwned()
+		done <- status
+	}()
 
-var ErrExitTooManyArgs = errors.New("exit: too many arguments")
+	return func() Status { return <-done }
+}
 
-func exit(cmd *CMD, opts *options) Status {
-	if len(cmd.args) > 1 {
-		return Status{code: 1, err: ErrExitTooManyArgs}
-	}
+// report выводит ошибку команды в ее stderr.
+func (cmd *CMD) report(status Status) Status {
+	return reportError(cmd.stderr, status)
+}
 
-	if len(cmd.args) == 0 {
-		status := Status{exit: true, code: opts.lastCmdCode}
-		if cmd.pipeline {
-			status.exit = false
-		}
+func reportError(w io.Writer, status Status) Status {
+	if status.exit || status.err == nil {
 		return status
 	}
 
-	code, err := strconv.ParseUint(cmd.args[0], 10, 8)
-	if err != nil {
-		return Status{code: 1, err: err}
+	if _, pErr := fmt.Fprintln(w, status.err); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
 	}
 
-	status := Status{exit: true, code: int(code)}
-	if cmd.pipeline {
-		status.exit = false
-	}
+	status.err = nil
 	return status
 }
 
-func cd(cmd *CMD, opts *options) Status {
-	var dir string
-	if len(cmd.args) == 0 {
-		dir = opts.homeDir
-	} else {
-		dir = strings.Join(cmd.args, " ")
+func (cmd *CMD) builtin(opts *options) Status {
+	// Присваивания перед встроенной командой действуют только на время ее
+	// выполнения.
+	if len(cmd.assigns) > 0 {
+		defer opts.assignTemp(cmd.assigns)()
 	}
 
-	if strings.HasPrefix(dir, "~") {
-		dir = strings.Replace(dir, "~", opts.homeDir, 1)
+	if fn, ok := opts.funcs[cmd.prog]; ok {
+		return cmd.call(fn, opts)
 	}
 
-	if err := os.Chdir(dir); err != nil {
-		return Status{code: 1, err: err}
+	if b, ok := builtins[cmd.prog]; ok {
+		if err := opts.restrictBuiltin(cmd); err != nil {
+			return Status{code: 1, err: err}
+		}
+		return b.run(cmd, opts)
 	}
 
-	workDir, err := os.Getwd()
-	if err != nil {
-		return Status{code: 1, err: err}
-	}
+	// Команда из одних присваиваний и перенаправлений.
+	return Status{code: cmd.code}
+}
 
-	opts.workDir = workDir
-	return Status{code: 0}
+// program - запущенная внешняя программа.
+type program struct {
+	*exec.Cmd
+	// timer завершает программу, когда истекает время, отведенное ей в
+	// ограниченном режиме, и отмечает это в timedOut; nil - время не
+	// ограничено.
+	timer    *time.Timer
+	timedOut int32
 }
 
-func pwd(cmd *CMD, opts *options) Status {
-	workDir, err := os.Getwd()
+// notFound вызывает command_not_found_handle вместо программы, не найденной
+// в PATH: имя и аргументы программы становятся аргументами функции. Как и в
+// bash, функция выполняется в подоболочке.
+func (cmd *CMD) notFound(opts *options) Status {
+	c := *cmd
+	c.prog, c.args = notFoundHandler, append([]string{cmd.prog}, cmd.args...)
+	status := c.call(opts.funcs[notFoundHandler], opts.subshell())
+	status.exit = false
+	return status
+}
+
+func startProcess(cmd *CMD, opts *options) (*program, error) {
+	c, err := opts.command(cmd.prog, cmd.args, cmd.assigns)
 	if err != nil {
-		return Status{code: 1, err: err}
+		return nil, err
 	}
+	c.Stdin = cmd.stdin
+	c.Stdout = cmd.stdout
+	c.Stderr = cmd.stderr
 
-	if _, pErr := fmt.Fprintln(cmd.stdout, workDir); pErr != nil {
-		return Status{exit: true, code: 1, err: pErr}
+	if opts.job != nil {
+		err = opts.job.startProcess(c)
+	} else {
+		err = c.Start()
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return Status{code: 0}
+	return opts.restricted.watch(c), nil
 }
 
-func echo(cmd *CMD, opts *options) Status {
-	mapping := func(key string) string {
-		if key == "?" {
-			return fmt.Sprint(opts.lastCmdCode)
-		}
-		return os.Getenv(key)
+// startFailure - код возврата команды, которую не удалось запустить, как в
+// bash: 127 - программа не найдена, 126 - ее нельзя выполнить.
+func startFailure(err error) Status {
+	if errors.Is(err, ErrCommandNotFound) || errors.Is(err, os.ErrNotExist) {
+		return Status{code: 127, err: err}
 	}
+	return Status{code: 126, err: err}
+}
 
-	parts, _ := shellwords.Parse(cmd.rawInput)
-	args := parts[1:]
-	for i, arg := range args {
-		args[i] = os.Expand(arg, mapping)
+func waitProcess(p *program) Status {
+	err := p.Wait()
+	if p.timer != nil {
+		p.timer.Stop()
+		if atomic.LoadInt32(&p.timedOut) != 0 {
+			return Status{code: 124, err: fmt.Errorf("%s: %w", p.Args[0], ErrCommandTimedOut)}
+		}
 	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+				return Status{code: 128 + int(ws.Signal()), signal: ws.Signal()}
+			}
+			return Status{code: exitErr.ExitCode()}
+		}
 
-	if _, pErr := fmt.Fprintln(cmd.stdout, strings.Join(args, " ")); pErr != nil {
-		return Status{exit: true, code: 1, err: pErr}
+		return Status{code: 1, err: err}
 	}
 
 	return Status{code: 0}
 }
 
-var ErrKillPidRequired = errors.New("usage: kill pid")
+func run(cmd *CMD, opts *options) Status {
+	p, err := startProcess(cmd, opts)
+	if err != nil {
+		return startFailure(err)
+	}
+
+	return waitProcess(p)
+}
+
+var ErrExitTooManyArgs = errors.New("exit: too many arguments")
+
+func exit(cmd *CMD, opts *options) Status {
+	if len(cmd.args) > 1 {
+		return Status{code: 1, err: ErrExitTooManyArgs}
+	}
 
-func kill(cmd *CMD, opts *options) Status {
 	if len(cmd.args) == 0 {
-		return Status{code: 1, err: ErrKillPidRequired}
+		status := Status{exit: true, code: opts.lastCmdCode}
+		if cmd.pipeline {
+			status.exit = false
+		}
+		return status
 	}
 
-	pid, err := strconv.ParseInt(cmd.args[0], 10, 32)
+	code, err := strconv.ParseUint(cmd.args[0], 10, 8)
 	if err != nil {
 		return Status{code: 1, err: err}
 	}
 
-	self := int64(opts.pid)
-	if pid == self {
-		return Status{code: 0}
+	status := Status{exit: true, code: int(code)}
+	if cmd.pipeline {
+		status.exit = false
 	}
+	return status
+}
 
-	process, _ := os.FindProcess(int(pid))
-	if err := process.Kill(); err != nil {
-		return Status{code: 1, err: err}
+func echo(cmd *CMD, opts *options) Status {
+	if _, pErr := fmt.Fprintln(cmd.stdout, strings.Join(cmd.args, " ")); pErr != nil {
+		return Status{exit: true, code: 1, err: pErr}
 	}
 
 	return Status{code: 0}
 }
 
+// fork запускает программу фоновым заданием без ввода-вывода.
 func fork(cmd *CMD, opts *options) Status {
 	if len(cmd.args) == 0 {
 		return Status{code: 0}
 	}
 
-	cmd.prog = cmd.args[0]
-	cmd.args = cmd.args[1:]
-	c := exec.Command(cmd.prog, cmd.args...)
-	if err := c.Start(); err != nil {
+	j := newJob(strings.Join(cmd.args, " "), true)
+	c, err := opts.command(cmd.args[0], cmd.args[1:], cmd.assigns)
+	if err != nil {
+		return startFailure(err)
+	}
+	if err := j.startProcess(c); err != nil {
 		return Status{code: 1, err: err}
 	}
+	p := opts.restricted.watch(c)
+
+	opts.jobs.add(j)
+	opts.lastBgPid = j.pid()
+	go func() {
+		j.finish(waitProcess(p))
+	}()
 
 	return Status{code: 0}
 }
@@ -474,7 +799,7 @@ func execute(cmd *CMD, opts *options) Status {
 
 	cmd.prog = cmd.args[0]
 	cmd.args = cmd.args[1:]
-	status := run(cmd)
+	status := run(cmd, opts)
 	if status.err != nil {
 		return status
 	}
@@ -1,14 +1,35 @@
+//go:build unix
+
 package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
+// TestMain выполняет программу с лимитами ресурсов, если шелл запустил
+// тестовый бинарный файл вместо нее (см. restriction.limit).
+func TestMain(m *testing.M) {
+	if err := execLimited(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(126)
+	}
+	os.Exit(m.Run())
+}
+
 func TestShell(t *testing.T) {
 	t.Run(("test shell"), func(t *testing.T) {
 		opts := new(options)
@@ -61,3 +82,1941 @@ func TestShell(t *testing.T) {
 		}
 	})
 }
+
+func TestRedirects(t *testing.T) {
+	t.Run(("test redirects"), func(t *testing.T) {
+		opts := new(options)
+		inbuf := &bytes.Buffer{}
+		outbuf := &bytes.Buffer{}
+
+		cwd, _ := os.Getwd()
+		dir := t.TempDir()
+
+		inbuf.WriteString(fmt.Sprintf("cd %s\n", dir))
+		inbuf.WriteString("echo hello > out.txt\n")
+		inbuf.WriteString("echo \"a > b\" 1>>out.txt\n")
+		inbuf.WriteString("cat < out.txt\n")
+		inbuf.WriteString("cat nosuch 2> err.txt\n")
+		inbuf.WriteString("cat nosuch > all.txt 2>&1\n")
+		inbuf.WriteString("pwd &>> all.txt\n")
+		inbuf.WriteString("cat <<< 'here string' | cat\n")
+		inbuf.WriteString(fmt.Sprintf("cd %s\n", cwd))
+		inbuf.WriteString("exit\n")
+
+		status := do(inbuf, outbuf, outbuf, opts)
+		if status.code != 0 {
+			t.Fatal(status)
+		}
+
+		prefix := strings.TrimSuffix(opts.prompt(), " $ ")
+		cleaned := strings.ReplaceAll(outbuf.String(), prefix, "")
+		cleaned = strings.ReplaceAll(cleaned, dir, "")
+		if !strings.Contains(cleaned, "hello\na > b\n") || !strings.Contains(cleaned, "here string\n") {
+			t.Fatalf("unexpected output: %q", cleaned)
+		}
+
+		data, _ := os.ReadFile(dir + "/err.txt")
+		if !strings.Contains(string(data), "nosuch") {
+			t.Fatalf("err.txt == %q", data)
+		}
+
+		data, _ = os.ReadFile(dir + "/all.txt")
+		if !strings.Contains(string(data), "nosuch") || !strings.HasSuffix(string(data), dir+"\n") {
+			t.Fatalf("all.txt == %q", data)
+		}
+	})
+}
+
+func TestParseRedirects(t *testing.T) {
+	cases := []struct {
+		in        string
+		rest      string
+		redirects []redirect
+	}{
+		{"echo a >f", "echo a", []redirect{{1, ">", "f", ""}}},
+		{"echo '>' \">\" \\> a2>f", "echo '>' \">\" \\> a2", []redirect{{1, ">", "f", ""}}},
+		{"cmd 2>>log <in 2>&1", "cmd", []redirect{{2, ">>", "log", ""}, {0, "<", "in", ""}, {2, ">&", "1", ""}}},
+		{"cat <<< \"a b\" &>out", "cat", []redirect{{0, "<<<", "\"a b\"", ""}, {1, "&>", "out", ""}}},
+		{"cat <<EOF a\n$x \"q\"\n EOF\nEOF\n", "cat a", []redirect{{0, "<<", "EOF", "$x \"q\"\n EOF\n"}}},
+		{"cat <<-'E'\"\"2 2<<x >o\n\ta\n\tE2\nb\nx", "cat", []redirect{{0, "<<-", "'E'\"\"2", "a\n"}, {2, "<<", "x", "b\n"}, {1, ">", "o", ""}}},
+	}
+
+	for _, c := range cases {
+		list, err := parse(c.in)
+		if err != nil {
+			t.Errorf("parse(%q) error: %v", c.in, err)
+			continue
+		}
+
+		cmd := list.items[0].pipelines[0].cmds[0].(*simpleCommand)
+		got := []redirect{}
+		for _, r := range cmd.redirects {
+			got = append(got, *r)
+		}
+
+		if rest := strings.Join(cmd.words, " "); rest != c.rest || !reflect.DeepEqual(got, c.redirects) {
+			t.Errorf("parse(%q) == %q, %v; want %q, %v", c.in, rest, got, c.rest, c.redirects)
+		}
+	}
+
+	errCases := []struct {
+		in  string
+		err string
+	}{
+		{"echo >", "syntax error near unexpected token `newline'"},
+		{"echo > >f", "syntax error near unexpected token `>'"},
+		{"echo 1&>>", "syntax error near unexpected token `newline'"},
+		{"echo 5>f", "5: bad file descriptor"},
+		{"cat <<EOF\nx\n", ErrUnexpectedEOF.Error()},
+		{"cat <<\n", "syntax error near unexpected token `newline'"},
+	}
+
+	// Текст команды, который показывает jobs.
+	list, err := parse(`! a 2>&1 'b c' | (d; e &) >>f && { g & } || { h; } <i`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `! a 'b c' 2>&1 | (d; e &) >>f && { g & } || { h; } <i`
+	if got := list.String(); got != want {
+		t.Errorf("String() == %s; want %s", got, want)
+	}
+
+	list, err = parse("if a\nthen b &\nelse c; fi\nwhile d; do e; done <f; for x in 1 2; do y; done\ncase $v in a|b) c;; *) esac\nf() { g; }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `if a; then b & else c; fi; while d; do e; done <f; for x in 1 2; do y; done; case $v in a | b) c;; *);; esac; f() { g; }`
+	if got := list.String(); got != want {
+		t.Errorf("String() == %s; want %s", got, want)
+	}
+
+	for _, c := range errCases {
+		_, err := parse(c.in)
+		if err == nil || err.Error() != c.err {
+			t.Errorf("parse(%q) error == %v; want %s", c.in, err, c.err)
+		}
+	}
+
+	output, _ := runShell(t, "echo 2>&x\n")
+	if output != "x: bad file descriptor\n" {
+		t.Errorf("echo 2>&x: output == %q", output)
+	}
+}
+
+// runShell выполняет строки input в шелле и возвращает его вывод без
+// приглашений.
+var promptRe = regexp.MustCompile(`[^\s@]*@[^\s:]*:\S* \$ `)
+
+func runShell(t *testing.T, input string) (string, *options) {
+	t.Helper()
+
+	opts := &options{norc: true}
+	inbuf := bytes.NewBufferString(input)
+	outbuf := &bytes.Buffer{}
+
+	done := make(chan Status)
+	go func() {
+		done <- do(inbuf, outbuf, outbuf, opts)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("shell did not finish")
+	}
+
+	// Приглашение меняется вместе с текущим каталогом.
+	output := promptRe.ReplaceAllString(outbuf.String(), "")
+	return strings.TrimSuffix(output, "\n"), opts
+}
+
+func TestPipeline(t *testing.T) {
+	t.Run(("test pipeline"), func(t *testing.T) {
+		opts := new(options)
+		inbuf := &bytes.Buffer{}
+		outbuf := &bytes.Buffer{}
+
+		// Без одновременного запуска команд первая никогда не завершится, а
+		// вторая заблокируется на переполненном канале.
+		inbuf.WriteString("yes | head -1\n")
+		inbuf.WriteString("seq 1 100000 | cat | tail -1\n")
+		inbuf.WriteString("false | true\n")
+		inbuf.WriteString("echo $?\n")
+		inbuf.WriteString("set -o pipefail\n")
+		inbuf.WriteString("false | true\n")
+		inbuf.WriteString("echo $?\n")
+		inbuf.WriteString("echo piped | cat | exit 5\n")
+		inbuf.WriteString("exit\n")
+
+		done := make(chan Status)
+		go func() {
+			done <- do(inbuf, outbuf, outbuf, opts)
+		}()
+
+		var status Status
+		select {
+		case status = <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("pipeline deadlocked")
+		}
+
+		if status.code != 5 {
+			t.Fatalf("status == %v; want code 5", status)
+		}
+
+		prefix := opts.prompt()
+		cleaned := strings.ReplaceAll(outbuf.String(), prefix, "")
+		expected := "y\n100000\n0\n1\n"
+		if cleaned != expected {
+			t.Fatalf("output == %q; want %q", cleaned, expected)
+		}
+	})
+}
+
+// formatNode выводит дерево разбора в виде скобочной записи.
+func formatNode(n interface{}) string {
+	switch n := n.(type) {
+	case *listNode:
+		items := []string{}
+		for _, item := range n.items {
+			items = append(items, formatNode(item))
+		}
+		if len(items) == 1 {
+			return items[0]
+		}
+		return "(; " + strings.Join(items, " ") + ")"
+	case *andOrNode:
+		res := formatNode(n.pipelines[0])
+		for i, op := range n.ops {
+			res = "(" + op + " " + res + " " + formatNode(n.pipelines[i+1]) + ")"
+		}
+		if n.background {
+			res = "(& " + res + ")"
+		}
+		return res
+	case *Pipeline:
+		cmds := []string{}
+		for _, cmd := range n.cmds {
+			cmds = append(cmds, formatNode(cmd))
+		}
+		res := cmds[0]
+		if len(cmds) > 1 {
+			res = "(| " + strings.Join(cmds, " ") + ")"
+		}
+		if n.negate {
+			res = "(! " + res + ")"
+		}
+		return res
+	case *subshellNode:
+		return "(subshell " + formatNode(n.body) + ")"
+	case *groupNode:
+		return "(group " + formatNode(n.body) + ")"
+	case *simpleCommand:
+		words := append(append([]string{}, n.assigns...), n.words...)
+		return "[" + strings.Join(words, " ") + "]"
+	case *ifNode:
+		res := "(if"
+		for i, cond := range n.conds {
+			res += " " + formatNode(cond) + " " + formatNode(n.bodies[i])
+		}
+		if n.elseBody != nil {
+			res += " " + formatNode(n.elseBody)
+		}
+		return res + ")"
+	case *loopNode:
+		keyword := "while"
+		if n.until {
+			keyword = "until"
+		}
+		return "(" + keyword + " " + formatNode(n.cond) + " " + formatNode(n.body) + ")"
+	case *forNode:
+		words := "$@"
+		if n.words != nil {
+			words = "[" + strings.Join(n.words, " ") + "]"
+		}
+		return "(for " + n.name + " " + words + " " + formatNode(n.body) + ")"
+	case *caseNode:
+		res := "(case " + n.word
+		for _, item := range n.items {
+			res += " (" + strings.Join(item.patterns, "|") + " " + formatNode(item.body) + ")"
+		}
+		return res + ")"
+	case *funcDef:
+		return "(func " + n.name + " " + formatNode(n.body) + ")"
+	}
+	return "?"
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"a", "[a]"},
+		{"a; b", "(; [a] [b])"},
+		{"a;b;", "(; [a] [b])"},
+		{"a | b && c", "(&& (| [a] [b]) [c])"},
+		{"a && b | c", "(&& [a] (| [b] [c]))"},
+		{"a || b && c", "(&& (|| [a] [b]) [c])"},
+		{"a && b || c; d", "(; (|| (&& [a] [b]) [c]) [d])"},
+		{"! a | b || c", "(|| (! (| [a] [b])) [c])"},
+		{"a && ! b", "(&& [a] (! [b]))"},
+		{"(a; b) | c", "(| (subshell (; [a] [b])) [c])"},
+		{"{ a || b; } && c", "(&& (group (|| [a] [b])) [c])"},
+		{"( (a) )", "(subshell (subshell [a]))"},
+		{"echo } { !", "[echo } { !]"},
+		{"echo 'a;b' \"c|d\" e\\&f $(g; h) `i|j`", "[echo 'a;b' \"c|d\" e\\&f $(g; h) `i|j`]"},
+		{"a &&\nb |\n c", "(&& [a] (| [b] [c]))"},
+		{"a # comment; b", "[a]"},
+		{"a & b; c &", "(; (& [a]) [b] (& [c]))"},
+		{"a && b | c &", "(& (&& [a] (| [b] [c])))"},
+		{"{ a & } | b", "(| (group (& [a])) [b])"},
+		{"A=1 B=\"x y\" cmd C=2", "[A=1 B=\"x y\" cmd C=2]"},
+		{"if a; then b; fi", "(if [a] [b])"},
+		{"if a\nthen b\nelif c; then d; else e; fi | f", "(| (if [a] [b] [c] [d] [e]) [f])"},
+		{"echo if then fi", "[echo if then fi]"},
+		{"while a; do b; c; done", "(while [a] (; [b] [c]))"},
+		{"until a; do b; done >out", "(until [a] [b])"},
+		{"for x in a 'b c'; do d; done", "(for x [a 'b c'] [d])"},
+		{"for x\ndo d; done", "(for x $@ [d])"},
+		{"for x in; do d; done", "(for x [] [d])"},
+		{"case $x in a|b) c;; (*) d; e;; esac", "(case $x (a|b [c]) (* (; [d] [e])))"},
+		{"case x in\n a) ;;\n b) c\nesac", "(case x (a (; )) (b [c]))"},
+		{"f() { a; }", "(func f (group [a]))"},
+		{"function f { a; }", "(func f (group [a]))"},
+		{"function f() (a)", "(func f (subshell [a]))"},
+	}
+
+	for _, c := range cases {
+		list, err := parse(c.in)
+		if err != nil {
+			t.Errorf("parse(%q) error: %v", c.in, err)
+			continue
+		}
+
+		if got := formatNode(list); got != c.want {
+			t.Errorf("parse(%q) == %s; want %s", c.in, got, c.want)
+		}
+	}
+
+	errCases := []struct {
+		in  string
+		err error
+	}{
+		{"a |", ErrUnexpectedEOF},
+		{"a &&", ErrUnexpectedEOF},
+		{"(a", ErrUnexpectedEOF},
+		{"{ a; ", ErrUnexpectedEOF},
+		{"echo 'a", ErrUnexpectedEOF},
+		{"echo $(a", ErrUnexpectedEOF},
+		{"| a", ErrInvalidSyntax},
+		{"a ;; b", ErrInvalidSyntax},
+		{"a && || b", ErrInvalidSyntax},
+		{"()", ErrInvalidSyntax},
+		{"a )", ErrInvalidSyntax},
+		{"{ a }", ErrUnexpectedEOF},
+		{"& a", ErrInvalidSyntax},
+		{"a & ;", ErrInvalidSyntax},
+		{"a && &", ErrInvalidSyntax},
+		{"if a; then b", ErrUnexpectedEOF},
+		{"if a; fi", ErrInvalidSyntax},
+		{"if; then b; fi", ErrInvalidSyntax},
+		{"then", ErrInvalidSyntax},
+		{"a; done", ErrInvalidSyntax},
+		{"while a; do done", ErrInvalidSyntax},
+		{"for x in a b do c; done", ErrInvalidSyntax},
+		{"case a in b) c;;", ErrUnexpectedEOF},
+		{"case a in b c) d;; esac", ErrInvalidSyntax},
+		{"f() a", ErrInvalidSyntax},
+		{"{ a; } }", ErrInvalidSyntax},
+	}
+
+	// Текст команды, который показывает jobs.
+	list, err := parse(`! a 2>&1 'b c' | (d; e &) >>f && { g & } || { h; } <i`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `! a 'b c' 2>&1 | (d; e &) >>f && { g & } || { h; } <i`
+	if got := list.String(); got != want {
+		t.Errorf("String() == %s; want %s", got, want)
+	}
+
+	for _, c := range errCases {
+		_, err := parse(c.in)
+		if !errors.Is(err, c.err) {
+			t.Errorf("parse(%q) error == %v; want %v", c.in, err, c.err)
+		}
+	}
+}
+
+func TestLists(t *testing.T) {
+	dir := t.TempDir()
+	output, _ := runShell(t, strings.Join([]string{
+		"echo a; echo b",
+		"false && echo no || echo yes",
+		"true || echo no && echo yes",
+		"! false && echo negated",
+		"! true; echo $?",
+		"(cd " + dir + "; pwd; exit 3); echo $?",
+		"pwd",
+		"{ echo x; echo y; } | cat",
+		"(echo 1; echo 2) > " + dir + "/out.txt; cat " + dir + "/out.txt",
+		"{ cd " + dir + "; }; pwd",
+		"{ exit 4; }; echo unreachable",
+	}, "\n")+"\n")
+
+	cwd, _ := os.Getwd()
+	expected := strings.Join([]string{
+		"a", "b",
+		"yes",
+		"yes",
+		"negated",
+		"1",
+		dir, "3",
+		cwd,
+		"x", "y",
+		"1", "2",
+		dir,
+	}, "\n")
+
+	if output != expected {
+		t.Fatalf("output == %q; want %q", output, expected)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"sleep 0.2 &",
+		"echo $! | grep -c '^[0-9][0-9]*$'",
+		"jobs",
+		"wait %1; echo wait $?",
+		"sh -c 'exit 3' &",
+		"sleep 0.2",
+		"wait $!; echo code $?",
+		"true &",
+		"sleep 0.2",
+		"sleep 0.3 & sleep 5 &",
+		"/bin/kill -STOP $!",
+		"sleep 0.2",
+		"jobs",
+		"disown %2",
+		"/bin/kill -KILL $!",
+		"wait %1",
+		"jobs %1",
+		"sleep 0.3 &",
+		"/bin/kill -STOP $!",
+		"sleep 0.2",
+		"fg; echo fg $?",
+		"jobs",
+		"fg",
+		"wait 1",
+	}, "\n")+"\n")
+
+	// Номера процессов меняются от запуска к запуску.
+	output = regexp.MustCompile(`\] \d+`).ReplaceAllString(output, "] PID")
+
+	expected := strings.Join([]string{
+		"[1] PID",
+		"1",
+		"[1]+  Running                 sleep 0.2 &",
+		"wait 0",
+		"[1] PID",
+		"[1]+  Exit 3                  sh -c 'exit 3'",
+		"code 3",
+		"[1]",
+		"[1]+  Done                    true",
+		"[1] PID",
+		"[2] PID",
+		"[2]+  Stopped                 sleep 5",
+		"[1]-  Running                 sleep 0.3 &",
+		"[2]+  Stopped                 sleep 5",
+		"jobs: %1: no such job",
+		"[1] PID",
+		"[1]+  Stopped                 sleep 0.3",
+		"sleep 0.3",
+		"fg 0",
+		"fg: no current job",
+		"wait: pid 1 is not a child of this shell",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+
+	// Фоновое задание из встроенных команд не задерживает шелл, даже если
+	// ждет FIFO, а номер задания выводит только интерактивный шелл.
+	fifo := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	done := make(chan Status, 1)
+	go func() {
+		script := "read x < " + fifo + " & echo after; echo line > " + fifo + "; wait; sleep 0.1 & echo $! | grep -c '^[0-9]'"
+		done <- shell([]string{"-c", script}, &bytes.Buffer{}, out, out, new(options))
+	}()
+	select {
+	case status := <-done:
+		if status.code != 0 || out.String() != "after\n1\n" {
+			t.Errorf("shell(-c) == %d, %q; want 0, %q", status.code, out.String(), "after\n1\n")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("background builtin blocked the shell")
+	}
+}
+
+func TestKill(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"sleep 5 & sleep 5 &",
+		"kill -INT %1 %2; wait %1; echo int $?; wait %2; echo int $?",
+		"sleep 5 &",
+		"kill -s KILL $!; wait $!; echo kill $?",
+		"sleep 5 &",
+		"kill -9 %1; sleep 0.2; jobs",
+		"sh -c 'kill -USR1 $$'; echo usr1 $?",
+		"kill -l 2 130 sigterm hup",
+		"kill -l | head -1",
+		"kill -0 $$; echo self $?",
+		"kill -BAD 1; kill -s; kill; kill %5 x; echo $?",
+	}, "\n")+"\n")
+
+	output = regexp.MustCompile(`\] \d+`).ReplaceAllString(output, "] PID")
+
+	expected := strings.Join([]string{
+		"[1] PID",
+		"[2] PID",
+		"int 130",
+		"int 130",
+		"[1] PID",
+		"kill 137",
+		"[1] PID",
+		"[1]+  Killed                  sleep 5",
+		"terminated by signal 10",
+		"usr1 138",
+		"INT",
+		"INT",
+		"15",
+		"1",
+		" 1) SIGHUP\t 2) SIGINT\t 3) SIGQUIT\t 4) SIGILL\t 5) SIGTRAP",
+		"self 0",
+		"kill: BAD: invalid signal specification",
+		"kill: -s: option requires an argument",
+		"kill: " + ErrKillUsage.Error(),
+		"kill: %5: no such job",
+		"kill: `x': not a pid or valid job spec",
+		"1",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestPs(t *testing.T) {
+	// testdata/proc - процессы 1, 2 и 100-103; шелл - процесс 100 на pts/0.
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, strings.Join([]string{
+			"PID TTY       TIME CMD",
+			"100 pts/0 00:00:04 wbsh",
+			"101 pts/0 00:00:00 sleep",
+		}, "\n")},
+		{[]string{"-ef"}, strings.Join([]string{
+			"UID   PID PPID STIME TTY       TIME CMD",
+			"root    1    0 Nov15 ?     00:00:02 /sbin/init splash",
+			"root    2    0 Nov15 ?     00:00:00 [kthreadd]",
+			"root  100    1 Nov15 pts/0 00:00:04 wbsh",
+			"root  101  100 Nov15 pts/0 00:00:00 sleep 100",
+			"root  102    1 Nov15 pts/1 00:06:04 vim notes.txt",
+			"54321 103    1 Nov15 pts/0 00:00:00 tmux",
+		}, "\n")},
+		{[]string{"-o", "pid,ppid,user,rss,cmd"}, strings.Join([]string{
+			"PID PPID USER  RSS CMD",
+			"100    1 root 5200 wbsh",
+			"101  100 root 1000 sleep 100",
+		}, "\n")},
+		{[]string{"-eo", "pid,rss,comm", "--sort=-rss,pid"}, strings.Join([]string{
+			"PID   RSS COMMAND",
+			"102 12000 vim",
+			"  1  9000 init",
+			"100  5200 wbsh",
+			"103  3000 tmux: server (1)",
+			"101  1000 sleep",
+			"  2     0 kthreadd",
+		}, "\n")},
+		{[]string{"-e", "--sort", "tty,-pid", "-o", "pid=,tty="}, strings.Join([]string{
+			"  2 ?",
+			"  1 ?",
+			"103 pts/0",
+			"101 pts/0",
+			"100 pts/0",
+			"102 pts/1",
+		}, "\n")},
+		{[]string{"-o", "bad"}, "ps: bad: unknown format specifier"},
+		{[]string{"--sort=bad"}, "ps: bad: unknown sort specifier"},
+		{[]string{"-x"}, "ps: -x: invalid option"},
+		{[]string{"-o"}, "ps: -o: option requires an argument"},
+	}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		cmd := &CMD{prog: "ps", args: c.args, streams: streams{stdout: &buf, stderr: &buf}}
+		cmd.report(psFrom(cmd, &options{pid: 100}, "testdata/proc"))
+
+		if output := buf.String(); output != c.expected+"\n" {
+			t.Errorf("ps %q ==\n%s\nwant\n%s", c.args, output, c.expected)
+		}
+	}
+
+	// Без /proc выполняется системная ps.
+	if _, err := exec.LookPath("ps"); err != nil {
+		t.Skip("ps is not installed")
+	}
+	opts := &options{}
+	if err := opts.complete(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	pid := strconv.Itoa(os.Getpid())
+	cmd := &CMD{prog: "ps", args: []string{"-o", "pid=", "-p", pid}, streams: streams{stdout: &buf, stderr: &buf}}
+	if status := psFrom(cmd, opts, t.TempDir()); status.code != 0 || strings.TrimSpace(buf.String()) != pid {
+		t.Errorf("system ps == %d, %q; want 0, %q", status.code, buf.String(), pid)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	opts := &options{
+		vars: variables{
+			"A":    {value: "1"},
+			"E":    {value: ""},
+			"S":    {value: " a  b "},
+			"F":    {value: "/usr/lib/x.tar.gz"},
+			"STAR": {value: "*"},
+			"HOME": {value: "/home/u"},
+		},
+		arg0:        "wbsh",
+		args:        []string{"p 1", "p2"},
+		pid:         42,
+		lastCmdCode: 3,
+	}
+
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{`$A`, []string{"1"}},
+		{`'$A'`, []string{"$A"}},
+		{`"$A"`, []string{"1"}},
+		{`\$A`, []string{"$A"}},
+		{`"\$A \x"`, []string{`$A \x`}},
+		{`a${A}b`, []string{"a1b"}},
+		{`$E`, []string{}},
+		{`"$E"`, []string{""}},
+		{`''`, []string{""}},
+		{`$S`, []string{"a", "b"}},
+		{`"$S"`, []string{" a  b "}},
+		{`x$S`, []string{"x", "a", "b"}},
+		{`$? $$ $# $0`, []string{"3", "42", "2", "wbsh"}},
+		{`$1`, []string{"p", "1"}},
+		{`"$1"`, []string{"p 1"}},
+		{`"$@"`, []string{"p 1", "p2"}},
+		{`"x$@y"`, []string{"xp 1", "p2y"}},
+		{`"$*"`, []string{"p 1 p2"}},
+		{`$@`, []string{"p", "1", "p2"}},
+		{`$3 ${10}`, []string{}},
+		{`${#F} ${#U} ${#}`, []string{"17", "0", "2"}},
+		{`${U:-def} ${E:-def} ${E-def}`, []string{"def", "def"}},
+		{`${U:-"a b"}`, []string{"a", "b"}},
+		{`"${U:-a  b}"`, []string{"a  b"}},
+		{`${A:+set} ${E:+set} ${E+set} ${U+set}`, []string{"set", "set"}},
+		{`${F%.*} ${F%%.*} ${F#*/} ${F##*/}`, []string{"/usr/lib/x.tar", "/usr/lib/x", "usr/lib/x.tar.gz", "x.tar.gz"}},
+		{`${F%"*"}`, []string{"/usr/lib/x.tar.gz"}},
+		{`${STAR#\*}x`, []string{"x"}},
+		{`${F#$STAR}x ${F##$STAR}x`, []string{"/usr/lib/x.tar.gzx", "x"}},
+		{`${F%[.]gz}`, []string{"/usr/lib/x.tar"}},
+		{`$ "$" $-x`, []string{"$", "$", "x"}},
+		{`{a,b}{1,2} x{y,{z,w}}`, []string{"a1", "a2", "b1", "b2", "xy", "xz", "xw"}},
+		{`{1..3} {3..1} {05..10..2} {c..a} {a..e..2}`, []string{"1", "2", "3", "3", "2", "1", "05", "07", "09", "c", "b", "a", "a", "c", "e"}},
+		{`"{a,b}" \{a,b} {x} {} {a..} ${A}{,0} '$'{A,B}`, []string{"{a,b}", "{a,b}", "{x}", "{}", "{a..}", "1", "10", "$A", "$B"}},
+		{`~ ~/x "~" \~ x~ ~"/x"`, []string{"/home/u", "/home/u/x", "~", "~", "x~", "~/x"}},
+	}
+
+	for _, c := range cases {
+		tokens, err := tokenize(c.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		words := []string{}
+		for _, tok := range tokens {
+			if tok.kind == tokWord {
+				words = append(words, tok.val)
+			}
+		}
+
+		got, err := opts.expandWords(words, streams{})
+		if err != nil {
+			t.Errorf("expand(%s) error: %v", c.in, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("expand(%s) == %q; want %q", c.in, got, c.want)
+		}
+	}
+
+	errCases := []struct {
+		in  string
+		err error
+	}{
+		{`${U:?}`, ErrParameterNotSet},
+		{`${E:?}`, ErrParameterNotSet},
+		{`${A!}`, ErrBadSubstitution},
+		{`${}`, ErrBadSubstitution},
+		{`${#A:-x}`, ErrBadSubstitution},
+		{`${A`, ErrBadSubstitution},
+		{`${3:=x}`, ErrCannotAssign},
+	}
+
+	for _, c := range errCases {
+		_, err := opts.expandWords([]string{c.in}, streams{})
+		if !errors.Is(err, c.err) {
+			t.Errorf("expand(%s) error == %v; want %v", c.in, err, c.err)
+		}
+	}
+
+	if _, err := opts.expandWords([]string{"${N:=new}"}, streams{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := opts.getVar("N"); v != "new" {
+		t.Errorf("N == %q after ${N:=new}; want %q", v, "new")
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.txt", ".hidden.go", "sub/d.go", "sub/deep/e.go", "[x]"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		in    string
+		shopt []string
+		want  []string
+	}{
+		{in: `*.go`, want: []string{"a.go", "b.go"}},
+		{in: `?.* [!ab].*`, want: []string{"a.go", "b.go", "c.txt", "c.txt"}},
+		{in: `"*.go" \*.go '*'.go`, want: []string{"*.go", "*.go", "*.go"}},
+		{in: `*/ sub/*`, want: []string{"sub/", "sub/d.go", "sub/deep"}},
+		{in: `.*.go`, want: []string{".hidden.go"}},
+		{in: `*.go`, shopt: []string{"dotglob"}, want: []string{".hidden.go", "a.go", "b.go"}},
+		{in: `{a,c}.* x*`, want: []string{"a.go", "c.txt", "x*"}},
+		{in: `x* y`, shopt: []string{"nullglob"}, want: []string{"y"}},
+		{in: `**/*.go`, want: []string{"sub/d.go"}},
+		{in: `**/*.go`, shopt: []string{"globstar"}, want: []string{"a.go", "b.go", "sub/d.go", "sub/deep/e.go"}},
+		{in: `sub/**`, shopt: []string{"globstar"}, want: []string{"sub/d.go", "sub/deep", "sub/deep/e.go"}},
+		{in: `$P`, want: []string{"a.go", "b.go"}},
+		{in: `"$P" [x] [`, want: []string{"*.go", "[x]", "["}},
+		{in: dir + `/*.txt`, want: []string{dir + "/c.txt"}},
+	}
+
+	for _, c := range cases {
+		opts := &options{workDir: dir, vars: variables{"P": {value: "*.go"}}}
+		for _, name := range c.shopt {
+			*opts.shoptOption(name) = true
+		}
+
+		tokens, err := tokenize(c.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		words := []string{}
+		for _, tok := range tokens {
+			if tok.kind == tokWord {
+				words = append(words, tok.val)
+			}
+		}
+
+		got, err := opts.expandWords(words, streams{})
+		if err != nil {
+			t.Errorf("expand(%s) error: %v", c.in, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("expand(%s) %v == %q; want %q", c.in, c.shopt, got, c.want)
+		}
+	}
+
+	opts := &options{workDir: dir, vars: variables{}, failglob: true}
+	if _, err := opts.expandWords([]string{"x*"}, streams{}); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("expand(x*) with failglob error == %v; want %v", err, ErrNoMatch)
+	}
+
+	opts.noglob = true
+	if got, err := opts.expandWords([]string{"x*", "*.go"}, streams{}); err != nil || !reflect.DeepEqual(got, []string{"x*", "*.go"}) {
+		t.Errorf("expand(x* *.go) with noglob == %q, %v", got, err)
+	}
+
+	output, _ := runShell(t, strings.Join([]string{
+		"cd " + dir,
+		"echo *.go; set -f; echo *.go; set +f; set -o noglob; echo *.txt; set +o noglob",
+		"shopt -s nullglob failglob; shopt nullglob; shopt -u nullglob; shopt -q nullglob; echo $?",
+		"echo x*; echo $?",
+		"shopt -u failglob; shopt",
+		"shopt -s bad",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"a.go b.go",
+		"*.go",
+		"*.txt",
+		"nullglob       \ton",
+		"1",
+		"no match: x*",
+		"1",
+		"dotglob        \toff",
+		"failglob       \toff",
+		"globstar       \toff",
+		"nullglob       \toff",
+		"shopt: bad: invalid shell option name",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"A=1 B=$A; echo $A $B",
+		"A=2 sh -c 'echo child $A'; echo shell $A",
+		"sh -c 'echo [$A]'",
+		"export A; sh -c 'echo exported $A'",
+		"A=3; sh -c 'echo updated $A'",
+		"export -n A; sh -c 'echo [$A]'",
+		"export C=4 D; export | grep -E '^declare -x (C|D)='",
+		"unset C A; echo [$C$A]",
+		"A=5 echo $A",
+		"echo ${A:-unset}",
+		"(A=6); echo ${A:-unset}",
+		"A=7 | true; echo ${A:-unset}",
+		"X='a  b'; echo $X \"$X\"",
+		"export Y=$X; echo \"$Y\"",
+		"HOME=/h; export Q=~/q R=~/a:~/b; echo $Q $R",
+		"export 1x; echo $?",
+		"unset -v 1x",
+		"f() { echo func; }; f=1; unset f; f; echo [$f]",
+		"unset f; f",
+		"g() { :; }; unset -f g; g",
+		"unset -x",
+		": ${N:=3}; echo $N",
+		"while :; do break; done; echo loop",
+		"echo ${U:?not set}; echo $?",
+		"PATH=/nonexistent; ls",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"1 1",
+		"child 2",
+		"shell 1",
+		"[]",
+		"exported 1",
+		"updated 3",
+		"[]",
+		"declare -x C=\"4\"",
+		"declare -x D=\"\"",
+		"[]",
+		"",
+		"unset",
+		"unset",
+		"unset",
+		"a b a  b",
+		"a  b",
+		"/h/q /h/a:/h/b",
+		"export: `1x': not a valid identifier",
+		"1",
+		"unset: `1x': not a valid identifier",
+		"func",
+		"[]",
+		"f: command not found",
+		"g: command not found",
+		"unset: -x: invalid option",
+		"3",
+		"loop",
+		"U: not set",
+		"1",
+		"ls: command not found",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestCommandSubstitution(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"echo $(echo hi)",
+		"echo \"[$(printf 'a\\n\\n\\n')]\"",
+		"echo $(printf 'a  b\\nc') \"$(printf 'a  b')\"",
+		"echo $(echo $(echo nested))",
+		"echo `echo back \\`echo quoted\\``",
+		"A=$(false); echo $?",
+		"A=$(echo value) true; echo [$A]",
+		"echo $(A=inner; echo $A) [$A]",
+		"echo $(exit 3) $?",
+		"echo [$(true)] [\"$(true)\"]",
+		"echo '$(echo no)'",
+		"echo $(echo err >&2)",
+		"echo $(cd /; pwd) $(echo done | tr a-z A-Z)",
+		"echo $(case x in x) echo ok;; esac)",
+		"echo \"$(case b in (a) echo a;; b|c) case d in d) echo nested;; esac; (echo sub);; esac)\"",
+		"echo $(echo case in esac)",
+		"PS2=",
+		"x=$(",
+		" # it's a comment",
+		" echo val",
+		"); echo $x",
+		"echo $(echo a # )",
+		") $(echo b#c)",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"hi",
+		"[a]",
+		"a b c a  b",
+		"nested",
+		"back quoted",
+		"1",
+		"[]",
+		"inner []",
+		"3",
+		"[] []",
+		"$(echo no)",
+		"err",
+		"",
+		"/ DONE",
+		"ok",
+		"nested",
+		"sub",
+		"case in esac",
+		"val",
+		"a b#c",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"2 ** 10", 1024},
+		{"-2 ** 2", 4},
+		{"2 ** 3 ** 2", 512},
+		{"7 / 2 + 7 % 3", 4},
+		{"-7 / 2", -3},
+		{"1 << 4 | 1", 17},
+		{"~0 ^ 5 & 3", -2},
+		{"3 > 2 && 2 >= 2 && 1 != 2", 1},
+		{"0 || 0", 0},
+		{"!5 == 0", 1},
+		{"0 ? 1 : 2 ? 3 : 4", 3},
+		{"0x1f + 010 + 2#101", 44},
+		{"N + 1", 4},
+		{"EXPR * 2", 14},
+		{"U + 1", 1},
+		{"a = 5, a += 2, a", 7},
+		{"b = 1, b++ + b", 3},
+		{"c = 1, ++c * 10", 20},
+		{"0 && (z = 1)", 0},
+		{"1 || 1 / 0", 1},
+		{"", 0},
+	}
+
+	opts := &options{vars: variables{}}
+	opts.setVar("N", "3")
+	opts.setVar("EXPR", "3 + 4")
+
+	for _, c := range cases {
+		got, err := opts.evalArith(c.in)
+		if err != nil {
+			t.Errorf("evalArith(%s) error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("evalArith(%s) == %d; want %d", c.in, got, c.want)
+		}
+	}
+
+	if _, ok := opts.getVar("z"); ok {
+		t.Errorf("z is set by a short-circuited assignment")
+	}
+
+	errCases := []struct {
+		in  string
+		err error
+	}{
+		{"1 / 0", ErrDivisionByZero},
+		{"5 % (2 - 2)", ErrDivisionByZero},
+		{"1 +", ErrArithSyntax},
+		{"(1", ErrArithSyntax},
+		{"1 2", ErrArithSyntax},
+		{"2 ** -1", ErrNegativeExponent},
+		{"LOOP", ErrArithRecursion},
+	}
+
+	opts.setVar("LOOP", "LOOP + 1")
+	for _, c := range errCases {
+		if _, err := opts.evalArith(c.in); !errors.Is(err, c.err) {
+			t.Errorf("evalArith(%s) error == %v; want %v", c.in, err, c.err)
+		}
+	}
+
+	output, _ := runShell(t, strings.Join([]string{
+		"i=1; echo $((i++)) $i $(( $(echo 6) * 7 )) \"$((i * 2))\"",
+		"echo $((1 / 0)); echo $?",
+	}, "\n")+"\n")
+
+	expected := "1 2 42 4\n1 / 0: division by 0\n1\n"
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestControlFlow(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"if false; then echo a; elif true; then echo b; else echo c; fi",
+		"if false; then echo a; fi; echo $?",
+		"if true; then false; fi; echo $?",
+		"for x in a 'b c' $(echo d e); do echo \"[$x]\"; done",
+		"for x in 1 2 3; do echo $x; done | tail -1",
+		"i=0; while [ $i -lt 5 ]; do i=$((i + 1)); [ $i = 2 ] && continue; [ $i = 4 ] && break; echo i$i; done",
+		"until [ $i = 0 ]; do i=$((i - 1)); done; echo i$i",
+		"for a in 1 2; do for b in 1 2 3; do [ $b = 2 ] && continue 2; echo $a$b; done; done",
+		"for a in 1 2; do for b in 1 2; do break 5; done; echo no; done; echo broken",
+		"for a in 1 2; do (break); echo $a; done",
+		"case abc in x*) echo x;; a*c|z) echo match;; *) echo default;; esac",
+		"case '*' in \\*) echo star;; esac",
+		"V=b; case $V in a) ;; $V) echo var;; esac",
+		"f() { echo \"f: $# $1\"; return 4; echo no; }; f x y; echo $?",
+		"g() { local L=inner G=changed; echo $L; }; G=global L=outer; g; echo $L $G",
+		"h() { echo $1; [ $1 -gt 0 ] && h $(($1 - 1)); }; h 2",
+		"k() { for i in 1 2 3; do [ $i = 2 ] && return $i; done; }; k; echo $?",
+		"m() { echo piped; } ; m | tr a-z A-Z",
+		"n() { echo $1; }; o() { echo $1; n r; echo $1; }; o p",
+		"break; echo $?",
+		"return",
+		"local x",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"b",
+		"0",
+		"1",
+		"[a]", "[b c]", "[d]", "[e]",
+		"3",
+		"i1", "i3",
+		"i0",
+		"11", "21",
+		"broken",
+		"1", "2",
+		"match",
+		"star",
+		"var",
+		"f: 2 x",
+		"4",
+		"inner",
+		"outer global",
+		"2", "1", "0",
+		"2",
+		"PIPED",
+		"p", "r", "p",
+		"break: only meaningful in a `for', `while', or `until' loop",
+		"0",
+		"return: can only `return' from a function or sourced script",
+		"local: can only be used in a function",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestScript(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "deploy.sh")
+	err := os.WriteFile(script, []byte(strings.Join([]string{
+		"#!/bin/sh",
+		"echo \"$0 $# $1\"",
+		"deploy() {",
+		"    for host in \"$@\"; do",
+		"        case $host in",
+		"        prod-*)",
+		"            echo \"skip $host\" ;;",
+		"        *)",
+		"            echo \"deploy $host\" \\",
+		"                done",
+		"        esac",
+		"    done",
+		"}",
+		"deploy \"$@\"",
+		"if [ $# -gt 1 ]",
+		"then",
+		"    exit 3",
+		"fi",
+		"echo unreachable",
+	}, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		args   []string
+		output string
+		code   int
+	}{
+		{[]string{script, "dev-1", "prod-2"}, script + " 2 dev-1\ndeploy dev-1 done\nskip prod-2\n", 3},
+		{[]string{script}, script + " 0 \nunreachable\n", 0},
+		{[]string{"-c", "echo $0 $1; exit 5", "name", "arg"}, "name arg\n", 5},
+		{[]string{"-c", "shift; echo $# $1; shift 2; echo $? $1; shift 5; echo $? $#; shift x", "name", "a", "b", "c", "d"}, "3 b\n0 d\n1 1\n", 1},
+		{[]string{"-c", "false"}, "", 1},
+		{[]string{"-c", "echo start; if true", "name"}, "", 2},
+		{[]string{"-c"}, "", 2},
+		{[]string{"-x"}, "", 2},
+		{[]string{filepath.Join(dir, "missing.sh")}, "", 127},
+	}
+
+	for _, c := range cases {
+		out := &bytes.Buffer{}
+		status := shell(c.args, &bytes.Buffer{}, out, io.Discard, new(options))
+		if !status.exit || status.code != c.code || out.String() != c.output {
+			t.Errorf("shell(%q) == %d, %q; want %d, %q", c.args, status.code, out.String(), c.code, c.output)
+		}
+	}
+}
+
+func TestAlias(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"alias say='echo said' e='echo ' x=X both='echo a; echo b'",
+		"alias ls='ls -d' l=ls",
+		"say hi; e x; V=1 say x; both",
+		"l /",
+		"echo $(say inner) say",
+		"alias q=\"it's\" 'a/b=c'; alias q; alias",
+		"if say; then say; fi",
+		"unalias say nope; say",
+		"alias say || echo gone; unalias -a; alias; unalias",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"said hi", "X", "said x", "a", "b",
+		"/",
+		"said inner say",
+		"alias: `a/b': invalid alias name",
+		"alias q='it'\\''s'",
+		"alias both='echo a; echo b'",
+		"alias e='echo '",
+		"alias l='ls'",
+		"alias ls='ls -d'",
+		"alias q='it'\\''s'",
+		"alias say='echo said'",
+		"alias x='X'",
+		"said", "said",
+		"unalias: nope: not found",
+		"said",
+		"alias: say: not found",
+		"gone",
+		"unalias: " + ErrUnaliasUsage.Error(),
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+
+	// Слово в кавычках и зарезервированное слово - не псевдонимы.
+	aliases := map[string]string{"s": "sudo ", "sudo": "run", "ll": "ls -l", "ls": "ls -F", "loop": "echo; loop", "if": "x"}
+	list, err := parseAliases(`\ll; 'll' x; s ll; loop; if ll; then :; fi`, aliases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := list.String(), `\ll; 'll' x; run ls -F -l; echo; loop; if ls -F -l; then :; fi`; got != want {
+		t.Errorf("parseAliases == %s; want %s", got, want)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/feature/x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{
+		username:    "user",
+		hostname:    "box.example.com",
+		homeDir:     "/home/user",
+		workDir:     "/home/user/projects/app",
+		lastCmdCode: 3,
+		arg0:        "/usr/bin/wbsh",
+		vars:        variables{},
+	}
+	now := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+
+	cases := []struct {
+		ps1  string
+		want string
+	}{
+		{defaultPS1, "user@box.example.com:~/projects/app $ "},
+		{`\h:\W [\?] \s\j> `, "box:app [3] wbsh0> "},
+		{`\t \T \A \@ \d`, "14:07:09 02:07:09 14:07 02:07 PM Tue Mar 05"},
+		{`\[\e[1;32m\]\u\[\033[0m\] \\ \x \{none} \101`, "\x1b[1;32muser\x1b[0m \\ \\x \\{none} A"},
+		{`\{git}`, ""},
+	}
+	for _, c := range cases {
+		if got := opts.expandPrompt(c.ps1, now); got != c.want {
+			t.Errorf("expandPrompt(%q) == %q; want %q", c.ps1, got, c.want)
+		}
+	}
+
+	opts.workDir = "/home/username"
+	if got := opts.expandPrompt(`\w \W`, now); got != "/home/username username" {
+		t.Errorf("expandPrompt outside home == %q", got)
+	}
+
+	opts.workDir = filepath.Join(repo, "src")
+	if got := opts.expandPrompt(`(\{git})`, now); got != "(feature/x)" {
+		t.Errorf("git segment == %q; want %q", got, "(feature/x)")
+	}
+}
+
+func TestRC(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	err := os.WriteFile(filepath.Join(home, ".wbshrc"), []byte(strings.Join([]string{
+		"alias hi='echo hello'",
+		"PS1='[\\?]> '",
+		"greet() { echo \"hi $1\"; }",
+		"if echo loaded",
+		"then alias bye='echo bye'; fi",
+	}, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	status := shell([]string{"-i"}, bytes.NewBufferString("hi\ngreet you\nbye; false\n"), out, out, new(options))
+	want := "loaded\n[0]> hello\n[0]> hi you\n[0]> bye\n[1]> \n"
+	if status.code != 0 || out.String() != want {
+		t.Errorf("output == %q, %d; want %q, 0", out.String(), status.code, want)
+	}
+
+	// Без -i и терминала шелл не интерактивный.
+	out.Reset()
+	shell(nil, bytes.NewBufferString("hi\n"), out, io.Discard, new(options))
+	if output := promptRe.ReplaceAllString(out.String(), ""); output != "\n" {
+		t.Errorf("non-interactive output == %q; want %q", output, "\n")
+	}
+
+	out.Reset()
+	status = shell([]string{"--norc"}, bytes.NewBufferString("hi\n"), out, io.Discard, new(options))
+	if output := promptRe.ReplaceAllString(out.String(), ""); status.code != 0 || output != "\n" {
+		t.Errorf("--norc output == %q; want %q", output, "\n")
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".wbshrc"), []byte("echo a\nif\necho b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	shell([]string{"-i"}, &bytes.Buffer{}, out, out, new(options))
+	want = "a\n" + filepath.Join(home, ".wbshrc") + ": line 2: " + ErrUnexpectedEOF.Error() + "\n"
+	if output := promptRe.ReplaceAllString(out.String(), ""); output != want+"\n" {
+		t.Errorf("output == %q; want %q", output, want+"\n")
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "lib.sh"), []byte(strings.Join([]string{
+		"echo \"args $# $1\"",
+		"LOADED=yes",
+		"if [ \"$1\" = stop ]; then return 3; fi",
+		"echo end",
+	}, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	output, _ := runShell(t, strings.Join([]string{
+		"PATH=" + dir,
+		"alias ll='ls -l'; f() { echo func; }",
+		"type ll if f cd tool; type nosuch; echo $?",
+		"type -t ll if f cd tool; type -p tool",
+		"command -v cd tool f ll; command -v nosuch || echo missing",
+		"( echo() { printf 'fn %s\\n' \"$@\"; }; echo a; command echo b )",
+		"which tool cd; echo $?",
+		"g() { source lib.sh one; echo \"$LOADED $# $1\"; }; g x y",
+		". lib.sh stop; echo \"code $?\"",
+		"source; echo $?",
+		"true; echo $?; false; echo $?",
+		"help -s cd pwd; help nosuch; echo $?",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"ll is aliased to `ls -l'",
+		"if is a shell keyword",
+		"f is a function",
+		"f() { echo func; }",
+		"cd is a shell builtin",
+		"tool is " + filepath.Join(dir, "tool"),
+		"type: nosuch: not found",
+		"1",
+		"alias", "keyword", "function", "builtin", "file",
+		filepath.Join(dir, "tool"),
+		"cd", filepath.Join(dir, "tool"), "f", "alias ll='ls -l'",
+		"missing",
+		"fn a", "b",
+		filepath.Join(dir, "tool"),
+		"1",
+		"args 1 one", "end", "yes 2 x",
+		"args 1 stop", "code 3",
+		"source: " + ErrFilenameRequired.Error(),
+		"2",
+		"0", "1",
+		"cd: cd [-L|-P] [dir]",
+		"pwd: pwd [-LP]",
+		"help: " + ErrHelpNoMatch.Error() + " `nosuch'",
+		"1",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/sub", "b", "proj/b"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, opts := runShell(t, strings.Join([]string{
+		"HOME=" + root + "; cd",
+		"cd a; pwd; cd -; echo \"$OLDPWD\"",
+		"cd nosuch; cd a b; unset HOME; cd; HOME=" + root,
+		"CDPATH=:" + filepath.Join(root, "proj") + "; cd b; cd sub; cd ~",
+		"pushd a; pushd sub; dirs -v; pushd; pushd +2; dirs -l -p",
+		"popd; popd +1; dirs; popd; popd; pushd +5",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		filepath.Join(root, "a"),
+		root,
+		filepath.Join(root, "a"),
+		"cd: nosuch: no such file or directory",
+		"cd: " + ErrTooManyArgs.Error(),
+		"cd: " + ErrHomeNotSet.Error(),
+		"cd: sub: no such file or directory",
+		"~/a ~",
+		"~/a/sub ~/a ~",
+		" 0  ~/a/sub",
+		" 1  ~/a",
+		" 2  ~",
+		"~/a ~/a/sub ~",
+		"~ ~/a ~/a/sub",
+		root,
+		filepath.Join(root, "a"),
+		filepath.Join(root, "a", "sub"),
+		"~/a ~/a/sub",
+		"~/a",
+		"~/a",
+		"popd: " + ErrDirStackEmpty.Error(),
+		"popd: " + ErrDirStackEmpty.Error(),
+		"pushd: +5: " + ErrDirStackIndex.Error(),
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+	if opts.workDir != filepath.Join(root, "a") {
+		t.Errorf("workDir == %s; want %s", opts.workDir, filepath.Join(root, "a"))
+	}
+}
+
+func TestReadPrintf(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"echo '  a b   c d  ' | { read x y; echo \"[$x][$y]\"; }",
+		"echo 'a\\ b c\\' | { read x y; echo \"[$x][$y]\"; }",
+		"echo 'a\\ b' | { read -r x y; echo \"[$x][$y]\"; }",
+		"echo 'a:b::c' | { IFS=: read a b c d; echo \"[$a][$b][$c][$d]\"; }",
+		"printf 'x;y' | { read -d ';' v; echo \"$v $?\"; read w; echo \"$w $?\"; }",
+		"printf 'l1\\nl2\\n' | while read; do echo \"got $REPLY\"; done",
+		"read 1x </dev/null; echo $?",
+		"printf '%s-%d|%5.2f|%x|%-4s|%03d|%%\\n' a 12 3.14159 255 ab 7",
+		"printf '<%s>' one two three; printf '\\n'",
+		"printf '%s=%d\\n' a 1 b",
+		"printf '%b|%s\\n' 'x\\t\\0101' 'x\\t'; printf '%b' 'stop\\c' after; printf '\\n'",
+		"printf '%*d|%.*s|%c|%q|%i|%o|%g|%e\\n' 4 9 2 hello ok 'a b' \"'A\" 8 0.5 1234.5",
+		"printf '%d\\n' 12 abc; echo $?",
+		"printf -v V '%05d' 42; echo $V; printf; echo $?; printf '%z'; echo $?",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"[a][b   c d]",
+		"[a b][c]",
+		"[a\\][b]",
+		"[a][b][][c]",
+		"x 0",
+		"y 1",
+		"got l1",
+		"got l2",
+		"read: `1x': " + ErrInvalidName.Error(),
+		"1",
+		"a-12| 3.14|ff|ab  |007|%",
+		"<one><two><three>",
+		"a=1",
+		"b=0",
+		"x\tA|x\\t",
+		"stop",
+		"   9|he|o|a\\ b|65|10|0.5|1.234500e+03",
+		"12",
+		"0",
+		"printf: abc: " + ErrInvalidNumber.Error(),
+		"1",
+		"00042",
+		"printf: " + ErrPrintfUsage.Error(),
+		"2",
+		"printf: %z: " + ErrInvalidFormat.Error(),
+		"1",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestTestBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(file, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(empty, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{}, 1},
+		{[]string{""}, 1},
+		{[]string{"x"}, 0},
+		{[]string{"-n", ""}, 1},
+		{[]string{"-z", ""}, 0},
+		{[]string{"!", "x"}, 1},
+		{[]string{"-d", dir}, 0},
+		{[]string{"-f", dir}, 1},
+		{[]string{"-f", file}, 0},
+		{[]string{"-e", filepath.Join(dir, "nosuch")}, 1},
+		{[]string{"-h", filepath.Join(dir, "link")}, 0},
+		{[]string{"-L", file}, 1},
+		{[]string{"-s", file}, 0},
+		{[]string{"-s", empty}, 1},
+		{[]string{"-r", file}, 0},
+		{[]string{"-x", dir}, 0},
+		{[]string{"-O", file}, 0},
+		{[]string{file, "-nt", empty}, 0},
+		{[]string{file, "-ot", empty}, 1},
+		{[]string{file, "-ef", filepath.Join(dir, "link")}, 0},
+		{[]string{"abc", "=", "abc"}, 0},
+		{[]string{"abc", "!=", "abc"}, 1},
+		{[]string{"a", "<", "b"}, 0},
+		{[]string{"10", "-gt", "9"}, 0},
+		{[]string{" 3", "-eq", "3"}, 0},
+		{[]string{"-1", "-ge", "0"}, 1},
+		{[]string{"1", "-lt", "x"}, 2},
+		{[]string{"(", "x", ")"}, 0},
+		{[]string{"!", "-z", "x"}, 0},
+		{[]string{"!", "1", "-eq", "1"}, 1},
+		{[]string{"x", "-a", ""}, 1},
+		{[]string{"x", "-o", ""}, 0},
+		{[]string{"-n", "x", "-a", "1", "-eq", "2"}, 1},
+		{[]string{"-n", "x", "-a", "(", "1", "-eq", "2", "-o", "-d", dir, ")"}, 0},
+		{[]string{"!", "!", "-n", "x", "-a", "x"}, 0},
+		{[]string{"(", "x", "-a", "y"}, 2},
+		{[]string{"a", "b"}, 2},
+		{[]string{"a", "b", "c"}, 2},
+		{[]string{"x", "=", "x", "y", "z"}, 2},
+	}
+
+	for _, tt := range tests {
+		cmd := &CMD{prog: "test", args: tt.args}
+		if status := test(cmd, &options{vars: map[string]*variable{}}); status.code != tt.code {
+			t.Errorf("test %q == %d (%v); want %d", tt.args, status.code, status.err, tt.code)
+		}
+	}
+
+	output, _ := runShell(t, "[ 1 -lt 2 ] && echo yes; [ 1 -lt 2; echo $?; [ -v HOME ] && echo set\n")
+	if want := "yes\n[: " + ErrMissingBracket.Error() + "\n2\nset\n"; output != want {
+		t.Errorf("output == %q; want %q", output, want)
+	}
+}
+
+func TestNc(t *testing.T) {
+	// Сервер читает запрос до EOF, то есть до полузакрытия, и отвечает.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			fmt.Fprintf(conn, "got %q\n", data)
+			conn.Close()
+		}
+	}()
+	tcpPort := ln.Addr().(*net.TCPAddr).Port
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo([]byte(strings.ToUpper(string(buf[:n]))), addr)
+		}
+	}()
+	udpPort := pc.LocalAddr().(*net.UDPAddr).Port
+
+	// Свободные порты: один никто не слушает, другой будет слушать nc -l.
+	listeners := []net.Listener{}
+	for i := 0; i < 2; i++ {
+		free, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, free)
+	}
+	closedPort := listeners[0].Addr().(*net.TCPAddr).Port
+	listenPort := listeners[1].Addr().(*net.TCPAddr).Port
+	for _, free := range listeners {
+		free.Close()
+	}
+
+	// nc -l ждет соединения, которое тест устанавливает после запуска шелла.
+	received := make(chan string, 1)
+	go func() {
+		addr := fmt.Sprintf("127.0.0.1:%d", listenPort)
+		for i := 0; i < 100; i++ {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				time.Sleep(20 * time.Millisecond)
+				continue
+			}
+			fmt.Fprint(conn, "from client\n")
+			conn.(*net.TCPConn).CloseWrite()
+			data, _ := io.ReadAll(conn)
+			conn.Close()
+			received <- string(data)
+			return
+		}
+		received <- ""
+	}()
+
+	output, _ := runShell(t, strings.Join([]string{
+		fmt.Sprintf("printf 'a\\nb\\n' | nc 127.0.0.1 %d | tr a-z A-Z", tcpPort),
+		fmt.Sprintf("nc 127.0.0.1 %d </dev/null; echo $?", tcpPort),
+		fmt.Sprintf("echo ping | nc -u -w 0.2 127.0.0.1 %d; echo $?", udpPort),
+		fmt.Sprintf("echo reply | nc -l 127.0.0.1 %d; echo $?", listenPort),
+		fmt.Sprintf("nc -z 127.0.0.1 %d; echo $?; nc -z 127.0.0.1 %d; echo $?", tcpPort, closedPort),
+		fmt.Sprintf("nc 127.0.0.1 %d </dev/null; echo $?", closedPort),
+		"nc -l -w 0.1 127.0.0.1 0 </dev/null; echo $?",
+		"nc -x; nc 127.0.0.1; nc 127.0.0.1 70000; nc -w x 127.0.0.1 1; nc -l -z 1",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		`GOT "A\NB\N"`,
+		`got ""`,
+		"0",
+		"PING",
+		"0",
+		"from client",
+		"0",
+		"0",
+		"1",
+		fmt.Sprintf("nc: connect to 127.0.0.1 port %d (tcp) failed: connection refused", closedPort),
+		"1",
+		"nc: " + ErrConnectionTimedOut.Error(),
+		"1",
+		"nc: -x: " + ErrInvalidOption.Error(),
+		"nc: " + ErrNcUsage.Error(),
+		"nc: 70000: " + ErrInvalidPort.Error(),
+		"nc: x: " + ErrInvalidTimeout.Error(),
+		"nc: " + ErrNcUsage.Error(),
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+	if got := <-received; got != "reply\n" {
+		t.Errorf("nc -l sent %q; want %q", got, "reply\n")
+	}
+}
+
+func TestHeredoc(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"PS2=",
+		"x=world",
+		"cat <<EOF",
+		`hello $x "q" \$x \"q\" $(echo sub) $((1+2))`,
+		`  two \`,
+		"joined",
+		"EOF",
+		"cat <<'EOF'; cat <<\\E2",
+		"raw $x",
+		"EOF",
+		"raw \\$x",
+		"E2",
+		"cat <<-END | tr a-z A-Z",
+		"\ttabbed $x",
+		"\tEND",
+		"f() {",
+		"  cat <<X",
+		"in $1",
+		"X",
+		"}",
+		"f func",
+		"while read l; do echo \"[$l]\"; done <<EOF",
+		"one",
+		"two",
+		"EOF",
+		"echo 'open",
+		"quote' \"a",
+		"b\" back\\",
+		"slash",
+		"echo a |",
+		"tr a A",
+		"false ||",
+		"",
+		"echo or",
+		"if true",
+		"then echo multi",
+		"fi",
+		"echo $(( 2 +",
+		"3 ))",
+		"echo ok; cat <<EOF",
+		"unterminated",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		`hello world "q" $x \"q\" sub 3`,
+		"  two joined",
+		"raw $x",
+		"raw \\$x",
+		"TABBED WORLD",
+		"in func",
+		"[one]",
+		"[two]",
+		"open",
+		"quote a",
+		"b backslash",
+		"A",
+		"or",
+		"multi",
+		"5",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+
+	// Следующие строки незаконченной команды читаются с приглашением $PS2.
+	out := &bytes.Buffer{}
+	do(bytes.NewBufferString("PS1='$ '\necho 'a\nb'\nPS2='\\s+ '\ncat <<EOF\nc\nEOF\n"), out, out, &options{norc: true, arg0: "wbsh"})
+	output = promptRe.ReplaceAllString(out.String(), "")
+	if want := "$ > a\nb\n$ $ wbsh+ wbsh+ c\n$ \n"; output != want {
+		t.Errorf("output == %q; want %q", output, want)
+	}
+}
+
+func TestSet(t *testing.T) {
+	output, _ := runShell(t, strings.Join([]string{
+		"echo $-",
+		"set -x",
+		`a="x y"; echo $a '' "q'"`,
+		"PS4='>> '",
+		"echo hi",
+		"set +x",
+		"set -o pipefail -fu",
+		"echo $-",
+		"echo ${nope:-default} $nope",
+		"echo $((nope + 1))",
+		"set +u -k",
+		"set -o bogus",
+		"set +o",
+		"set -- a 'b c'",
+		"echo $# $2",
+		"set -e",
+		"if false; then :; fi",
+		"false || echo or",
+		"! true",
+		"f() { false; echo ignored; }",
+		"f && echo and",
+		"while false; do :; done",
+		"false",
+		"echo unreachable",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"",
+		"+ a='x y'",
+		"+ echo x y '' 'q'\\'''",
+		"x y  q'",
+		"+ PS4='>> '",
+		">> echo hi",
+		"hi",
+		">> set +x",
+		"fu",
+		"nope: unbound variable",
+		"nope: unbound variable",
+		"set: -k: invalid option",
+		"set: bogus: invalid option name",
+		"set +o errexit",
+		"set -o noglob",
+		"set +o nounset",
+		"set -o pipefail",
+		"set +o xtrace",
+		"2 b c",
+		"or",
+		"ignored",
+		"and",
+	}, "\n")
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+
+	// Неинтерактивный шелл завершается на неустановленной переменной.
+	out := &bytes.Buffer{}
+	status := shell([]string{"-c", "set -u; echo $NOPE; echo after"}, &bytes.Buffer{}, out, out, new(options))
+	if !status.exit || status.code != 127 || out.String() != "NOPE: unbound variable\n" {
+		t.Errorf("shell(-c) == %d, %q; want 127, %q", status.code, out.String(), "NOPE: unbound variable\n")
+	}
+}
+
+func TestRestricted(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "restricted")
+	err := os.WriteFile(conf, []byte(strings.Join([]string{
+		"# консоль поддержки",
+		"allow sh sleep",
+		"path /usr/bin:/bin",
+		"",
+		"limit files 16",
+		"limit memory 512M",
+		"timeout 500ms",
+	}, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := strings.Join([]string{
+		"echo $PATH",
+		"cd /; echo $?",
+		"PATH=/tmp; unset SHELL; echo $?",
+		"PATH=/tmp sh -c :; echo $?",
+		"/bin/sh -c :; echo $?",
+		"ls; echo $?",
+		"echo x > " + filepath.Join(dir, "out") + "; echo $?",
+		"echo ok 2>&1",
+		". /dev/null; exec sh; echo $?",
+		`sh -c 'echo $(ulimit -n) $(ulimit -v)'`,
+		"sleep 5; echo $?",
+		`x=$(sh -c "sleep 5"); echo $?`,
+		"f() { echo func; }; f",
+	}, "\n")
+	out := &bytes.Buffer{}
+	start := time.Now()
+	status := shell([]string{"--restrictions", conf, "-c", script}, &bytes.Buffer{}, out, out, new(options))
+	// По истечении времени завершаются и процессы, запущенные командой.
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("shell() took %v, want the timeout to kill grandchildren", elapsed)
+	}
+
+	expected := strings.Join([]string{
+		"/usr/bin:/bin",
+		"cd: restricted",
+		"1",
+		"PATH: restricted: cannot modify variable",
+		"unset: SHELL: restricted: cannot modify variable",
+		"1",
+		"PATH: restricted: cannot modify variable",
+		"1",
+		"/bin/sh: restricted: cannot specify `/' in command names",
+		"126",
+		"ls: restricted: command not allowed",
+		"126",
+		filepath.Join(dir, "out") + ": restricted: cannot redirect output",
+		"1",
+		"ok",
+		".: /dev/null: restricted",
+		"exec: restricted",
+		"1",
+		"16 524288",
+		"sleep: command timed out",
+		"124",
+		"sh: command timed out",
+		"124",
+		"func",
+	}, "\n") + "\n"
+	if !status.exit || status.code != 0 || out.String() != expected {
+		t.Errorf("shell() == %d, output\n%s\nwant\n%s", status.code, out.String(), expected)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out")); err == nil {
+		t.Error("output was redirected to a file")
+	}
+
+	// Ошибка в настройках не дает шеллу запуститься.
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("allow ls\nlimit stack 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--restrictions", bad, "-c", "echo x"}, bad + ": line 2: limit stack 1: invalid restriction"},
+		{[]string{"--restrictions", filepath.Join(dir, "missing"), "-c", "echo x"}, "open " + filepath.Join(dir, "missing") + ": no such file or directory"},
+		{[]string{"--restrictions"}, "--restrictions: option requires an argument"},
+	}
+	for _, c := range cases {
+		out.Reset()
+		status = shell(c.args, &bytes.Buffer{}, out, out, new(options))
+		if !status.exit || status.code != 2 || status.err == nil || status.err.Error() != c.err || out.Len() != 0 {
+			t.Errorf("shell(%q) == %d, %v, %q; want 2, %q", c.args, status.code, status.err, out.String(), c.err)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"prog": 0755, "other": 0755, "plain": 0644} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\necho \"ran $*\"\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, _ := runShell(t, strings.Join([]string{
+		"PATH=" + dir + ":/usr/bin:/bin",
+		"hash",
+		"prog a; prog b",
+		"hash; hash -t prog",
+		"type prog",
+		"hash other nosuch; echo $?",
+		"hash -l",
+		"hash -d other; hash -t other; echo $?",
+		"PATH=$PATH:/nonexistent; hash",
+		"hash -p /bin/echo say; say hi",
+		"hash -r; hash",
+		"nosuch; echo $?",
+		"nosuch 2>/dev/null; echo $?",
+		"nosuch 2>&1 | cat",
+		"plain; echo $?",
+		dir + "; echo $?",
+		dir + "/missing; echo $?",
+		"command_not_found_handle() { echo \"handled $*\"; exit 5; }",
+		"nosuch a b; echo $?",
+		"nosuch | tr a-z A-Z",
+		"(hash prog); hash",
+	}, "\n")+"\n")
+
+	expected := strings.Join([]string{
+		"hash: hash table empty",
+		"ran a",
+		"ran b",
+		"hits\tcommand",
+		"   2\t" + filepath.Join(dir, "prog"),
+		filepath.Join(dir, "prog"),
+		"prog is hashed (" + filepath.Join(dir, "prog") + ")",
+		"hash: nosuch: not found",
+		"1",
+		"builtin hash -p " + filepath.Join(dir, "other") + " other",
+		"builtin hash -p " + filepath.Join(dir, "prog") + " prog",
+		"hash: other: not found",
+		"1",
+		"hash: hash table empty",
+		"hi",
+		"hash: hash table empty",
+		"nosuch: command not found",
+		"127",
+		"127",
+		"nosuch: command not found",
+		"plain: permission denied",
+		"126",
+		dir + ": is a directory",
+		"126",
+		dir + "/missing: no such file or directory",
+		"127",
+		"handled nosuch a b",
+		"5",
+		"HANDLED NOSUCH",
+		"hash: hash table empty",
+	}, "\n") + "\n"
+
+	if output != expected {
+		t.Fatalf("output ==\n%s\nwant\n%s", output, expected)
+	}
+
+	// hash -p подменил бы разрешенную в ограниченном режиме команду, а
+	// command - обходной путь к запрещенным встроенным командам.
+	out := &bytes.Buffer{}
+	opts := &options{restricted: &restriction{allowed: map[string]bool{"ls": true}}}
+	shell([]string{"-c", "hash -p /bin/sh ls; echo $?; command cd /; echo $?"}, &bytes.Buffer{}, out, out, opts)
+	if want := "hash: /bin/sh: restricted\n1\ncd: restricted\n1\n"; out.String() != want {
+		t.Errorf("output == %q; want %q", out.String(), want)
+	}
+}
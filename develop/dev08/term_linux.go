@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl выполняет запрос к терминалу, связанному с файлом.
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw переводит терминал в посимвольный режим без эха и сигналов от
+// Ctrl+C и Ctrl+Z и возвращает функцию, восстанавливающую прежний режим.
+// Вывод по-прежнему обрабатывается: "\n" переводит строку с возвратом каретки.
+func makeRaw(f *os.File) (func(), error) {
+	var old syscall.Termios
+	if err := ioctl(f, syscall.TCGETS, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(f, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ioctl(f, syscall.TCSETS, unsafe.Pointer(&old))
+	}, nil
+}
+
+// saveTerminal запоминает настройки терминала и возвращает функцию, которая
+// их восстанавливает.
+func saveTerminal(f *os.File) (func(), error) {
+	var state syscall.Termios
+	if err := ioctl(f, syscall.TCGETS, unsafe.Pointer(&state)); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ioctl(f, syscall.TCSETS, unsafe.Pointer(&state))
+	}, nil
+}
+
+// tcgetpgrp возвращает группу процессов переднего плана терминала. Для
+// терминала, который не управляет процессом, возвращается ошибка.
+func tcgetpgrp(f *os.File) (int, error) {
+	var pgid int32
+	if err := ioctl(f, syscall.TIOCGPGRP, unsafe.Pointer(&pgid)); err != nil {
+		return 0, err
+	}
+	return int(pgid), nil
+}
+
+// tcsetpgrp переводит группу процессов pgid на передний план терминала.
+// SIGTTOU на время вызова блокируется: иначе шелл, забирающий терминал из
+// фоновой группы, был бы остановлен.
+func tcsetpgrp(f *os.File, pgid int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	const sigBlock, sigSetmask = 0, 2
+	set, old := uint64(1)<<(syscall.SIGTTOU-1), uint64(0)
+	syscall.RawSyscall6(syscall.SYS_RT_SIGPROCMASK, sigBlock,
+		uintptr(unsafe.Pointer(&set)), uintptr(unsafe.Pointer(&old)), 8, 0, 0)
+	defer syscall.RawSyscall6(syscall.SYS_RT_SIGPROCMASK, sigSetmask,
+		uintptr(unsafe.Pointer(&old)), 0, 8, 0, 0)
+
+	id := int32(pgid)
+	return ioctl(f, syscall.TIOCSPGRP, unsafe.Pointer(&id))
+}
+
+// termWidth возвращает ширину терминала в символах.
+func termWidth(f *os.File) int {
+	var size struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	if err := ioctl(f, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil || size.cols == 0 {
+		return 80
+	}
+	return int(size.cols)
+}
@@ -0,0 +1,27 @@
+//go:build unix && !linux
+
+package main
+
+import "os"
+
+// makeRaw без termios недоступен: строки читаются без редактора.
+func makeRaw(f *os.File) (func(), error) {
+	return nil, ErrNotTerminal
+}
+
+func termWidth(f *os.File) int {
+	return 80
+}
+
+func saveTerminal(f *os.File) (func(), error) {
+	return nil, ErrNotTerminal
+}
+
+// Без termios управление заданиями не включается.
+func tcgetpgrp(f *os.File) (int, error) {
+	return 0, ErrNotTerminal
+}
+
+func tcsetpgrp(f *os.File, pgid int) error {
+	return ErrNotTerminal
+}
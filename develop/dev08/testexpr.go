@@ -0,0 +1,378 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var ErrMissingBracket = errors.New("missing `]'")
+var ErrUnaryExpected = errors.New("unary operator expected")
+var ErrBinaryExpected = errors.New("binary operator expected")
+var ErrIntegerExpected = errors.New("integer expression expected")
+var ErrParenExpected = errors.New("`)' expected")
+var ErrArgumentExpected = errors.New("argument expected")
+
+// Права для access(2).
+const (
+	accessExecute = 1
+	accessWrite   = 2
+	accessRead    = 4
+)
+
+// test вычисляет условное выражение: код возврата 0 - истина, 1 - ложь, 2 -
+// ошибка в выражении.
+func test(cmd *CMD, opts *options) Status {
+	return opts.testStatus(cmd, cmd.args)
+}
+
+// testBracket - test в форме "[ выражение ]".
+func testBracket(cmd *CMD, opts *options) Status {
+	if len(cmd.args) == 0 || cmd.args[len(cmd.args)-1] != "]" {
+		return Status{code: 2, err: fmt.Errorf("[: %w", ErrMissingBracket)}
+	}
+	return opts.testStatus(cmd, cmd.args[:len(cmd.args)-1])
+}
+
+func (opts *options) testStatus(cmd *CMD, args []string) Status {
+	t := &testExpr{cmd: cmd, opts: opts, args: args}
+	ok, err := t.eval()
+	if err != nil {
+		return Status{code: 2, err: fmt.Errorf("%s: %w", cmd.prog, err)}
+	}
+	if ok {
+		return Status{code: 0}
+	}
+	return Status{code: 1}
+}
+
+// testExpr разбирает аргументы test. До четырех аргументов выражение
+// разбирается по их числу, как требует POSIX, иначе - по грамматике
+//
+//	or      := and ('-o' and)*
+//	and     := not ('-a' not)*
+//	not     := '!' not | primary
+//	primary := '(' or ')' | UNARY arg | arg BINARY arg | arg
+type testExpr struct {
+	cmd  *CMD
+	opts *options
+	args []string
+	pos  int
+}
+
+func (t *testExpr) eval() (bool, error) {
+	args := t.args
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		return args[0] != "", nil
+	case 2:
+		if args[0] == "!" {
+			return args[1] == "", nil
+		}
+		if isUnaryTest(args[0]) {
+			return t.unary(args[0], args[1])
+		}
+		return false, fmt.Errorf("%s: %w", args[0], ErrUnaryExpected)
+	case 3:
+		if isBinaryTest(args[1]) {
+			return t.binary(args[0], args[1], args[2])
+		}
+		if args[0] == "!" {
+			ok, err := t.sub(args[1:])
+			return !ok, err
+		}
+		if args[0] == "(" && args[2] == ")" {
+			return args[1] != "", nil
+		}
+		return false, fmt.Errorf("%s: %w", args[1], ErrBinaryExpected)
+	case 4:
+		if args[0] == "!" {
+			ok, err := t.sub(args[1:])
+			return !ok, err
+		}
+		if args[0] == "(" && args[3] == ")" {
+			return t.sub(args[1:3])
+		}
+	}
+
+	ok, err := t.or()
+	if err == nil && t.pos < len(t.args) {
+		err = ErrTooManyArgs
+	}
+	return ok, err
+}
+
+// sub вычисляет часть аргументов как отдельное выражение.
+func (t *testExpr) sub(args []string) (bool, error) {
+	return (&testExpr{cmd: t.cmd, opts: t.opts, args: args}).eval()
+}
+
+func (t *testExpr) peek(offset int) (string, bool) {
+	if t.pos+offset < len(t.args) {
+		return t.args[t.pos+offset], true
+	}
+	return "", false
+}
+
+func (t *testExpr) or() (bool, error) {
+	res, err := t.and()
+	for err == nil {
+		if op, _ := t.peek(0); op != "-o" {
+			break
+		}
+		t.pos++
+
+		var ok bool
+		ok, err = t.and()
+		res = res || ok
+	}
+	return res, err
+}
+
+func (t *testExpr) and() (bool, error) {
+	res, err := t.not()
+	for err == nil {
+		if op, _ := t.peek(0); op != "-a" {
+			break
+		}
+		t.pos++
+
+		var ok bool
+		ok, err = t.not()
+		res = res && ok
+	}
+	return res, err
+}
+
+func (t *testExpr) not() (bool, error) {
+	if arg, _ := t.peek(0); arg == "!" {
+		t.pos++
+		ok, err := t.not()
+		return !ok, err
+	}
+	return t.primary()
+}
+
+func (t *testExpr) primary() (bool, error) {
+	arg, ok := t.peek(0)
+	if !ok {
+		return false, ErrArgumentExpected
+	}
+
+	if arg == "(" {
+		t.pos++
+		res, err := t.or()
+		if err != nil {
+			return false, err
+		}
+		if closing, _ := t.peek(0); closing != ")" {
+			return false, ErrParenExpected
+		}
+		t.pos++
+		return res, nil
+	}
+
+	if op, ok := t.peek(1); ok && isBinaryTest(op) && op != "-a" && op != "-o" {
+		right, ok := t.peek(2)
+		if !ok {
+			return false, fmt.Errorf("%s: %w", op, ErrArgumentExpected)
+		}
+		t.pos += 3
+		return t.binary(arg, op, right)
+	}
+
+	if isUnaryTest(arg) {
+		operand, ok := t.peek(1)
+		if !ok {
+			return false, fmt.Errorf("%s: %w", arg, ErrUnaryExpected)
+		}
+		t.pos += 2
+		return t.unary(arg, operand)
+	}
+
+	t.pos++
+	return arg != "", nil
+}
+
+func isUnaryTest(op string) bool {
+	switch op {
+	case "-b", "-c", "-d", "-e", "-f", "-g", "-h", "-L", "-k", "-n", "-p", "-r", "-s",
+		"-S", "-t", "-u", "-v", "-w", "-x", "-z", "-O", "-G":
+		return true
+	}
+	return false
+}
+
+func isBinaryTest(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<", ">", "-eq", "-ne", "-lt", "-le", "-gt", "-ge",
+		"-nt", "-ot", "-ef", "-a", "-o":
+		return true
+	}
+	return false
+}
+
+// unary вычисляет проверку строки, файла или переменной.
+func (t *testExpr) unary(op string, arg string) (bool, error) {
+	switch op {
+	case "-n":
+		return arg != "", nil
+	case "-z":
+		return arg == "", nil
+	case "-v":
+		_, ok := t.opts.getVar(arg)
+		return ok, nil
+	case "-t":
+		fd, err := testInt(arg)
+		if err != nil {
+			return false, err
+		}
+		return t.isTerminal(fd), nil
+	}
+
+	if arg == "" {
+		return false, nil
+	}
+	path := t.opts.path(arg)
+
+	switch op {
+	case "-h", "-L":
+		info, err := os.Lstat(path)
+		return err == nil && info.Mode()&os.ModeSymlink != 0, nil
+	case "-r":
+		return syscall.Access(path, accessRead) == nil, nil
+	case "-w":
+		return syscall.Access(path, accessWrite) == nil, nil
+	case "-x":
+		return syscall.Access(path, accessExecute) == nil, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, nil
+	}
+	mode := info.Mode()
+
+	switch op {
+	case "-e":
+		return true, nil
+	case "-f":
+		return mode.IsRegular(), nil
+	case "-d":
+		return mode.IsDir(), nil
+	case "-b":
+		return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0, nil
+	case "-c":
+		return mode&os.ModeCharDevice != 0, nil
+	case "-p":
+		return mode&os.ModeNamedPipe != 0, nil
+	case "-S":
+		return mode&os.ModeSocket != 0, nil
+	case "-s":
+		return info.Size() > 0, nil
+	case "-g":
+		return mode&os.ModeSetgid != 0, nil
+	case "-u":
+		return mode&os.ModeSetuid != 0, nil
+	case "-k":
+		return mode&os.ModeSticky != 0, nil
+	case "-O", "-G":
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return false, nil
+		}
+		if op == "-O" {
+			return int(st.Uid) == os.Geteuid(), nil
+		}
+		return int(st.Gid) == os.Getegid(), nil
+	}
+	return false, fmt.Errorf("%s: %w", op, ErrUnaryExpected)
+}
+
+// isTerminal проверяет, подключен ли дескриптор команды к терминалу.
+func (t *testExpr) isTerminal(fd int64) bool {
+	var stream interface{}
+	switch fd {
+	case 0:
+		stream = t.cmd.stdin
+	case 1:
+		stream = t.cmd.stdout
+	case 2:
+		stream = t.cmd.stderr
+	}
+	f, ok := stream.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// binary сравнивает строки, числа или файлы.
+func (t *testExpr) binary(left string, op string, right string) (bool, error) {
+	switch op {
+	case "=", "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "<":
+		return left < right, nil
+	case ">":
+		return left > right, nil
+	case "-a":
+		return left != "" && right != "", nil
+	case "-o":
+		return left != "" || right != "", nil
+	case "-nt", "-ot", "-ef":
+		return t.compareFiles(left, op, right), nil
+	}
+
+	a, err := testInt(left)
+	if err != nil {
+		return false, err
+	}
+	b, err := testInt(right)
+	if err != nil {
+		return false, err
+	}
+
+	switch op {
+	case "-eq":
+		return a == b, nil
+	case "-ne":
+		return a != b, nil
+	case "-lt":
+		return a < b, nil
+	case "-le":
+		return a <= b, nil
+	case "-gt":
+		return a > b, nil
+	}
+	return a >= b, nil
+}
+
+// compareFiles сравнивает время изменения файлов (-nt, -ot) или проверяет,
+// что это один и тот же файл (-ef). Несуществующий файл старше любого.
+func (t *testExpr) compareFiles(left string, op string, right string) bool {
+	a, errA := os.Stat(t.opts.path(left))
+	b, errB := os.Stat(t.opts.path(right))
+
+	switch op {
+	case "-nt":
+		return errA == nil && (errB != nil || a.ModTime().After(b.ModTime()))
+	case "-ot":
+		return errB == nil && (errA != nil || a.ModTime().Before(b.ModTime()))
+	}
+	return errA == nil && errB == nil && os.SameFile(a, b)
+}
+
+func testInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", s, ErrIntegerExpected)
+	}
+	return n, nil
+}
@@ -0,0 +1,336 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// variable - переменная шелла. Экспортированные переменные попадают в
+// окружение запускаемых программ.
+type variable struct {
+	value    string
+	exported bool
+}
+
+type variables map[string]*variable
+
+// environVariables возвращает переменные окружения процесса, все
+// экспортированные.
+func environVariables() variables {
+	vars := make(variables)
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok && isName(name) {
+			vars[name] = &variable{value: value, exported: true}
+		}
+	}
+	return vars
+}
+
+func (vars variables) clone() variables {
+	res := make(variables, len(vars))
+	for name, v := range vars {
+		copied := *v
+		res[name] = &copied
+	}
+	return res
+}
+
+func (vars variables) names() []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isName сообщает, может ли строка быть именем переменной.
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' && !isLetter(c) && (i == 0 || !isDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isAssignment сообщает, является ли слово присваиванием NAME=value.
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	return ok && isName(name)
+}
+
+var ErrInvalidName = errors.New("not a valid identifier")
+var ErrExportInvalidOption = errors.New("export: invalid option")
+
+func (opts *options) getVar(name string) (string, bool) {
+	if v, ok := opts.vars[name]; ok {
+		return v.value, true
+	}
+	return "", false
+}
+
+func (opts *options) setVar(name string, value string) error {
+	if !isName(name) {
+		return fmt.Errorf("`%s': %w", name, ErrInvalidName)
+	}
+	if err := opts.restrictVar(name); err != nil {
+		return err
+	}
+
+	if v, ok := opts.vars[name]; ok {
+		v.value = value
+	} else {
+		opts.vars[name] = &variable{value: value}
+	}
+	return nil
+}
+
+// param возвращает значение параметра: переменной, позиционного параметра
+// или специального параметра ($?, $!, $$, $#, $@, $*, $-, $0).
+func (opts *options) param(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(opts.lastCmdCode), true
+	case "!":
+		if opts.lastBgPid == 0 {
+			return "", false
+		}
+		return strconv.Itoa(opts.lastBgPid), true
+	case "$":
+		return strconv.Itoa(opts.pid), true
+	case "#":
+		return strconv.Itoa(len(opts.args)), true
+	case "@", "*":
+		return strings.Join(opts.args, " "), true
+	case "-":
+		return opts.flags(), true
+	case "0":
+		return opts.arg0, true
+	}
+
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 1 || n > len(opts.args) {
+			return "", false
+		}
+		return opts.args[n-1], true
+	}
+
+	return opts.getVar(name)
+}
+
+// environ возвращает окружение для запускаемой программы: экспортированные
+// переменные и присваивания перед именем команды.
+func (opts *options) environ(assigns []string) []string {
+	env := []string{}
+	for _, name := range opts.vars.names() {
+		if v := opts.vars[name]; v.exported {
+			env = append(env, name+"="+v.value)
+		}
+	}
+	return append(env, assigns...)
+}
+
+// findInPath ищет исполняемый файл prog в каталогах path, а с all
+// возвращает все найденные файлы, а не первый.
+func findInPath(prog string, path string, all bool) []string {
+	files := []string{}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+
+		file := filepath.Join(dir, prog)
+		if isExecutable(file) {
+			files = append(files, file)
+			if !all {
+				break
+			}
+		}
+	}
+	return files
+}
+
+// isExecutable сообщает, является ли файл исполняемым файлом, а не
+// каталогом.
+func isExecutable(file string) bool {
+	info, err := os.Stat(file)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// command готовит запуск программы с окружением и текущим каталогом шелла.
+func (opts *options) command(prog string, args []string, assigns []string) (*exec.Cmd, error) {
+	if err := opts.restrictCommand(prog); err != nil {
+		return nil, err
+	}
+
+	path, err := opts.findCommand(prog, assigns)
+	if err != nil {
+		return nil, err
+	}
+	env := opts.environ(assigns)
+
+	c := exec.Command(path, args...)
+	c.Args[0] = prog
+	c.Env = env
+	c.Dir = opts.workDir
+	if err := opts.restricted.limit(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// assignTemp выполняет присваивания перед встроенной командой и возвращает
+// функцию, восстанавливающую прежние значения.
+func (opts *options) assignTemp(assigns []string) func() {
+	saved := make(map[string]*variable, len(assigns))
+	for _, kv := range assigns {
+		name, value, _ := strings.Cut(kv, "=")
+		if _, ok := saved[name]; !ok {
+			saved[name] = opts.vars[name]
+		}
+		opts.vars[name] = &variable{value: value}
+	}
+
+	return func() {
+		for name, v := range saved {
+			if v == nil {
+				delete(opts.vars, name)
+			} else {
+				opts.vars[name] = v
+			}
+		}
+	}
+}
+
+func export(cmd *CMD, opts *options) Status {
+	unexport, list := false, false
+	args := cmd.args
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-n":
+			unexport = true
+		case "-p":
+			list = true
+		case "--":
+		default:
+			return Status{code: 2, err: fmt.Errorf("%w: %s", ErrExportInvalidOption, args[0])}
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 0 || list {
+		return printExported(cmd.stdout, opts)
+	}
+
+	status := Status{code: 0}
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !isName(name) {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("export: `%s': %w", arg, ErrInvalidName)})
+			continue
+		}
+		if err := opts.restrictVar(name); err != nil {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("export: %w", err)})
+			continue
+		}
+
+		v, ok := opts.vars[name]
+		if !ok {
+			if unexport {
+				continue
+			}
+			v = &variable{}
+			opts.vars[name] = v
+		}
+
+		if hasValue {
+			v.value = value
+		}
+		v.exported = !unexport
+	}
+
+	return status
+}
+
+func printExported(w io.Writer, opts *options) Status {
+	for _, name := range opts.vars.names() {
+		v := opts.vars[name]
+		if !v.exported {
+			continue
+		}
+
+		if _, pErr := fmt.Fprintf(w, "declare -x %s=\"%s\"\n", name, dquoteEscaper.Replace(v.value)); pErr != nil {
+			return Status{exit: true, code: 1, err: pErr}
+		}
+	}
+
+	return Status{code: 0}
+}
+
+// dquoteEscaper экранирует символы, особые внутри двойных кавычек.
+var dquoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+// unset удаляет переменные (-v) или функции (-f). Без флагов, как в bash,
+// удаляется переменная, а если ее нет - функция с этим именем.
+func unset(cmd *CMD, opts *options) Status {
+	args := cmd.args
+	mode := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			switch c := arg[i]; c {
+			case 'f', 'v':
+				mode = string(c)
+			default:
+				return Status{code: 2, err: fmt.Errorf("unset: -%c: %w", c, ErrInvalidOption)}
+			}
+		}
+	}
+
+	status := Status{code: 0}
+	for _, name := range args {
+		if _, isVar := opts.vars[name]; mode == "f" || mode == "" && !isVar && opts.funcs[name] != nil {
+			delete(opts.funcs, name)
+			continue
+		}
+		if !isName(name) {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("unset: `%s': %w", name, ErrInvalidName)})
+			continue
+		}
+		if err := opts.restrictVar(name); err != nil {
+			status = cmd.report(Status{code: 1, err: fmt.Errorf("unset: %w", err)})
+			continue
+		}
+		delete(opts.vars, name)
+	}
+
+	return status
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Константы waitid(2), которых нет в пакете syscall.
+const (
+	pPid       = 1
+	wNowait    = 0x1000000
+	cldStopped = 5
+)
+
+// siginfo - начало структуры siginfo_t: нужен только si_code.
+type siginfo struct {
+	signo int32
+	errno int32
+	code  int32
+	_     [29]int32
+}
+
+func waitid(pid int, options int) (siginfo, error) {
+	var info siginfo
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPid, uintptr(pid),
+			uintptr(unsafe.Pointer(&info)), uintptr(options), 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return info, errno
+		}
+		return info, nil
+	}
+}
+
+// waitStop ждет, пока процесс pid остановится или завершится, и возвращает
+// true, если он остановлен. Завершившийся процесс остается зомби: его
+// забирает exec.Cmd.Wait, а остановка снимается отсюда, чтобы не срабатывать
+// повторно.
+func waitStop(pid int) bool {
+	info, err := waitid(pid, syscall.WEXITED|syscall.WSTOPPED|wNowait)
+	if err != nil || info.code != cldStopped {
+		return false
+	}
+
+	// Только остановку: WEXITED здесь забрал бы у exec.Cmd.Wait код возврата.
+	_, err = waitid(pid, syscall.WSTOPPED|syscall.WNOHANG)
+	return err == nil
+}
+
+// isTerminal сообщает, связан ли файл с терминалом.
+func isTerminal(f *os.File) bool {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	var errno syscall.Errno
+	var termios syscall.Termios
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS,
+			uintptr(unsafe.Pointer(&termios)))
+	})
+	return err == nil && errno == 0
+}
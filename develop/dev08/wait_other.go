@@ -0,0 +1,15 @@
+//go:build unix && !linux
+
+package main
+
+import "os"
+
+// waitStop без waitid не может узнать об остановке процесса: задание считается
+// выполняющимся, пока не завершится.
+func waitStop(pid int) bool {
+	return false
+}
+
+func isTerminal(f *os.File) bool {
+	return false
+}